@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// adminServicePrefix is the start of the full method name of every Admin rpc
+const adminServicePrefix = "/Admin/"
+
+var (
+	errAdminDisabled = status.Error(codes.PermissionDenied, "admin rpcs are disabled because the server has no admin token")
+	errBadAdminToken = status.Error(codes.Unauthenticated, "missing or invalid admin token")
+)
+
+// checkAdmin makes sure ctx carries adminToken
+func checkAdmin(ctx context.Context, adminToken string) error {
+	if adminToken == "" {
+		return errAdminDisabled
+	}
+	if subtle.ConstantTimeCompare([]byte(tokenFromContext(ctx)), []byte(adminToken)) != 1 {
+		return errBadAdminToken
+	}
+	return nil
+}
+
+//AdminUnaryServerInterceptor rejects Admin rpcs that don't carry adminToken, or every Admin rpc when it is empty.
+//Other services are left alone.
+func AdminUnaryServerInterceptor(adminToken string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasPrefix(info.FullMethod, adminServicePrefix) {
+			if err := checkAdmin(ctx, adminToken); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAdminUnaryServerInterceptor(t *testing.T) {
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "handled", nil
+	}
+	listInfo := &grpc.UnaryServerInfo{FullMethod: "/Admin/ListQueues"}
+	req := &queue.ListQueuesRequest{}
+
+	t.Run("allows the admin token", func(t *testing.T) {
+		got, err := AdminUnaryServerInterceptor("shhh")(withToken("shhh"), req, listInfo, handler)
+		assert.Nil(t, err)
+		assert.Equal(t, "handled", got)
+	})
+
+	t.Run("rejects other tokens", func(t *testing.T) {
+		_, err := AdminUnaryServerInterceptor("shhh")(withToken("shh"), req, listInfo, handler)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		_, err = AdminUnaryServerInterceptor("shhh")(context.Background(), req, listInfo, handler)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("rejects everything without an admin token", func(t *testing.T) {
+		_, err := AdminUnaryServerInterceptor("")(withToken(""), req, listInfo, handler)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("ignores other services", func(t *testing.T) {
+		popInfo := &grpc.UnaryServerInfo{FullMethod: "/Queue/Pop"}
+		got, err := AdminUnaryServerInterceptor("")(context.Background(), "req", popInfo, handler)
+		assert.Nil(t, err)
+		assert.Equal(t, "handled", got)
+	})
+}
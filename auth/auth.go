@@ -0,0 +1,156 @@
+//Package auth issues and checks the credentials consumers use to reach a queue over grpc
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// metadataKey is the grpc metadata that holds the token
+	metadataKey = "authorization"
+
+	// queueServicePrefix is the start of the full method name of every Queue rpc
+	queueServicePrefix = "/Queue/"
+)
+
+var errUnauthenticated = status.Error(codes.Unauthenticated, "missing or invalid credentials for queue")
+
+//Tokens issues and checks consumer tokens. A token is an HMAC of the queue id, so nothing needs to be stored.
+type Tokens struct {
+	secret []byte
+}
+
+//NewTokens returns Tokens that are signed with secret
+func NewTokens(secret string) *Tokens {
+	return &Tokens{secret: []byte(secret)}
+}
+
+func (t *Tokens) sum(queueID string) []byte {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte("consumer:" + queueID)) //nolint: errcheck
+	return mac.Sum(nil)
+}
+
+//Token returns the consumer token for a queue id
+func (t *Tokens) Token(queueID string) string {
+	return base64.RawURLEncoding.EncodeToString(t.sum(queueID))
+}
+
+//Valid reports whether token is the consumer token for a queue id
+func (t *Tokens) Valid(queueID, token string) bool {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	return err == nil && hmac.Equal(decoded, t.sum(queueID))
+}
+
+//QueueID returns the id a queue name belongs to. Sub-queues like "id/foo" and "id:quarantine" share a token with "id".
+func QueueID(queueName string) string {
+	if i := strings.IndexAny(queueName, "/:"); i >= 0 {
+		return queueName[:i]
+	}
+	return queueName
+}
+
+//Authorizer decides whether the caller of an rpc may use a queue
+type Authorizer interface {
+	//Authorized reports whether the caller in ctx may use the queue with queueName
+	Authorized(ctx context.Context, queueName string) bool
+}
+
+//Authorized reports whether ctx carries the consumer token for queueName
+func (t *Tokens) Authorized(ctx context.Context, queueName string) bool {
+	return t.Valid(QueueID(queueName), tokenFromContext(ctx))
+}
+
+type queueRequest interface {
+	GetQueueName() string
+}
+
+func tokenFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, value := range md[metadataKey] {
+		if strings.HasPrefix(value, "Bearer ") {
+			return strings.TrimPrefix(value, "Bearer ")
+		}
+	}
+	return ""
+}
+
+// check makes sure one of the authorizers accepts the queue a Queue rpc names
+func check(ctx context.Context, req interface{}, authorizers []Authorizer) error {
+	qr, ok := req.(queueRequest)
+	if !ok || qr.GetQueueName() == "" {
+		return errUnauthenticated
+	}
+	for _, authorizer := range authorizers {
+		if authorizer.Authorized(ctx, qr.GetQueueName()) {
+			return nil
+		}
+	}
+	return errUnauthenticated
+}
+
+//UnaryServerInterceptor rejects Queue rpcs that none of the authorizers accept. Other services are left alone.
+func UnaryServerInterceptor(authorizers ...Authorizer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasPrefix(info.FullMethod, queueServicePrefix) {
+			if err := check(ctx, req, authorizers); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+//StreamServerInterceptor rejects Queue streams that none of the authorizers accept. Other services are left alone.
+func StreamServerInterceptor(authorizers ...Authorizer) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !strings.HasPrefix(info.FullMethod, queueServicePrefix) {
+			return handler(srv, ss)
+		}
+		return handler(srv, &checkedStream{ServerStream: ss, authorizers: authorizers})
+	}
+}
+
+// checkedStream checks every message the client sends
+type checkedStream struct {
+	grpc.ServerStream
+	authorizers []Authorizer
+}
+
+func (s *checkedStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err != nil {
+		return err
+	}
+	return check(s.Context(), m, s.authorizers)
+}
+
+//Credentials sends a consumer token with every rpc
+type Credentials struct {
+	Token string
+	// Insecure allows sending the token without tls
+	Insecure bool
+}
+
+//GetRequestMetadata implements credentials.PerRPCCredentials
+func (c *Credentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{metadataKey: "Bearer " + c.Token}, nil
+}
+
+//RequireTransportSecurity implements credentials.PerRPCCredentials
+func (c *Credentials) RequireTransportSecurity() bool {
+	return !c.Insecure
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func withToken(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(metadataKey, "Bearer "+token))
+}
+
+func TestTokens(t *testing.T) {
+	tokens := NewTokens("shhh")
+	token := tokens.Token("abc")
+	assert.True(t, tokens.Valid("abc", token))
+	assert.False(t, tokens.Valid("abd", token))
+	assert.False(t, tokens.Valid("abc", ""))
+	assert.False(t, NewTokens("other").Valid("abc", token))
+}
+
+func TestQueueID(t *testing.T) {
+	assert.Equal(t, "abc", QueueID("abc"))
+	assert.Equal(t, "abc", QueueID("abc/foo"))
+	assert.Equal(t, "abc", QueueID("abc:quarantine"))
+	assert.Equal(t, "abc", QueueID("abc/foo:quarantine"))
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tokens := NewTokens("shhh")
+	interceptor := UnaryServerInterceptor(tokens)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "handled", nil
+	}
+	popInfo := &grpc.UnaryServerInfo{FullMethod: "/Queue/Pop"}
+
+	t.Run("allows valid tokens", func(t *testing.T) {
+		got, err := interceptor(withToken(tokens.Token("abc")), &queue.PopRequest{QueueName: "abc/foo"}, popInfo, handler)
+		assert.Nil(t, err)
+		assert.Equal(t, "handled", got)
+	})
+
+	t.Run("rejects another queue's token", func(t *testing.T) {
+		_, err := interceptor(withToken(tokens.Token("def")), &queue.PopRequest{QueueName: "abc"}, popInfo, handler)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("rejects missing tokens", func(t *testing.T) {
+		_, err := interceptor(context.Background(), &queue.PopRequest{QueueName: "abc"}, popInfo, handler)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("allows any authorizer", func(t *testing.T) {
+		interceptor := UnaryServerInterceptor(NewTokens("other"), tokens)
+		got, err := interceptor(withToken(tokens.Token("abc")), &queue.PopRequest{QueueName: "abc"}, popInfo, handler)
+		assert.Nil(t, err)
+		assert.Equal(t, "handled", got)
+	})
+
+	t.Run("ignores other services", func(t *testing.T) {
+		got, err := interceptor(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: "/Other/Call"}, handler)
+		assert.Nil(t, err)
+		assert.Equal(t, "handled", got)
+	})
+}
+
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	msg *queue.SubscribeRequest
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeServerStream) RecvMsg(m interface{}) error {
+	*m.(*queue.SubscribeRequest) = *s.msg
+	return nil
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	tokens := NewTokens("shhh")
+	interceptor := StreamServerInterceptor(tokens)
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		return stream.RecvMsg(new(queue.SubscribeRequest))
+	}
+	info := &grpc.StreamServerInfo{FullMethod: "/Queue/Subscribe", IsServerStream: true}
+
+	t.Run("allows valid tokens", func(t *testing.T) {
+		ss := &fakeServerStream{ctx: withToken(tokens.Token("abc")), msg: &queue.SubscribeRequest{QueueName: "abc"}}
+		assert.Nil(t, interceptor(nil, ss, info, handler))
+	})
+
+	t.Run("rejects invalid tokens", func(t *testing.T) {
+		ss := &fakeServerStream{ctx: withToken("nope"), msg: &queue.SubscribeRequest{QueueName: "abc"}}
+		assert.Equal(t, codes.Unauthenticated, status.Code(interceptor(nil, ss, info, handler)))
+	})
+}
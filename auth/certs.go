@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/WillAbides/xqsmee/policy"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+//ClientCerts authorizes consumers by the client certificate they connected with. The certificate's subject common name
+//has to be listed in the clients of the queue's policy.
+type ClientCerts struct {
+	Policies policy.Store
+}
+
+//Authorized reports whether the caller's client certificate is allowed to use queueName
+func (c *ClientCerts) Authorized(ctx context.Context, queueName string) bool {
+	if c.Policies == nil {
+		return false
+	}
+	return c.Policies.Policy(QueueID(queueName)).AllowsClient(clientCommonName(ctx))
+}
+
+// clientCommonName returns the subject common name of the caller's verified client certificate
+func clientCommonName(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
+}
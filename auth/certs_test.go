@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/WillAbides/xqsmee/policy"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+func withClientCert(commonName string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert}},
+		}},
+	})
+}
+
+func TestClientCerts_Authorized(t *testing.T) {
+	certs := &ClientCerts{Policies: policy.Static{
+		"abc": {Clients: []string{"worker"}},
+	}}
+	assert.True(t, certs.Authorized(withClientCert("worker"), "abc"))
+	assert.True(t, certs.Authorized(withClientCert("worker"), "abc/foo"))
+	assert.False(t, certs.Authorized(withClientCert("intruder"), "abc"))
+	assert.False(t, certs.Authorized(withClientCert("worker"), "def"))
+	assert.False(t, certs.Authorized(context.Background(), "abc"))
+	assert.False(t, (&ClientCerts{}).Authorized(withClientCert("worker"), "abc"))
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+
+	"github.com/WillAbides/idcheck"
+)
+
+const (
+	// idRandomLength is how much of an id is random. It is as much as an idcheck id has.
+	idRandomLength = len(idcheck.ID{}) - 1
+	// idTagLength is how much of an HMAC of the random part follows it
+	idTagLength = 8
+)
+
+//IDChecker issues queue ids that are signed with a secret, so they can't be made up without it. Ids are url-safe
+//base64 like idcheck's, but longer.
+type IDChecker struct {
+	// secrets are tried in order. New ids are signed with the first one.
+	secrets [][]byte
+
+	//Legacy accepts ids from an idcheck checksum checker too, so queues created before switching to secrets still
+	//work. It is never used to issue ids.
+	Legacy idcheck.IDChecker
+
+	idReader io.Reader
+}
+
+//NewIDChecker returns an IDChecker that signs new ids with secret and still accepts ids signed with the previous
+//secrets. To rotate, move the current secret to previous and set a new one.
+func NewIDChecker(secret string, previous ...string) *IDChecker {
+	secrets := [][]byte{[]byte(secret)}
+	for _, p := range previous {
+		if p != "" {
+			secrets = append(secrets, []byte(p))
+		}
+	}
+	return &IDChecker{
+		secrets:  secrets,
+		idReader: rand.Reader,
+	}
+}
+
+func idTag(secret []byte, random []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("queue-id:")) //nolint: errcheck
+	mac.Write(random)              //nolint: errcheck
+	return mac.Sum(nil)[:idTagLength]
+}
+
+//NewID returns a new id signed with the current secret
+func (c *IDChecker) NewID() (string, error) {
+	id := make([]byte, idRandomLength, idRandomLength+idTagLength)
+	_, err := io.ReadFull(c.idReader, id)
+	if err != nil {
+		return "", err
+	}
+	id = append(id, idTag(c.secrets[0], id)...)
+	return base64.RawURLEncoding.EncodeToString(id), nil
+}
+
+//ValidID reports whether id was signed with any of the secrets or is accepted by Legacy
+func (c *IDChecker) ValidID(id string) bool {
+	b, err := base64.RawURLEncoding.Strict().DecodeString(id)
+	if err == nil && len(b) == idRandomLength+idTagLength {
+		for _, secret := range c.secrets {
+			if hmac.Equal(b[idRandomLength:], idTag(secret, b[:idRandomLength])) {
+				return true
+			}
+		}
+	}
+	if c.Legacy == nil {
+		return false
+	}
+	legacyID, err := idcheck.FromBase64(id)
+	return err == nil && c.Legacy.ValidID(legacyID)
+}
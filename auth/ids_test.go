@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/WillAbides/idcheck"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIDChecker(t *testing.T) {
+	t.Run("accepts its own ids", func(t *testing.T) {
+		checker := NewIDChecker("current")
+		id, err := checker.NewID()
+		require.Nil(t, err)
+		assert.True(t, checker.ValidID(id))
+		other, err := checker.NewID()
+		require.Nil(t, err)
+		assert.NotEqual(t, id, other)
+	})
+
+	t.Run("keeps as much randomness as idcheck", func(t *testing.T) {
+		id, err := NewIDChecker("current").NewID()
+		require.Nil(t, err)
+		b, err := base64.RawURLEncoding.DecodeString(id)
+		require.Nil(t, err)
+		assert.Len(t, b, len(idcheck.ID{})-1+8)
+	})
+
+	t.Run("rejects ids signed with other secrets", func(t *testing.T) {
+		id, err := NewIDChecker("other").NewID()
+		require.Nil(t, err)
+		assert.False(t, NewIDChecker("current").ValidID(id))
+	})
+
+	t.Run("rejects tampered ids", func(t *testing.T) {
+		checker := NewIDChecker("current")
+		id, err := checker.NewID()
+		require.Nil(t, err)
+		b, err := base64.RawURLEncoding.DecodeString(id)
+		require.Nil(t, err)
+		b[0]++
+		assert.False(t, checker.ValidID(base64.RawURLEncoding.EncodeToString(b)))
+		assert.False(t, checker.ValidID(id[:len(id)-1]))
+		assert.False(t, checker.ValidID("not base64!"))
+	})
+
+	t.Run("accepts ids signed with previous secrets", func(t *testing.T) {
+		id, err := NewIDChecker("old").NewID()
+		require.Nil(t, err)
+		rotated := NewIDChecker("new", "old")
+		assert.True(t, rotated.ValidID(id))
+		newID, err := rotated.NewID()
+		require.Nil(t, err)
+		assert.True(t, NewIDChecker("new").ValidID(newID))
+		assert.False(t, NewIDChecker("old").ValidID(newID))
+	})
+
+	t.Run("accepts legacy ids when asked", func(t *testing.T) {
+		legacy := idcheck.NewIDChecker(idcheck.Salt("salt"))
+		id, err := legacy.NewID()
+		require.Nil(t, err)
+		checker := NewIDChecker("current")
+		assert.False(t, checker.ValidID(id.Base64()))
+		checker.Legacy = legacy
+		assert.True(t, checker.ValidID(id.Base64()))
+	})
+}
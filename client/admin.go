@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"log"
+
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// withAdmin calls fn with a client for the server's Admin service. config.Token has to be the admin token.
+// Servers whose backend can't run admin rpcs answer Unimplemented, which gets an error that says so.
+func withAdmin(ctx context.Context, config *Config, fn func(queue.AdminClient) error) error {
+	conn, err := dialGRPC(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Println("failed closing connection: ", err)
+		}
+	}()
+	err = fn(queue.NewAdminClient(conn))
+	if status.Code(err) == codes.Unimplemented {
+		return errors.Errorf("the server can't run admin commands: %s", status.Convert(err).Message())
+	}
+	return err
+}
+
+//ListQueues describes every queue on the server
+func ListQueues(ctx context.Context, config *Config) ([]*queue.QueueStats, error) {
+	var queues []*queue.QueueStats
+	err := withAdmin(ctx, config, func(c queue.AdminClient) error {
+		r, err := c.ListQueues(ctx, &queue.ListQueuesRequest{})
+		queues = r.GetQueues()
+		return err
+	})
+	return queues, err
+}
+
+//Stats describes config.QueueName
+func Stats(ctx context.Context, config *Config) (*queue.QueueStats, error) {
+	var stats *queue.QueueStats
+	err := withAdmin(ctx, config, func(c queue.AdminClient) error {
+		var err error
+		stats, err = c.Stats(ctx, &queue.StatsRequest{QueueName: config.QueueName})
+		return err
+	})
+	return stats, err
+}
+
+//Purge removes the waiting items from config.QueueName and returns how many it removed
+func Purge(ctx context.Context, config *Config) (int64, error) {
+	var count int64
+	err := withAdmin(ctx, config, func(c queue.AdminClient) error {
+		r, err := c.Purge(ctx, &queue.PurgeRequest{QueueName: config.QueueName})
+		count = r.GetCount()
+		return err
+	})
+	return count, err
+}
+
+//Delete removes everything in config.QueueName
+func Delete(ctx context.Context, config *Config) error {
+	return withAdmin(ctx, config, func(c queue.AdminClient) error {
+		_, err := c.Delete(ctx, &queue.DeleteRequest{QueueName: config.QueueName})
+		return err
+	})
+}
@@ -3,37 +3,129 @@ package client
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"log"
+	"time"
 
+	"github.com/WillAbides/xqsmee/auth"
 	"github.com/WillAbides/xqsmee/queue"
+	"github.com/pkg/errors"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 )
 
+//DefaultDeliveryTimeout is how long a delivery may take when a Config doesn't say otherwise. It is well under the
+//server's default lease so requests aren't delivered again while they are still being handled.
+const DefaultDeliveryTimeout = 15 * time.Second
+
 //Config is the config for running a client
 type Config struct {
-	Host      string
-	QueueName string
-	Separator string
-	Port      int
-	Insecure  bool
-	UseTLS    bool
-	Stdout    io.Writer
+	Host           string
+	QueueName      string
+	Separator      string
+	Port           int
+	MaxOutstanding int64
+	Insecure       bool
+	UseTLS         bool
+	// Token is the consumer token for the queue. It is only sent when it isn't empty.
+	Token string
+	// CertFile and KeyFile are a client certificate to connect with
+	CertFile string
+	KeyFile  string
+	// CAFile holds the cas to check the server certificate with instead of the system's
+	CAFile string
+	Stdout io.Writer
+	// Target is a url to forward requests to
+	Target string
+	// Exec is a shell command to run for each request. When neither Target nor Exec is set, requests are written to
+	// Stdout as json.
+	Exec string
+	// RetryDelay is how long to wait before handing back a request that couldn't be delivered
+	RetryDelay time.Duration
+	// DeliveryTimeout is how long forwarding to Target or running Exec may take before the request is retried. It
+	// should be well under the server's lease. Defaults to DefaultDeliveryTimeout.
+	DeliveryTimeout time.Duration
+}
+
+func (config *Config) deliveryTimeout() time.Duration {
+	if config.DeliveryTimeout > 0 {
+		return config.DeliveryTimeout
+	}
+	return DefaultDeliveryTimeout
+}
+
+// retryError is a delivery failure that should be retried instead of stopping the client
+type retryError struct {
+	err error
+}
+
+func (e *retryError) Error() string {
+	return e.err.Error()
+}
+
+// deliverFunc hands a popped request to wherever the client sends them
+type deliverFunc func(ctx context.Context, webRequest *queue.WebRequest) error
+
+func (config *Config) deliverFunc() deliverFunc {
+	if config.Target != "" {
+		return newForwarder(config).deliver
+	}
+	if config.Exec != "" {
+		return newExecutor(config).deliver
+	}
+	return func(ctx context.Context, webRequest *queue.WebRequest) error {
+		return emit(config, webRequest)
+	}
 }
 
 func dialGRPC(ctx context.Context, config *Config) (*grpc.ClientConn, error) {
 	addr := fmt.Sprintf("%s:%d", config.Host, config.Port)
+	var opts []grpc.DialOption
+	if config.Token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(&auth.Credentials{
+			Token:    config.Token,
+			Insecure: !config.UseTLS,
+		}))
+	}
 	if config.UseTLS {
-		tlsConfig := &tls.Config{ServerName: config.Host}
-		if config.Insecure {
-			tlsConfig.InsecureSkipVerify = true
+		tlsConfig, err := config.tlsConfig()
+		if err != nil {
+			return nil, err
 		}
 		creds := credentials.NewTLS(tlsConfig)
-		return grpc.DialContext(ctx, addr, grpc.WithTransportCredentials(creds))
+		return grpc.DialContext(ctx, addr, append(opts, grpc.WithTransportCredentials(creds))...)
+	}
+	return grpc.DialContext(ctx, addr, append(opts, grpc.WithInsecure())...)
+}
+
+func (config *Config) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: config.Host}
+	if config.Insecure {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed loading client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if config.CAFile != "" {
+		caPEMBlock, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed reading ca file")
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caPEMBlock) {
+			return nil, errors.New("no certificates found in ca file")
+		}
+		tlsConfig.RootCAs = rootCAs
 	}
-	return grpc.DialContext(ctx, addr, grpc.WithInsecure())
+	return tlsConfig, nil
 }
 
 //Run runs a client
@@ -50,22 +142,133 @@ func Run(ctx context.Context, config *Config) error {
 	}()
 
 	c := queue.NewQueueClient(conn)
+	deliver := config.deliverFunc()
+
+	stream, err := c.Subscribe(ctx, &queue.SubscribeRequest{
+		QueueName:      config.QueueName,
+		MaxOutstanding: config.MaxOutstanding,
+	})
+	if err != nil {
+		return err
+	}
 
 	for {
-		r, err := c.Pop(ctx, &queue.PopRequest{QueueName: config.QueueName})
+		webRequest, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
 			return err
 		}
-		webRequest := r.GetWebRequest()
-		if webRequest != nil {
-			jb, err := json.Marshal(webRequest)
-			if err != nil {
-				return err
+		err = deliver(ctx, webRequest)
+		if err != nil {
+			_, retry := err.(*retryError)
+			if retry {
+				log.Printf("failed delivering %s, will retry: %v", webRequest.GetID(), err)
+				wait(ctx, config.RetryDelay)
+			}
+			_, nackErr := c.Nack(ctx, &queue.NackRequest{QueueName: config.QueueName, ID: webRequest.GetID()})
+			if nackErr != nil {
+				log.Println("failed nacking: ", nackErr)
+			}
+			if retry {
+				continue
 			}
-			_, err = fmt.Fprintf(config.Stdout, "%s%s", string(jb), config.Separator)
+			return err
+		}
+		_, err = c.Ack(ctx, &queue.AckRequest{QueueName: config.QueueName, ID: webRequest.GetID()})
+		if queue.IsNotInFlight(err) {
+			// the lease ran out during a slow delivery, so the request will be delivered again
+			log.Printf("failed acking %s: %v", webRequest.GetID(), err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+//RequeueDead moves a queue's dead letters back onto the queue and returns how many it moved
+func RequeueDead(ctx context.Context, config *Config) (int64, error) {
+	conn, err := dialGRPC(ctx, config)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Println("failed closing connection: ", err)
+		}
+	}()
+	r, err := queue.NewQueueClient(conn).RequeueDead(ctx, &queue.RequeueDeadRequest{QueueName: config.QueueName})
+	return r.GetCount(), err
+}
+
+// pushBatchSize is how many requests Push sends in one rpc
+const pushBatchSize = 100
+
+//Push adds requests read from r to the queue and returns how many it added. r has json requests like the ones Run
+// writes, separated by whitespace.
+func Push(ctx context.Context, config *Config, r io.Reader) (int64, error) {
+	conn, err := dialGRPC(ctx, config)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Println("failed closing connection: ", err)
+		}
+	}()
+	c := queue.NewQueueClient(conn)
+	var count int64
+	push := func(webRequests []*queue.WebRequest) error {
+		resp, err := c.Push(ctx, &queue.PushRequest{QueueName: config.QueueName, WebRequest: webRequests})
+		count += resp.GetCount()
+		return err
+	}
+	decoder := json.NewDecoder(r)
+	var batch []*queue.WebRequest
+	for {
+		webRequest := new(queue.WebRequest)
+		err = decoder.Decode(webRequest)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, errors.Wrap(err, "failed reading request")
+		}
+		batch = append(batch, webRequest)
+		if len(batch) == pushBatchSize {
+			err = push(batch)
 			if err != nil {
-				return err
+				return count, err
 			}
+			batch = nil
 		}
 	}
+	if len(batch) == 0 {
+		return count, nil
+	}
+	return count, push(batch)
+}
+
+// wait sleeps for d or until ctx is done
+func wait(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+func emit(config *Config, webRequest *queue.WebRequest) error {
+	// json.Marshal would html escape the body again
+	jb, err := webRequest.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(config.Stdout, "%s%s", string(jb), config.Separator)
+	return err
 }
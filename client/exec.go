@@ -0,0 +1,75 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WillAbides/xqsmee/queue"
+)
+
+type executor struct {
+	command string
+	stdout  io.Writer
+	timeout time.Duration
+}
+
+func newExecutor(config *Config) *executor {
+	return &executor{
+		command: config.Exec,
+		stdout:  config.Stdout,
+		timeout: config.deliveryTimeout(),
+	}
+}
+
+//headerEnvName converts a header name to the environment variable the command gets it in
+func headerEnvName(name string) string {
+	return "XQSMEE_HEADER_" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+//env is the environment the command runs with
+func (e *executor) env(webRequest *queue.WebRequest) []string {
+	env := append(os.Environ(),
+		"XQSMEE_ID="+webRequest.GetID(),
+		"XQSMEE_ATTEMPTS="+strconv.FormatInt(webRequest.GetAttempts(), 10),
+		"XQSMEE_HOST="+webRequest.GetHost(),
+		"XQSMEE_METHOD="+webRequest.GetMethod(),
+		"XQSMEE_PATH="+webRequest.GetPath(),
+		"XQSMEE_QUERY="+webRequest.GetRawQuery(),
+		"XQSMEE_REMOTE_ADDR="+webRequest.GetRemoteAddr(),
+	)
+	for _, header := range webRequest.GetHeader() {
+		env = append(env, headerEnvName(header.GetName())+"="+strings.Join(header.GetValue(), ", "))
+	}
+	return env
+}
+
+func (e *executor) deliver(ctx context.Context, webRequest *queue.WebRequest) error {
+	// the command is killed when it runs out of time
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", e.command)
+	cmd.Env = e.env(webRequest)
+	cmd.Stdin = bytes.NewReader(webRequest.GetBody())
+	cmd.Stdout = e.stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		return &retryError{err: err}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_headerEnvName(t *testing.T) {
+	assert.Equal(t, "XQSMEE_HEADER_X_GITHUB_EVENT", headerEnvName("X-GitHub-Event"))
+	assert.Equal(t, "XQSMEE_HEADER_CONTENT_TYPE", headerEnvName("content-type"))
+	assert.Equal(t, "XQSMEE_HEADER_X_2_B", headerEnvName("x.2 b"))
+}
+
+func TestExecutor_deliver(t *testing.T) {
+	webRequest := &queue.WebRequest{
+		ID:   "abc",
+		Body: []byte("hello"),
+		Header: []*queue.Header{
+			{Name: "X-Github-Event", Value: []string{"push"}},
+			{Name: "Accept", Value: []string{"a", "b"}},
+		},
+	}
+
+	t.Run("passes the request to the command", func(t *testing.T) {
+		stdout := new(bytes.Buffer)
+		e := newExecutor(&Config{
+			Exec:   `echo "$XQSMEE_ID $XQSMEE_HEADER_X_GITHUB_EVENT $XQSMEE_HEADER_ACCEPT $(cat)"`,
+			Stdout: stdout,
+		})
+		assert.Nil(t, e.deliver(context.Background(), webRequest))
+		assert.Equal(t, "abc push a, b hello\n", stdout.String())
+	})
+
+	t.Run("retries when the command fails", func(t *testing.T) {
+		e := newExecutor(&Config{Exec: "exit 3", Stdout: new(bytes.Buffer)})
+		assert.IsType(t, &retryError{}, e.deliver(context.Background(), webRequest))
+	})
+
+	t.Run("retries when the command runs out of time", func(t *testing.T) {
+		e := newExecutor(&Config{Exec: "sleep 10", Stdout: os.Stdout, DeliveryTimeout: 50 * time.Millisecond})
+		start := time.Now()
+		assert.IsType(t, &retryError{}, e.deliver(context.Background(), webRequest))
+		assert.True(t, time.Since(start) < 5*time.Second)
+	})
+}
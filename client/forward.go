@@ -0,0 +1,99 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/WillAbides/xqsmee/queue"
+)
+
+// skipHeaders are set by the http client for the new request, so the original values are not copied
+var skipHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Host":              true,
+	"Keep-Alive":        true,
+	"Te":                true,
+	"Trailer":           true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+}
+
+type forwarder struct {
+	target     string
+	httpClient *http.Client
+	stdout     io.Writer
+}
+
+func newForwarder(config *Config) *forwarder {
+	return &forwarder{
+		target:     config.Target,
+		httpClient: &http.Client{Timeout: config.deliveryTimeout()},
+		stdout:     config.Stdout,
+	}
+}
+
+//newHTTPRequest rebuilds the request that xqsmee received so it can be sent to the target. The path after the
+//queue's url is added to the target's path, and the query strings are combined.
+func (f *forwarder) newHTTPRequest(ctx context.Context, webRequest *queue.WebRequest) (*http.Request, error) {
+	target, err := url.Parse(f.target)
+	if err != nil {
+		return nil, err
+	}
+	if webRequest.GetPath() != "" {
+		target.Path = strings.TrimRight(target.Path, "/") + webRequest.GetPath()
+	}
+	switch {
+	case target.RawQuery == "":
+		target.RawQuery = webRequest.GetRawQuery()
+	case webRequest.GetRawQuery() != "":
+		target.RawQuery += "&" + webRequest.GetRawQuery()
+	}
+	method := webRequest.GetMethod()
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequest(method, target.String(), bytes.NewReader(webRequest.GetBody()))
+	if err != nil {
+		return nil, err
+	}
+	for _, header := range webRequest.GetHeader() {
+		name := http.CanonicalHeaderKey(header.GetName())
+		if skipHeaders[name] {
+			continue
+		}
+		for _, value := range header.GetValue() {
+			req.Header.Add(name, value)
+		}
+	}
+	return req.WithContext(ctx), nil
+}
+
+func (f *forwarder) deliver(ctx context.Context, webRequest *queue.WebRequest) error {
+	req, err := f.newHTTPRequest(ctx, webRequest)
+	if err != nil {
+		return err
+	}
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return &retryError{err: err}
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body) //nolint: gas
+		_ = resp.Body.Close()                     //nolint: gas
+	}()
+	_, err = fmt.Fprintf(f.stdout, "%s %s %s\n", req.Method, req.URL, resp.Status)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &retryError{err: fmt.Errorf("%s responded %s", req.URL, resp.Status)}
+	}
+	return nil
+}
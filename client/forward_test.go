@@ -0,0 +1,85 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwarder_deliver(t *testing.T) {
+	webRequest := &queue.WebRequest{
+		Body: []byte("hello"),
+		Host: "example.com",
+		Header: []*queue.Header{
+			{Name: "X-Github-Event", Value: []string{"push"}},
+			{Name: "Accept", Value: []string{"a", "b"}},
+			{Name: "Content-Length", Value: []string{"99"}},
+		},
+	}
+
+	t.Run("sends the request", func(t *testing.T) {
+		var got *http.Request
+		var gotBody []byte
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var err error
+			gotBody, err = ioutil.ReadAll(r.Body)
+			assert.Nil(t, err)
+			got = r
+		}))
+		defer ts.Close()
+		stdout := new(bytes.Buffer)
+		f := newForwarder(&Config{Target: ts.URL + "/webhook", Stdout: stdout})
+		assert.Nil(t, f.deliver(context.Background(), webRequest))
+		require.NotNil(t, got)
+		assert.Equal(t, http.MethodPost, got.Method)
+		assert.Equal(t, "/webhook", got.URL.Path)
+		assert.Equal(t, "hello", string(gotBody))
+		assert.Equal(t, int64(5), got.ContentLength)
+		assert.Equal(t, "push", got.Header.Get("X-Github-Event"))
+		assert.Equal(t, []string{"a", "b"}, got.Header["Accept"])
+		assert.Equal(t, "POST "+ts.URL+"/webhook 200 OK\n", stdout.String())
+	})
+
+	t.Run("keeps the path, query and method", func(t *testing.T) {
+		var got *http.Request
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r
+		}))
+		defer ts.Close()
+		f := newForwarder(&Config{Target: ts.URL + "/webhook/?a=1", Stdout: ioutil.Discard})
+		assert.Nil(t, f.deliver(context.Background(), &queue.WebRequest{
+			Method:   http.MethodPut,
+			Path:     "/github",
+			RawQuery: "b=2",
+		}))
+		require.NotNil(t, got)
+		assert.Equal(t, http.MethodPut, got.Method)
+		assert.Equal(t, "/webhook/github", got.URL.Path)
+		assert.Equal(t, "a=1&b=2", got.URL.RawQuery)
+	})
+
+	t.Run("retries non-2xx responses", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer ts.Close()
+		f := newForwarder(&Config{Target: ts.URL, Stdout: ioutil.Discard})
+		err := f.deliver(context.Background(), webRequest)
+		assert.IsType(t, &retryError{}, err)
+	})
+
+	t.Run("retries unreachable targets", func(t *testing.T) {
+		ts := httptest.NewServer(http.NotFoundHandler())
+		ts.Close()
+		f := newForwarder(&Config{Target: ts.URL, Stdout: ioutil.Discard})
+		err := f.deliver(context.Background(), webRequest)
+		assert.IsType(t, &retryError{}, err)
+	})
+}
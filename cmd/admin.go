@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/WillAbides/xqsmee/client"
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+//nolint: govet
+type adminCmd struct {
+	List   adminListCmd   `cmd help:"list queues"`
+	Stats  adminStatsCmd  `cmd help:"describe a queue"`
+	Purge  adminPurgeCmd  `cmd help:"remove a queue's waiting items"`
+	Delete adminDeleteCmd `cmd help:"remove everything in a queue, including in-flight items and dead letters"`
+}
+
+//nolint: govet
+type adminFlags struct {
+	serverFlags
+	Admintoken string `required help:"the server's admin token" env:"XQSMEE_ADMINTOKEN"`
+}
+
+func (c *adminFlags) clientConfig() *client.Config {
+	cfg := c.serverFlags.clientConfig()
+	cfg.Token = c.Admintoken
+	return cfg
+}
+
+//nolint: govet
+type adminQueueFlags struct {
+	adminFlags
+	Queue string `arg required help:"xqsmee queue name" env:"XQSMEE_QUEUE"`
+}
+
+func (c *adminQueueFlags) clientConfig() *client.Config {
+	cfg := c.adminFlags.clientConfig()
+	cfg.QueueName = c.Queue
+	return cfg
+}
+
+type adminListCmd struct {
+	adminFlags
+}
+
+func (c *adminListCmd) Run() error {
+	queues, err := client.ListQueues(context.Background(), c.clientConfig())
+	if err != nil {
+		return err
+	}
+	return writeStats(os.Stdout, queues...)
+}
+
+type adminStatsCmd struct {
+	adminQueueFlags
+}
+
+func (c *adminStatsCmd) Run() error {
+	stats, err := client.Stats(context.Background(), c.clientConfig())
+	if err != nil {
+		return err
+	}
+	return writeStats(os.Stdout, stats)
+}
+
+type adminPurgeCmd struct {
+	adminQueueFlags
+}
+
+func (c *adminPurgeCmd) Run() error {
+	count, err := client.Purge(context.Background(), c.clientConfig())
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("purged %d requests\n", count)
+	return err
+}
+
+type adminDeleteCmd struct {
+	adminQueueFlags
+}
+
+func (c *adminDeleteCmd) Run() error {
+	err := client.Delete(context.Background(), c.clientConfig())
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("deleted %s\n", c.Queue)
+	return err
+}
+
+// writeStats writes a table of queues
+func writeStats(w io.Writer, queues ...*queue.QueueStats) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, err := fmt.Fprintln(tw, "QUEUE\tDEPTH\tIN FLIGHT\tDEAD\tOLDEST\tNEWEST\tLAST ACTIVITY")
+	if err != nil {
+		return err
+	}
+	for _, stats := range queues {
+		_, err = fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\t%s\n", stats.GetQueueName(), stats.GetDepth(),
+			stats.GetInFlight(), stats.GetDead(), formatTimestamp(stats.GetOldestReceivedAt()),
+			formatTimestamp(stats.GetNewestReceivedAt()), formatTimestamp(stats.GetLastActivity()))
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+func formatTimestamp(ts *timestamp.Timestamp) string {
+	t, err := ptypes.Timestamp(ts)
+	if ts == nil || err != nil {
+		return "-"
+	}
+	return t.Local().Format(time.RFC3339)
+}
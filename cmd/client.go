@@ -2,29 +2,74 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"net/url"
 	"os"
+	"time"
 
 	"github.com/WillAbides/xqsmee/client"
 )
 
 //nolint: govet
-type clientCmd struct {
+type serverFlags struct {
 	Server   string `arg required help:"server ip or dns address" env:"XQSMEE_SERVER"`
-	Queue    string `arg required help:"xqsmee queue to watch" env:"XQSMEE_QUEUE"`
-	Port     int    `default:"9443" short:"p" help:"server grpc port"`
+	Port     int    `default:"8443" short:"p" help:"server grpc port"`
 	Insecure bool   `help:"don't check for valid certificate"`
 	NoTLS    bool   `help:"don't use tls (insecure)"`
-	Ifs      string `default:"\n" help:"record separator"`
+	Cert     string `type:"existingfile" help:"client certificate file" env:"XQSMEE_CERT"`
+	Key      string `type:"existingfile" help:"client certificate key file" env:"XQSMEE_KEY"`
+	Ca       string `type:"existingfile" help:"file of cas to check the server certificate with" env:"XQSMEE_CA"`
+}
+
+func (c *serverFlags) clientConfig() *client.Config {
+	return &client.Config{
+		Host:     c.Server,
+		Port:     c.Port,
+		Insecure: c.Insecure,
+		UseTLS:   !c.NoTLS,
+		CertFile: c.Cert,
+		KeyFile:  c.Key,
+		CAFile:   c.Ca,
+	}
+}
+
+//nolint: govet
+type connectionFlags struct {
+	serverFlags
+	Queue string `arg required help:"xqsmee queue name" env:"XQSMEE_QUEUE"`
+	Token string `help:"consumer token for the queue" env:"XQSMEE_TOKEN"`
+}
+
+func (c *connectionFlags) clientConfig() *client.Config {
+	cfg := c.serverFlags.clientConfig()
+	cfg.QueueName = c.Queue
+	cfg.Token = c.Token
+	return cfg
+}
+
+type clientCmd struct {
+	connectionFlags
+	Ifs            string        `default:"\n" help:"record separator"`
+	Maxoutstanding int64         `default:"10" help:"how many unacked items the server may send ahead"`
+	Target         *url.URL      `help:"forward requests to this url instead of printing them" env:"XQSMEE_TARGET"`
+	Exec           string        `help:"run this shell command for each request with the body on stdin and headers in XQSMEE_HEADER_* variables" env:"XQSMEE_EXEC"` //nolint: lll
+	Retrydelay     time.Duration `default:"1s" help:"how long to wait before retrying a failed delivery"`
+	Timeout        time.Duration `default:"15s" help:"how long forwarding or running --exec may take before the request is retried. Keep it well under the server's --lease."` //nolint: lll
 }
 
 func (c *clientCmd) Run() error {
-	return client.Run(context.Background(), &client.Config{
-		Host:      c.Server,
-		Port:      c.Port,
-		Insecure:  c.Insecure,
-		QueueName: c.Queue,
-		Stdout:    os.Stdout,
-		Separator: c.Ifs,
-		UseTLS:    !c.NoTLS,
-	})
+	if c.Target != nil && c.Exec != "" {
+		return errors.New("--target and --exec can't be used together")
+	}
+	cfg := c.clientConfig()
+	cfg.Stdout = os.Stdout
+	cfg.Separator = c.Ifs
+	cfg.MaxOutstanding = c.Maxoutstanding
+	cfg.RetryDelay = c.Retrydelay
+	cfg.DeliveryTimeout = c.Timeout
+	cfg.Exec = c.Exec
+	if c.Target != nil {
+		cfg.Target = c.Target.String()
+	}
+	return client.Run(context.Background(), cfg)
 }
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/WillAbides/xqsmee/client"
+)
+
+type pushCmd struct {
+	connectionFlags
+}
+
+func (c *pushCmd) Run() error {
+	count, err := client.Push(context.Background(), c.clientConfig(), os.Stdin)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("pushed %d requests\n", count)
+	return err
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/WillAbides/xqsmee/client"
+)
+
+type requeueCmd struct {
+	connectionFlags
+}
+
+func (c *requeueCmd) Run() error {
+	count, err := client.RequeueDead(context.Background(), c.clientConfig())
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("requeued %d dead letters\n", count)
+	return err
+}
@@ -7,6 +7,9 @@ type rootCmd struct {
 	Version versionCmd `cmd help:"show the xqsmee version"`
 	Server  serverCmd  `cmd help:"run a server"`
 	Client  clientCmd  `cmd help:"run the client"`
+	Requeue requeueCmd `cmd help:"move a queue's dead letters back onto the queue"`
+	Push    pushCmd    `cmd help:"add json requests from stdin to a queue"`
+	Admin   adminCmd   `cmd help:"list, describe and clear queues with the server's admin token"`
 }
 
 //Execute executes rootCmd
@@ -2,50 +2,81 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"log"
 	"net/url"
 	"time"
 
+	"github.com/WillAbides/xqsmee/metrics"
+	"github.com/WillAbides/xqsmee/policy"
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/WillAbides/xqsmee/queue/boltqueue"
+	"github.com/WillAbides/xqsmee/queue/memqueue"
 	"github.com/WillAbides/xqsmee/queue/redisqueue"
+	"github.com/WillAbides/xqsmee/queue/streamqueue"
 	"github.com/WillAbides/xqsmee/server"
 	"github.com/gomodule/redigo/redis"
 )
 
 type serverCmd struct {
-	Redisurl     *url.URL `default:"redis://:6379" short:"r" help:"redis url" env:"XQSMEE_REDISURL"`
-	Maxactive    int      `default:"100" help:"max number of active redis connections" env:"XQSMEE_MAXACTIVE"`
-	NoTLS        bool     `help:"don't use tls (serve unencrypted http and grpc)" env:"XQSMEE_NOTLS"`
-	Httpaddr     string   `default:":8443" help:"tcp address for http connections" env:"XQSMEE_HTTPADDR"`
-	Grpcaddr     string   `default:":9443" help:"tcp address for grpc connections" env:"XQSMEE_GRPCADDR"`
-	Redisprefix  string   `default:"xqsmee" help:"prefix for redis keys" env:"XQSMEE_REDISPREFIX"`
-	Tlskey       string   `type:"existingfile" help:"file containing a tls key" env:"XQSMEE_TLSKEY"`
-	Tlscert      string   `type:"existingfile" help:"file containing a tls certificate" env:"XQSMEE_TLSCERT"`
-	Publicurl    string   `default:"https://localhost:8443" help:"the http url that end users will use" env:"XQSMEE_PUBLICURL"` //nolint: lll
-	tlsKeyBlock  []byte
-	tlsCertBlock []byte
+	Backend       string        `default:"redis" enum:"redis,redis-streams,memory,bolt" help:"where to keep queues (redis, redis-streams, memory or bolt)" env:"XQSMEE_BACKEND"`
+	Boltfile      string        `default:"xqsmee.db" help:"database file for the bolt backend" env:"XQSMEE_BOLTFILE"`
+	Redisurl      *url.URL      `default:"redis://:6379" short:"r" help:"redis url" env:"XQSMEE_REDISURL"`
+	Maxactive     int           `default:"100" help:"max number of active redis connections" env:"XQSMEE_MAXACTIVE"`
+	NoTLS         bool          `help:"don't use tls (serve unencrypted http and grpc)" env:"XQSMEE_NOTLS"`
+	Httpaddr      string        `default:":8443" help:"tcp address for http connections" env:"XQSMEE_HTTPADDR"`
+	Grpcaddr      string        `help:"tcp address for grpc connections (grpc shares --httpaddr when empty)" env:"XQSMEE_GRPCADDR"`
+	Redisprefix   string        `default:"xqsmee" help:"prefix for redis keys" env:"XQSMEE_REDISPREFIX"`
+	Lease         time.Duration `default:"30s" help:"how long a popped item is reserved before it is requeued" env:"XQSMEE_LEASE"`
+	Stoptimeout   time.Duration `default:"30s" help:"how long to wait for requests in flight after SIGTERM" env:"XQSMEE_STOPTIMEOUT"`
+	Maxattempts   int64         `default:"0" help:"deliveries before an item is dead-lettered (0 for unlimited)" env:"XQSMEE_MAXATTEMPTS"`
+	Maxage        time.Duration `default:"0" help:"discard items older than this unless their queue's policy sets maxAge (0 keeps them)" env:"XQSMEE_MAXAGE"`
+	Idleexpiry    time.Duration `default:"0" help:"delete queues that go this long without being used (0 keeps them)" env:"XQSMEE_IDLEEXPIRY"`
+	Maxitems      int64         `default:"0" help:"most waiting items a queue holds unless its policy sets maxItems (0 for unlimited)" env:"XQSMEE_MAXITEMS"`
+	Maxbytes      int64         `default:"0" help:"most bytes of waiting items a queue holds unless its policy sets maxBytes (0 for unlimited)" env:"XQSMEE_MAXBYTES"`
+	Overflow      string        `default:"reject" enum:"reject,dropOldest,dropNewest" help:"what to do with webhooks that don't fit in a full queue (reject, dropOldest or dropNewest)" env:"XQSMEE_OVERFLOW"`
+	Maxbody       int64         `default:"10485760" help:"largest webhook body in bytes unless its queue's policy sets maxBodySize" env:"XQSMEE_MAXBODY"`
+	Headertimeout time.Duration `default:"10s" help:"how long to wait for a request's headers" env:"XQSMEE_HEADERTIMEOUT"`
+	Readtimeout   time.Duration `default:"1m" help:"how long to wait for a whole request when grpc has its own --grpcaddr" env:"XQSMEE_READTIMEOUT"`
+	Idsalt        string        `help:"salt for queue id checksums when --idsecret isn't set" env:"XQSMEE_IDSALT"`
+	Idsecret      string        `help:"secret for signing new queue ids" env:"XQSMEE_IDSECRET"`
+	Oldidsecrets  []string      `help:"previous id secrets that are still accepted" env:"XQSMEE_OLDIDSECRETS"`
+	Legacyids     bool          `help:"with --idsecret, keep accepting checksum ids made with --idsalt" env:"XQSMEE_LEGACYIDS"`
+	Tokensecret   string        `help:"secret for signing consumer tokens (tokens aren't checked when empty)" env:"XQSMEE_TOKENSECRET"`
+	Admintoken    string        `help:"token for the admin rpcs (they are refused when empty)" env:"XQSMEE_ADMINTOKEN"`
+	Metrics       bool          `help:"serve prometheus metrics at /metrics (they include queue ids)" env:"XQSMEE_METRICS"`
+	Metricsaddr   string        `help:"serve /metrics unencrypted on this tcp address instead" env:"XQSMEE_METRICSADDR"`
+	Policies      string        `type:"existingfile" help:"json file of queue policies keyed by queue id" env:"XQSMEE_POLICIES"`
+	Tlskey        string        `type:"existingfile" help:"file containing a tls key" env:"XQSMEE_TLSKEY"`
+	Tlscert       string        `type:"existingfile" help:"file containing a tls certificate" env:"XQSMEE_TLSCERT"`
+	Clientca      string        `type:"existingfile" help:"file of cas that grpc client certificates must be signed by (needs --grpcaddr)" env:"XQSMEE_CLIENTCA"` //nolint: lll
+	Publicurl     string        `default:"https://localhost:8443" help:"the http url that end users will use" env:"XQSMEE_PUBLICURL"`          //nolint: lll
+	clientCABlock []byte
 }
 
 func (c *serverCmd) AfterHook() error {
 	if c.NoTLS {
+		if c.Clientca != "" {
+			return errors.New("--clientca can't be used with --no-tls")
+		}
 		return nil
 	}
 	if c.Tlscert == "" || c.Tlskey == "" {
 		return errors.New("you must specify both --tlskey and --tlscert unless --no-tls is set")
 	}
-	var err error
-	c.tlsKeyBlock, err = ioutil.ReadFile(c.Tlskey)
-	if err != nil {
-		return errors.New("failed reading tls key file")
-	}
-	c.tlsCertBlock, err = ioutil.ReadFile(c.Tlscert)
-	if err != nil {
-		return errors.New("failed reading tls certificate file")
+	if c.Clientca != "" {
+		var err error
+		c.clientCABlock, err = ioutil.ReadFile(c.Clientca)
+		if err != nil {
+			return errors.New("failed reading client ca file")
+		}
 	}
 	return nil
 }
 
-func (c *serverCmd) Run() error {
-	redisPool := &redis.Pool{
+func (c *serverCmd) redisPool() *redis.Pool {
+	return &redis.Pool{
 		MaxActive: c.Maxactive,
 		Wait:      true,
 		Dial: func() (redis.Conn, error) {
@@ -56,17 +87,104 @@ func (c *serverCmd) Run() error {
 			return err
 		},
 	}
+}
+
+func (c *serverCmd) redisQueue() *redisqueue.Queue {
+	redisQueue := redisqueue.New(c.Redisprefix, c.redisPool())
+	redisQueue.LeaseDuration = c.Lease
+	redisQueue.MaxAttempts = c.Maxattempts
+	metrics.Default.MustRegister(redisQueue.DepthGauge())
+	return redisQueue
+}
+
+func (c *serverCmd) streamQueue() *streamqueue.Queue {
+	streamQueue := streamqueue.New(c.Redisprefix, c.redisPool())
+	streamQueue.LeaseDuration = c.Lease
+	streamQueue.MaxAttempts = c.Maxattempts
+	return streamQueue
+}
+
+func (c *serverCmd) memQueue() *memqueue.Queue {
+	memQueue := memqueue.New()
+	memQueue.LeaseDuration = c.Lease
+	memQueue.MaxAttempts = c.Maxattempts
+	return memQueue
+}
+
+func (c *serverCmd) boltQueue() (*boltqueue.Queue, error) {
+	boltQueue, err := boltqueue.Open(c.Boltfile)
+	if err != nil {
+		return nil, err
+	}
+	boltQueue.LeaseDuration = c.Lease
+	boltQueue.MaxAttempts = c.Maxattempts
+	return boltQueue, nil
+}
 
-	redisQueue := redisqueue.New(c.Redisprefix, redisPool)
+func (c *serverCmd) Run() error {
+	var q queue.Queue
+	switch c.Backend {
+	case "redis":
+		q = c.redisQueue()
+	case "redis-streams":
+		q = c.streamQueue()
+	case "memory":
+		q = c.memQueue()
+	case "bolt":
+		boltQueue, err := c.boltQueue()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err := boltQueue.Close()
+			if err != nil {
+				log.Println("failed closing bolt database: ", err)
+			}
+		}()
+		q = boltQueue
+	default:
+		return fmt.Errorf("unknown backend %q", c.Backend)
+	}
+
+	var policies policy.Store
+	if c.Policies != "" {
+		var err error
+		policies, err = policy.Load(c.Policies)
+		if err != nil {
+			return err
+		}
+	}
 
 	cfg := &server.Config{
-		Queue:           redisQueue,
-		Httpaddr:        c.Httpaddr,
-		Grpcaddr:        c.Grpcaddr,
-		TLSCertPEMBlock: c.tlsCertBlock,
-		TLSKeyPEMBlock:  c.tlsKeyBlock,
-		UseTLS:          !c.NoTLS,
-		PublicURL:       c.Publicurl,
+		Queue:            q,
+		Httpaddr:         c.Httpaddr,
+		Grpcaddr:         c.Grpcaddr,
+		TLSCertFile:      c.Tlscert,
+		TLSKeyFile:       c.Tlskey,
+		ClientCAPEMBlock: c.clientCABlock,
+		UseTLS:           !c.NoTLS,
+		PublicURL:        c.Publicurl,
+		LeaseDuration:    c.Lease,
+		Policies:         policies,
+		TokenSecret:      c.Tokensecret,
+		AdminToken:       c.Admintoken,
+		MaxAge:           c.Maxage,
+		IdleExpiry:       c.Idleexpiry,
+		Limits: queue.Limits{
+			MaxItems: c.Maxitems,
+			MaxBytes: c.Maxbytes,
+			Overflow: queue.Overflow(c.Overflow),
+		},
+		IDCheckSalt:       c.Idsalt,
+		IDSecret:          c.Idsecret,
+		PreviousIDSecrets: c.Oldidsecrets,
+		AcceptLegacyIDs:   c.Legacyids,
+		ShutdownTimeout:   c.Stoptimeout,
+		MaxBodySize:       c.Maxbody,
+		ReadHeaderTimeout: c.Headertimeout,
+		ReadTimeout:       c.Readtimeout,
+		ServeMetrics:      c.Metrics,
+		MetricsAddr:       c.Metricsaddr,
 	}
 
 	return server.Run(cfg)
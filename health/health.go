@@ -0,0 +1,121 @@
+//Package health serves the grpc health checking protocol for a queue backend
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/WillAbides/xqsmee/queue"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// health.proto is copied from grpc-proto rather than imported from google.golang.org/grpc/health, because the vendored
+// grpc's health package doesn't have Watch.
+
+//go:generate protoc --go_out=plugins=grpc:. health.proto
+
+//QueueService is the service name that reports on the Queue service. The empty name reports on the whole server.
+const QueueService = "Queue"
+
+//DefaultWatchInterval is how often Watch checks the backend when Server.WatchInterval isn't set
+const DefaultWatchInterval = 5 * time.Second
+
+//Server is a HealthServer that checks a queue backend
+type Server struct {
+	//WatchInterval is how often Watch checks the backend
+	WatchInterval time.Duration
+
+	q            queue.Queue
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+}
+
+//NewServer returns a Server for q. Backends that don't implement queue.HealthChecker are always healthy.
+func NewServer(q queue.Queue) *Server {
+	return &Server{q: q, shutdown: make(chan struct{})}
+}
+
+//Shutdown makes every check report NOT_SERVING, so load balancers stop sending traffic while the server stops
+func (s *Server) Shutdown() {
+	s.shutdownOnce.Do(func() {
+		close(s.shutdown)
+	})
+}
+
+//Check implements HealthServer
+func (s *Server) Check(ctx context.Context, request *HealthCheckRequest) (*HealthCheckResponse, error) {
+	if !knownService(request.GetService()) {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", request.GetService())
+	}
+	return &HealthCheckResponse{Status: s.status(ctx)}, nil
+}
+
+//Watch implements HealthServer. It sends the current status, then checks the backend every WatchInterval and sends
+//the status again whenever it changes. Unknown services get SERVICE_UNKNOWN instead of an error, as the protocol asks.
+//On Shutdown the stream gets NOT_SERVING and ends, so it doesn't hold up a graceful stop.
+func (s *Server) Watch(request *HealthCheckRequest, stream Health_WatchServer) error {
+	ctx := stream.Context()
+	if !knownService(request.GetService()) {
+		err := stream.Send(&HealthCheckResponse{Status: HealthCheckResponse_SERVICE_UNKNOWN})
+		if err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-s.shutdown:
+			return nil
+		}
+	}
+	interval := s.WatchInterval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := HealthCheckResponse_UNKNOWN
+	for {
+		current := s.status(ctx)
+		if current != last {
+			err := stream.Send(&HealthCheckResponse{Status: current})
+			if err != nil {
+				return err
+			}
+			last = current
+		}
+		if current == HealthCheckResponse_NOT_SERVING && s.isShutdown() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-s.shutdown:
+		case <-ticker.C:
+		}
+	}
+}
+
+// status checks the backend unless the server is shutting down
+func (s *Server) status(ctx context.Context) HealthCheckResponse_ServingStatus {
+	if s.isShutdown() || queue.CheckHealth(ctx, s.q) != nil {
+		return HealthCheckResponse_NOT_SERVING
+	}
+	return HealthCheckResponse_SERVING
+}
+
+// isShutdown is whether Shutdown has been called
+func (s *Server) isShutdown() bool {
+	select {
+	case <-s.shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// knownService is whether service is one the server reports on
+func knownService(service string) bool {
+	return service == "" || service == QueueService
+}
@@ -0,0 +1,133 @@
+package health
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/WillAbides/xqsmee/queue/memqueue"
+	"github.com/WillAbides/xqsmee/queue/mockqueue"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type checkedQueue struct {
+	queue.Queue
+	*mockqueue.MockHealthChecker
+}
+
+func TestServer_Check(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("serving", func(t *testing.T) {
+		server := NewServer(memqueue.New())
+		for _, service := range []string{"", QueueService} {
+			resp, err := server.Check(ctx, &HealthCheckRequest{Service: service})
+			require.Nil(t, err)
+			assert.Equal(t, HealthCheckResponse_SERVING, resp.GetStatus())
+		}
+	})
+
+	t.Run("backend is down", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		checker := mockqueue.NewMockHealthChecker(ctrl)
+		checker.EXPECT().HealthCheck(gomock.Any()).Return(errors.New("connection refused"))
+		server := NewServer(checkedQueue{Queue: memqueue.New(), MockHealthChecker: checker})
+		resp, err := server.Check(ctx, &HealthCheckRequest{})
+		require.Nil(t, err)
+		assert.Equal(t, HealthCheckResponse_NOT_SERVING, resp.GetStatus())
+	})
+
+	t.Run("shut down", func(t *testing.T) {
+		server := NewServer(memqueue.New())
+		server.Shutdown()
+		resp, err := server.Check(ctx, &HealthCheckRequest{})
+		require.Nil(t, err)
+		assert.Equal(t, HealthCheckResponse_NOT_SERVING, resp.GetStatus())
+	})
+
+	t.Run("unknown service", func(t *testing.T) {
+		server := NewServer(memqueue.New())
+		_, err := server.Check(ctx, &HealthCheckRequest{Service: "Nope"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
+
+// watchStream is a Health_WatchServer that hands what is sent to a channel
+type watchStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan HealthCheckResponse_ServingStatus
+}
+
+func (w *watchStream) Context() context.Context {
+	return w.ctx
+}
+
+func (w *watchStream) Send(resp *HealthCheckResponse) error {
+	w.sent <- resp.GetStatus()
+	return nil
+}
+
+// watch runs server.Watch in the background and returns the stream and a channel with its result
+func watch(ctx context.Context, server *Server, service string) (*watchStream, chan error) {
+	stream := &watchStream{ctx: ctx, sent: make(chan HealthCheckResponse_ServingStatus, 10)}
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Watch(&HealthCheckRequest{Service: service}, stream)
+	}()
+	return stream, done
+}
+
+func TestServer_Watch(t *testing.T) {
+	t.Run("sends changes", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		checker := mockqueue.NewMockHealthChecker(ctrl)
+		gomock.InOrder(
+			checker.EXPECT().HealthCheck(gomock.Any()).Return(nil).Times(2),
+			checker.EXPECT().HealthCheck(gomock.Any()).Return(errors.New("connection refused")),
+			checker.EXPECT().HealthCheck(gomock.Any()).Return(nil).AnyTimes(),
+		)
+		server := NewServer(checkedQueue{Queue: memqueue.New(), MockHealthChecker: checker})
+		server.WatchInterval = time.Millisecond
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, done := watch(ctx, server, QueueService)
+		assert.Equal(t, HealthCheckResponse_SERVING, <-stream.sent)
+		assert.Equal(t, HealthCheckResponse_NOT_SERVING, <-stream.sent)
+		assert.Equal(t, HealthCheckResponse_SERVING, <-stream.sent)
+		cancel()
+		assert.Equal(t, codes.Canceled, status.Code(<-done))
+		assert.Empty(t, stream.sent, "unchanged statuses aren't sent")
+	})
+
+	t.Run("ends on shutdown", func(t *testing.T) {
+		server := NewServer(memqueue.New())
+		stream, done := watch(context.Background(), server, "")
+		assert.Equal(t, HealthCheckResponse_SERVING, <-stream.sent)
+		server.Shutdown()
+		assert.Equal(t, HealthCheckResponse_NOT_SERVING, <-stream.sent)
+		select {
+		case err := <-done:
+			assert.Nil(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("watch didn't end")
+		}
+	})
+
+	t.Run("unknown service", func(t *testing.T) {
+		server := NewServer(memqueue.New())
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, done := watch(ctx, server, "Nope")
+		assert.Equal(t, HealthCheckResponse_SERVICE_UNKNOWN, <-stream.sent)
+		cancel()
+		assert.Equal(t, codes.Canceled, status.Code(<-done))
+	})
+}
@@ -0,0 +1,88 @@
+//Package metrics registers prometheus collectors and serves them
+package metrics
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+//DefaultBuckets are histogram buckets for request durations in seconds
+var DefaultBuckets = prometheus.DefBuckets
+
+//Default is the registry the New* functions register with
+var Default = prometheus.NewRegistry()
+
+//Handler serves the Default registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Default, promhttp.HandlerOpts{
+		ErrorLog:      logger{},
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+}
+
+// logger lets promhttp log with the standard logger
+type logger struct{}
+
+func (logger) Println(v ...interface{}) {
+	log.Println(v...)
+}
+
+//NewCounterVec returns a counter registered with Default
+func NewCounterVec(name, help string, labels ...string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	Default.MustRegister(c)
+	return c
+}
+
+//NewHistogramVec returns a histogram registered with Default
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *prometheus.HistogramVec {
+	h := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)
+	Default.MustRegister(h)
+	return h
+}
+
+//CounterValue returns the current value of one of c's counters
+func CounterValue(c *prometheus.CounterVec, labelValues ...string) float64 {
+	var m dto.Metric
+	err := c.WithLabelValues(labelValues...).Write(&m)
+	if err != nil {
+		return 0
+	}
+	return m.GetCounter().GetValue()
+}
+
+//GaugeFunc is a gauge with one label whose values are read when metrics are collected
+type GaugeFunc struct {
+	desc    *prometheus.Desc
+	collect func() (map[string]float64, error)
+}
+
+//NewGaugeFunc returns a GaugeFunc. It isn't registered, because it usually belongs to something created at runtime.
+//collect returns the gauge's values keyed by the value of label.
+func NewGaugeFunc(name, help, label string, collect func() (map[string]float64, error)) *GaugeFunc {
+	return &GaugeFunc{
+		desc:    prometheus.NewDesc(name, help, []string{label}, nil),
+		collect: collect,
+	}
+}
+
+//Describe implements prometheus.Collector
+func (g *GaugeFunc) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.desc
+}
+
+//Collect implements prometheus.Collector. Failing to collect is logged and leaves the gauge empty.
+func (g *GaugeFunc) Collect(ch chan<- prometheus.Metric) {
+	values, err := g.collect()
+	if err != nil {
+		log.Printf("failed collecting %s: %v", g.desc, err)
+		return
+	}
+	for label, value := range values {
+		ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, value, label)
+	}
+}
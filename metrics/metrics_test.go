@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounterValue(t *testing.T) {
+	c := NewCounterVec("test_counter_total", "counts things", "queue", "code")
+	c.WithLabelValues("b", "OK").Inc()
+	c.WithLabelValues("a", "OK").Add(2)
+	c.WithLabelValues("b", "OK").Inc()
+	assert.Equal(t, float64(2), CounterValue(c, "b", "OK"))
+	assert.Equal(t, float64(0), CounterValue(c, "c", "OK"))
+}
+
+func TestGaugeFunc(t *testing.T) {
+	gather := func(t *testing.T, g *GaugeFunc) map[string]float64 {
+		t.Helper()
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(g)
+		families, err := registry.Gather()
+		require.Nil(t, err)
+		values := map[string]float64{}
+		for _, family := range families {
+			for _, m := range family.GetMetric() {
+				values[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+			}
+		}
+		return values
+	}
+
+	t.Run("works", func(t *testing.T) {
+		g := NewGaugeFunc("test_depth", "items waiting", "queue", func() (map[string]float64, error) {
+			return map[string]float64{"foo": 3, "bar": 0}, nil
+		})
+		assert.Equal(t, map[string]float64{"foo": 3, "bar": 0}, gather(t, g))
+	})
+
+	t.Run("errors leave it empty", func(t *testing.T) {
+		g := NewGaugeFunc("test_depth", "items waiting", "queue", func() (map[string]float64, error) {
+			return nil, errors.New("oops")
+		})
+		assert.Empty(t, gather(t, g))
+	})
+}
+
+func TestHandler(t *testing.T) {
+	c := NewCounterVec("test_handled_total", "counts handled things", "queue")
+	c.WithLabelValues("me").Inc()
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, w.Body.String(), `test_handled_total{queue="me"} 1`)
+}
+
+func TestQueueLabel(t *testing.T) {
+	assert.Equal(t, "abc", QueueLabel("abc"))
+	assert.Equal(t, "abc", QueueLabel("abc/foo"))
+	assert.Equal(t, "abc", QueueLabel("abc:quarantine"))
+
+	labels := &labelSet{max: 3, other: "other"}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, strconv.Itoa(i), labels.label(strconv.Itoa(i)))
+	}
+	assert.Equal(t, "other", labels.label("3"))
+	assert.Equal(t, "1", labels.label("1"), "queues that already have a label keep it")
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+)
+
+//MaxQueues is how many queues get a label of their own. Queues seen after that are all labeled OtherQueues.
+const MaxQueues = 1000
+
+//OtherQueues is the label of queues over MaxQueues
+const OtherQueues = "other"
+
+var queueLabels = &labelSet{max: MaxQueues, other: OtherQueues}
+
+//QueueLabel returns the label for metrics about queueName. That is the queue's id, without a sub-queue like "/foo"
+//or ":quarantine", so that callers can't make up new time series by picking new sub-queues.
+func QueueLabel(queueName string) string {
+	if i := strings.IndexAny(queueName, "/:"); i >= 0 {
+		queueName = queueName[:i]
+	}
+	return queueLabels.label(queueName)
+}
+
+// labelSet hands out up to max label values and other after that
+type labelSet struct {
+	mu     sync.Mutex
+	max    int
+	other  string
+	values map[string]bool
+}
+
+func (s *labelSet) label(value string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values[value] {
+		return value
+	}
+	if len(s.values) >= s.max {
+		return s.other
+	}
+	if s.values == nil {
+		s.values = map[string]bool{}
+	}
+	s.values[value] = true
+	return value
+}
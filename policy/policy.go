@@ -0,0 +1,200 @@
+//Package policy holds the server-side settings for individual queues
+package policy
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/pkg/errors"
+)
+
+//Policy is the configuration for one queue
+type Policy struct {
+	//Verification checks the signature on requests before they are queued
+	Verification *Verification `json:"verification,omitempty"`
+
+	//Clients are the subject common names of client certificates that may consume the queue over grpc
+	Clients []string `json:"clients,omitempty"`
+
+	//MaxAge is how long items are kept before they are discarded. It overrides the server's default.
+	MaxAge Duration `json:"maxAge,omitempty"`
+
+	//MaxItems, MaxBytes and Overflow limit the waiting items in the queue. Each overrides the server's default when set.
+	MaxItems int64          `json:"maxItems,omitempty"`
+	MaxBytes int64          `json:"maxBytes,omitempty"`
+	Overflow queue.Overflow `json:"overflow,omitempty"`
+
+	//MaxBodySize is the largest webhook body in bytes that the queue accepts. It overrides the server's default.
+	MaxBodySize int64 `json:"maxBodySize,omitempty"`
+
+	//Response is how the queue answers webhook senders. Without it, queued requests get an empty 200.
+	Response *Response `json:"response,omitempty"`
+}
+
+//GetVerification returns p's verification, or nil when p is nil
+func (p *Policy) GetVerification() *Verification {
+	if p == nil {
+		return nil
+	}
+	return p.Verification
+}
+
+//GetResponse returns p's response, or nil when p is nil
+func (p *Policy) GetResponse() *Response {
+	if p == nil {
+		return nil
+	}
+	return p.Response
+}
+
+//GetMaxAge returns p's max age, or zero when p is nil or doesn't set one
+func (p *Policy) GetMaxAge() time.Duration {
+	if p == nil {
+		return 0
+	}
+	return time.Duration(p.MaxAge)
+}
+
+//GetMaxBodySize returns p's max body size, or zero when p is nil or doesn't set one
+func (p *Policy) GetMaxBodySize() int64 {
+	if p == nil {
+		return 0
+	}
+	return p.MaxBodySize
+}
+
+//Limits returns defaults with the limits p sets replaced
+func (p *Policy) Limits(defaults queue.Limits) queue.Limits {
+	if p == nil {
+		return defaults
+	}
+	if p.MaxItems > 0 {
+		defaults.MaxItems = p.MaxItems
+	}
+	if p.MaxBytes > 0 {
+		defaults.MaxBytes = p.MaxBytes
+	}
+	if p.Overflow != "" {
+		defaults.Overflow = p.Overflow
+	}
+	return defaults
+}
+
+//AllowsClient reports whether a client certificate with the given subject common name may consume the queue
+func (p *Policy) AllowsClient(commonName string) bool {
+	if p == nil || commonName == "" {
+		return false
+	}
+	for _, client := range p.Clients {
+		if client == commonName {
+			return true
+		}
+	}
+	return false
+}
+
+//Store looks up queue policies
+type Store interface {
+	//Policy returns the policy for a queue id, or nil when the queue doesn't have one
+	Policy(queueID string) *Policy
+}
+
+//Static is a Store that never changes
+type Static map[string]*Policy
+
+//Policy returns the policy for a queue id
+func (s Static) Policy(queueID string) *Policy {
+	return s[queueID]
+}
+
+//Any reports whether fn is true for any of s's policies
+func (s Static) Any(fn func(*Policy) bool) bool {
+	for _, p := range s {
+		if fn(p) {
+			return true
+		}
+	}
+	return false
+}
+
+//Load reads a json file of policies keyed by queue id
+func Load(filename string) (Static, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed opening policy file")
+	}
+	defer closeOrLog(f)
+	policies := Static{}
+	err = json.NewDecoder(f).Decode(&policies)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed decoding policy file")
+	}
+	for queueID, p := range policies {
+		err = p.validate()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid policy for %s", queueID)
+		}
+	}
+	return policies, nil
+}
+
+func (p *Policy) validate() error {
+	if p == nil {
+		return errors.New("policy is empty")
+	}
+	if p.MaxAge < 0 {
+		return errors.New("maxAge can't be negative")
+	}
+	if p.MaxItems < 0 || p.MaxBytes < 0 {
+		return errors.New("maxItems and maxBytes can't be negative")
+	}
+	if p.MaxBodySize < 0 {
+		return errors.New("maxBodySize can't be negative")
+	}
+	if !p.Overflow.Valid() {
+		return errors.Errorf("unknown overflow %q", p.Overflow)
+	}
+	if p.Response != nil {
+		err := p.Response.validate()
+		if err != nil {
+			return err
+		}
+	}
+	if p.Verification != nil {
+		return p.Verification.validate()
+	}
+	return nil
+}
+
+//Duration is a time.Duration written as a string like "5m" in json
+type Duration time.Duration
+
+//UnmarshalJSON parses a duration string
+func (d *Duration) UnmarshalJSON(src []byte) error {
+	var s string
+	err := json.Unmarshal(src, &s)
+	if err != nil {
+		return errors.Wrap(err, "duration must be a string")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+//MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func closeOrLog(f *os.File) {
+	err := f.Close()
+	if err != nil {
+		log.Println("failed to close: ", err)
+	}
+}
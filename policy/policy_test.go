@@ -0,0 +1,133 @@
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "policy")
+	require.Nil(t, err)
+	filename := filepath.Join(dir, "policies.json")
+	require.Nil(t, ioutil.WriteFile(filename, []byte(content), 0600))
+	return filename
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("works", func(t *testing.T) {
+		filename := writeFile(t, `{
+  "abc": {"verification": {"scheme": "stripe", "secret": "shhh", "tolerance": "10m", "quarantine": true}}
+}`)
+		defer os.RemoveAll(filepath.Dir(filename)) //nolint: errcheck
+		policies, err := Load(filename)
+		require.Nil(t, err)
+		assert.Equal(t, &Verification{
+			Scheme:     SchemeStripe,
+			Secret:     "shhh",
+			Tolerance:  Duration(10 * time.Minute),
+			Quarantine: true,
+		}, policies.Policy("abc").GetVerification())
+		assert.Nil(t, policies.Policy("def"))
+		assert.Nil(t, policies.Policy("def").GetVerification())
+	})
+
+	t.Run("rejects invalid policies", func(t *testing.T) {
+		filename := writeFile(t, `{"abc": {"verification": {"scheme": "nope", "secret": "shhh"}}}`)
+		defer os.RemoveAll(filepath.Dir(filename)) //nolint: errcheck
+		_, err := Load(filename)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("rejects bad durations", func(t *testing.T) {
+		filename := writeFile(t, `{"abc": {"verification": {"scheme": "slack", "secret": "s", "tolerance": "soon"}}}`)
+		defer os.RemoveAll(filepath.Dir(filename)) //nolint: errcheck
+		_, err := Load(filename)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestPolicy_GetMaxAge(t *testing.T) {
+	filename := writeFile(t, `{"abc": {"maxAge": "72h"}, "def": {"maxAge": "-1h"}}`)
+	defer os.RemoveAll(filepath.Dir(filename)) //nolint: errcheck
+	_, err := Load(filename)
+	assert.NotNil(t, err, "negative max ages are invalid")
+
+	filename = writeFile(t, `{"abc": {"maxAge": "72h"}}`)
+	defer os.RemoveAll(filepath.Dir(filename)) //nolint: errcheck
+	policies, err := Load(filename)
+	require.Nil(t, err)
+	assert.Equal(t, 72*time.Hour, policies.Policy("abc").GetMaxAge())
+	assert.Equal(t, time.Duration(0), policies.Policy("def").GetMaxAge())
+}
+
+func TestStatic_Any(t *testing.T) {
+	policies := Static{"abc": {MaxItems: 10}, "def": nil}
+	assert.True(t, policies.Any(func(p *Policy) bool { return p.Limits(queue.Limits{}).MaxItems == 10 }))
+	assert.False(t, policies.Any(func(p *Policy) bool { return p.GetMaxAge() > 0 }))
+}
+
+func TestPolicy_Limits(t *testing.T) {
+	for _, invalid := range []string{`{"maxItems": -1}`, `{"maxBytes": -1}`, `{"overflow": "dropMiddle"}`} {
+		filename := writeFile(t, `{"abc": `+invalid+`}`)
+		defer os.RemoveAll(filepath.Dir(filename)) //nolint: errcheck
+		_, err := Load(filename)
+		assert.NotNil(t, err, invalid)
+	}
+
+	filename := writeFile(t, `{"abc": {"maxItems": 10, "overflow": "dropOldest"}}`)
+	defer os.RemoveAll(filepath.Dir(filename)) //nolint: errcheck
+	policies, err := Load(filename)
+	require.Nil(t, err)
+	defaults := queue.Limits{MaxItems: 100, MaxBytes: 1000}
+	assert.Equal(t, queue.Limits{MaxItems: 10, MaxBytes: 1000, Overflow: queue.OverflowDropOldest},
+		policies.Policy("abc").Limits(defaults))
+	assert.Equal(t, defaults, policies.Policy("def").Limits(defaults))
+}
+
+func TestPolicy_GetMaxBodySize(t *testing.T) {
+	filename := writeFile(t, `{"abc": {"maxBodySize": -1}}`)
+	defer os.RemoveAll(filepath.Dir(filename)) //nolint: errcheck
+	_, err := Load(filename)
+	assert.NotNil(t, err, "negative max body sizes are invalid")
+
+	filename = writeFile(t, `{"abc": {"maxBodySize": 1024}}`)
+	defer os.RemoveAll(filepath.Dir(filename)) //nolint: errcheck
+	policies, err := Load(filename)
+	require.Nil(t, err)
+	assert.Equal(t, int64(1024), policies.Policy("abc").GetMaxBodySize())
+	assert.Equal(t, int64(0), policies.Policy("def").GetMaxBodySize())
+}
+
+func TestPolicy_GetResponse(t *testing.T) {
+	filename := writeFile(t, `{"abc": {"response": {"handshakes": [{"provider": "meta"}]}}}`)
+	defer os.RemoveAll(filepath.Dir(filename)) //nolint: errcheck
+	_, err := Load(filename)
+	assert.NotNil(t, err, "invalid responses are rejected")
+
+	filename = writeFile(t, `{"abc": {"response": {"status": 202, "body": "ok", "handshakes": [{"provider": "slack"}]}}}`)
+	defer os.RemoveAll(filepath.Dir(filename)) //nolint: errcheck
+	policies, err := Load(filename)
+	require.Nil(t, err)
+	assert.Equal(t, &Response{
+		Status:     202,
+		Body:       "ok",
+		Handshakes: []*Handshake{{Provider: HandshakeSlack}},
+	}, policies.Policy("abc").GetResponse())
+	assert.Nil(t, policies.Policy("def").GetResponse())
+}
+
+func TestPolicy_AllowsClient(t *testing.T) {
+	p := &Policy{Clients: []string{"worker", "backup"}}
+	assert.True(t, p.AllowsClient("backup"))
+	assert.False(t, p.AllowsClient("intruder"))
+	assert.False(t, p.AllowsClient(""))
+	assert.False(t, (*Policy)(nil).AllowsClient("worker"))
+}
@@ -0,0 +1,158 @@
+package policy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+//Handshake providers
+const (
+	//HandshakeSlack answers Slack's url_verification events with their challenge
+	HandshakeSlack = "slack"
+	//HandshakeMeta answers Meta's hub.challenge GET requests when hub.verify_token is VerifyToken
+	HandshakeMeta = "meta"
+	//HandshakeTwitter answers Twitter's crc_token GET requests with an HMAC of the token made with Secret
+	HandshakeTwitter = "twitter"
+	//HandshakeMicrosoftGraph answers Microsoft Graph's validationToken requests with the token
+	HandshakeMicrosoftGraph = "msgraph"
+)
+
+//Response is how a queue answers webhook senders
+type Response struct {
+	//Status is the status for queued requests. Defaults to 200.
+	Status int `json:"status,omitempty"`
+	//Headers are set on the response to queued requests
+	Headers map[string]string `json:"headers,omitempty"`
+	//Body is the body of the response to queued requests
+	Body string `json:"body,omitempty"`
+	//Handshakes answer providers' endpoint verification requests instead of queueing them
+	Handshakes []*Handshake `json:"handshakes,omitempty"`
+}
+
+//Handshake answers one provider's endpoint verification requests
+type Handshake struct {
+	//Provider is one of slack, meta, twitter or msgraph
+	Provider string `json:"provider"`
+	//VerifyToken is the token Meta sends in hub.verify_token
+	VerifyToken string `json:"verifyToken,omitempty"`
+	//Secret is the consumer secret for twitter
+	Secret string `json:"secret,omitempty"`
+}
+
+func (r *Response) validate() error {
+	if r.Status != 0 && (r.Status < 200 || r.Status > 599) {
+		return errors.Errorf("invalid response status %d", r.Status)
+	}
+	for _, h := range r.Handshakes {
+		if h == nil {
+			return errors.New("handshake is empty")
+		}
+		err := h.validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Handshake) validate() error {
+	switch h.Provider {
+	case HandshakeSlack, HandshakeMicrosoftGraph:
+	case HandshakeMeta:
+		if h.VerifyToken == "" {
+			return errors.New("meta handshake needs a verifyToken")
+		}
+	case HandshakeTwitter:
+		if h.Secret == "" {
+			return errors.New("twitter handshake needs a secret")
+		}
+	default:
+		return errors.Errorf("unknown handshake provider %q", h.Provider)
+	}
+	return nil
+}
+
+//GetStatus returns r's status, or 200 when r is nil or doesn't set one
+func (r *Response) GetStatus() int {
+	if r == nil || r.Status == 0 {
+		return http.StatusOK
+	}
+	return r.Status
+}
+
+//Handshake returns the answer to a provider's verification request, or nil when req isn't one of r's handshakes.
+//body is req's body, which has already been read.
+func (r *Response) Handshake(req *http.Request, body []byte) *Response {
+	if r == nil {
+		return nil
+	}
+	for _, h := range r.Handshakes {
+		if answer := h.answer(req, body); answer != nil {
+			return answer
+		}
+	}
+	return nil
+}
+
+func textResponse(body string) *Response {
+	return &Response{
+		Headers: map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+		Body:    body,
+	}
+}
+
+func (h *Handshake) answer(req *http.Request, body []byte) *Response {
+	query := req.URL.Query()
+	switch h.Provider {
+	case HandshakeSlack:
+		if req.Method != http.MethodPost {
+			return nil
+		}
+		var event struct {
+			Type      string `json:"type"`
+			Challenge string `json:"challenge"`
+		}
+		if json.Unmarshal(body, &event) != nil || event.Type != "url_verification" {
+			return nil
+		}
+		return textResponse(event.Challenge)
+	case HandshakeMeta:
+		if req.Method != http.MethodGet || query.Get("hub.mode") != "subscribe" || query.Get("hub.challenge") == "" {
+			return nil
+		}
+		if subtle.ConstantTimeCompare([]byte(query.Get("hub.verify_token")), []byte(h.VerifyToken)) != 1 {
+			return &Response{Status: http.StatusForbidden}
+		}
+		return textResponse(query.Get("hub.challenge"))
+	case HandshakeTwitter:
+		token := query.Get("crc_token")
+		if req.Method != http.MethodGet || token == "" {
+			return nil
+		}
+		mac := hmac.New(sha256.New, []byte(h.Secret))
+		mac.Write([]byte(token)) //nolint: errcheck
+		responseToken, err := json.Marshal(map[string]string{
+			"response_token": "sha256=" + base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+		})
+		if err != nil {
+			return nil
+		}
+		return &Response{
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body:    string(responseToken),
+		}
+	case HandshakeMicrosoftGraph:
+		token := query.Get("validationToken")
+		if req.Method != http.MethodPost || token == "" {
+			return nil
+		}
+		return textResponse(token)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequest(t *testing.T, method, url string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	require.Nil(t, err)
+	return req
+}
+
+func TestResponse_Handshake(t *testing.T) {
+	response := &Response{
+		Handshakes: []*Handshake{
+			{Provider: HandshakeSlack},
+			{Provider: HandshakeMeta, VerifyToken: "letmein"},
+			{Provider: HandshakeTwitter, Secret: testSecret},
+			{Provider: HandshakeMicrosoftGraph},
+		},
+	}
+
+	t.Run("slack", func(t *testing.T) {
+		body := []byte(`{"token":"x","challenge":"abc123","type":"url_verification"}`)
+		answer := response.Handshake(newRequest(t, http.MethodPost, "/q/foo"), body)
+		require.NotNil(t, answer)
+		assert.Equal(t, http.StatusOK, answer.GetStatus())
+		assert.Equal(t, "abc123", answer.Body)
+
+		body = []byte(`{"type":"event_callback","event":{}}`)
+		assert.Nil(t, response.Handshake(newRequest(t, http.MethodPost, "/q/foo"), body))
+	})
+
+	t.Run("meta", func(t *testing.T) {
+		url := "/q/foo?hub.mode=subscribe&hub.challenge=1158201444&hub.verify_token="
+		answer := response.Handshake(newRequest(t, http.MethodGet, url+"letmein"), nil)
+		require.NotNil(t, answer)
+		assert.Equal(t, http.StatusOK, answer.GetStatus())
+		assert.Equal(t, "1158201444", answer.Body)
+
+		answer = response.Handshake(newRequest(t, http.MethodGet, url+"nope"), nil)
+		require.NotNil(t, answer)
+		assert.Equal(t, http.StatusForbidden, answer.GetStatus())
+
+		assert.Nil(t, response.Handshake(newRequest(t, http.MethodGet, "/q/foo"), nil))
+	})
+
+	t.Run("twitter", func(t *testing.T) {
+		answer := response.Handshake(newRequest(t, http.MethodGet, "/q/foo?crc_token=abc&nonce=1"), nil)
+		require.NotNil(t, answer)
+		expected := "sha256=" + base64.StdEncoding.EncodeToString(sign(sha256.New, "abc"))
+		assert.JSONEq(t, `{"response_token":"`+expected+`"}`, answer.Body)
+		assert.Equal(t, "application/json", answer.Headers["Content-Type"])
+	})
+
+	t.Run("microsoft graph", func(t *testing.T) {
+		answer := response.Handshake(newRequest(t, http.MethodPost, "/q/foo?validationToken=Validation%3A+Testing"), nil)
+		require.NotNil(t, answer)
+		assert.Equal(t, "Validation: Testing", answer.Body)
+		assert.True(t, strings.HasPrefix(answer.Headers["Content-Type"], "text/plain"))
+	})
+
+	t.Run("only answers the right method", func(t *testing.T) {
+		assert.Nil(t, response.Handshake(newRequest(t, http.MethodPost, "/q/foo?crc_token=abc"), nil))
+		assert.Nil(t, response.Handshake(newRequest(t, http.MethodGet, "/q/foo?validationToken=abc"), nil))
+	})
+
+	t.Run("only answers configured providers", func(t *testing.T) {
+		slackOnly := &Response{Handshakes: []*Handshake{{Provider: HandshakeSlack}}}
+		assert.Nil(t, slackOnly.Handshake(newRequest(t, http.MethodPost, "/q/foo?validationToken=abc"), nil))
+		var empty *Response
+		assert.Nil(t, empty.Handshake(newRequest(t, http.MethodPost, "/q/foo?validationToken=abc"), nil))
+		assert.Equal(t, http.StatusOK, empty.GetStatus())
+	})
+}
+
+func TestResponse_validate(t *testing.T) {
+	for _, invalid := range []*Response{
+		{Status: 99},
+		{Status: 600},
+		{Handshakes: []*Handshake{nil}},
+		{Handshakes: []*Handshake{{Provider: "myspace"}}},
+		{Handshakes: []*Handshake{{Provider: HandshakeMeta}}},
+		{Handshakes: []*Handshake{{Provider: HandshakeTwitter}}},
+	} {
+		assert.NotNil(t, invalid.validate(), "%+v", invalid)
+	}
+	assert.Nil(t, (&Response{Status: http.StatusAccepted, Body: "thanks"}).validate())
+}
@@ -0,0 +1,237 @@
+package policy
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint: gas
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//Verification schemes
+const (
+	//SchemeGitHub checks GitHub's X-Hub-Signature-256 header
+	SchemeGitHub = "github"
+	//SchemeStripe checks Stripe's Stripe-Signature header
+	SchemeStripe = "stripe"
+	//SchemeSlack checks Slack's X-Slack-Signature and X-Slack-Request-Timestamp headers
+	SchemeSlack = "slack"
+	//SchemeHMAC checks an HMAC of the body in any header
+	SchemeHMAC = "hmac"
+)
+
+//DefaultTolerance is how far a signed timestamp may be from now when Verification.Tolerance is zero
+const DefaultTolerance = 5 * time.Minute
+
+//DefaultHMACHeader is the header SchemeHMAC reads when Verification.Header is empty
+const DefaultHMACHeader = "X-Signature"
+
+//ErrInvalidSignature is the cause of every error returned by Verification.Verify
+var ErrInvalidSignature = errors.New("invalid signature")
+
+//Verification is how a queue checks that requests were signed by the sender
+type Verification struct {
+	//Scheme is one of github, stripe, slack or hmac
+	Scheme string `json:"scheme"`
+	//Secret is the shared signing secret
+	Secret string `json:"secret"`
+	//Header is the header with the signature for the hmac scheme. Defaults to DefaultHMACHeader.
+	Header string `json:"header,omitempty"`
+	//Algorithm is sha1, sha256 or sha512 for the hmac scheme. Defaults to sha256.
+	Algorithm string `json:"algorithm,omitempty"`
+	//Encoding is hex or base64 for the hmac scheme. Defaults to hex.
+	Encoding string `json:"encoding,omitempty"`
+	//Prefix is removed from the header before decoding it for the hmac scheme, for example "sha256="
+	Prefix string `json:"prefix,omitempty"`
+	//Tolerance is how old a signature may be for the stripe and slack schemes. Defaults to DefaultTolerance.
+	Tolerance Duration `json:"tolerance,omitempty"`
+	//Quarantine sends requests that fail verification to the quarantine queue instead of rejecting them
+	Quarantine bool `json:"quarantine,omitempty"`
+}
+
+//QuarantineQueue is the name of the queue that holds queueName's requests that failed verification
+func QuarantineQueue(queueName string) string {
+	return queueName + ":quarantine"
+}
+
+func (v *Verification) validate() error {
+	if v.Secret == "" {
+		return errors.New("verification secret is empty")
+	}
+	switch v.Scheme {
+	case SchemeGitHub, SchemeStripe, SchemeSlack:
+		return nil
+	case SchemeHMAC:
+	default:
+		return errors.Errorf("unknown verification scheme %q", v.Scheme)
+	}
+	if _, err := v.hashFunc(); err != nil {
+		return err
+	}
+	switch v.Encoding {
+	case "", "hex", "base64":
+		return nil
+	default:
+		return errors.Errorf("unknown signature encoding %q", v.Encoding)
+	}
+}
+
+//Verify returns an error when body and header weren't signed with the secret
+func (v *Verification) Verify(header http.Header, body []byte, now time.Time) error {
+	switch v.Scheme {
+	case SchemeGitHub:
+		return v.verifyGitHub(header, body)
+	case SchemeStripe:
+		return v.verifyStripe(header, body, now)
+	case SchemeSlack:
+		return v.verifySlack(header, body, now)
+	case SchemeHMAC:
+		return v.verifyHMAC(header, body)
+	default:
+		return errors.Wrapf(ErrInvalidSignature, "unknown verification scheme %q", v.Scheme)
+	}
+}
+
+func (v *Verification) sum(newHash func() hash.Hash, parts ...[]byte) []byte {
+	mac := hmac.New(newHash, []byte(v.Secret))
+	for _, part := range parts {
+		mac.Write(part) //nolint: errcheck
+	}
+	return mac.Sum(nil)
+}
+
+// equalHex compares a hex encoded signature to an expected sum in constant time
+func equalHex(signature string, expected []byte) bool {
+	decoded, err := hex.DecodeString(signature)
+	return err == nil && hmac.Equal(decoded, expected)
+}
+
+func (v *Verification) tolerance() time.Duration {
+	if v.Tolerance > 0 {
+		return time.Duration(v.Tolerance)
+	}
+	return DefaultTolerance
+}
+
+// checkTimestamp makes sure a unix timestamp from a signature is close enough to now
+func (v *Verification) checkTimestamp(timestamp string, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.Wrap(ErrInvalidSignature, "bad timestamp")
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age < 0 {
+		age = -age
+	}
+	if age > v.tolerance() {
+		return errors.Wrap(ErrInvalidSignature, "timestamp is outside the tolerance")
+	}
+	return nil
+}
+
+func (v *Verification) verifyGitHub(header http.Header, body []byte) error {
+	signature := header.Get("X-Hub-Signature-256")
+	if !strings.HasPrefix(signature, "sha256=") {
+		return errors.Wrap(ErrInvalidSignature, "missing X-Hub-Signature-256")
+	}
+	if !equalHex(strings.TrimPrefix(signature, "sha256="), v.sum(sha256.New, body)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (v *Verification) verifyStripe(header http.Header, body []byte, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			signatures = append(signatures, kv[1])
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return errors.Wrap(ErrInvalidSignature, "missing Stripe-Signature")
+	}
+	err := v.checkTimestamp(timestamp, now)
+	if err != nil {
+		return err
+	}
+	expected := v.sum(sha256.New, []byte(timestamp+"."), body)
+	for _, signature := range signatures {
+		if equalHex(signature, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func (v *Verification) verifySlack(header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	signature := header.Get("X-Slack-Signature")
+	if timestamp == "" || !strings.HasPrefix(signature, "v0=") {
+		return errors.Wrap(ErrInvalidSignature, "missing X-Slack-Signature or X-Slack-Request-Timestamp")
+	}
+	err := v.checkTimestamp(timestamp, now)
+	if err != nil {
+		return err
+	}
+	if !equalHex(strings.TrimPrefix(signature, "v0="), v.sum(sha256.New, []byte("v0:"+timestamp+":"), body)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (v *Verification) hashFunc() (func() hash.Hash, error) {
+	switch v.Algorithm {
+	case "sha1":
+		return sha1.New, nil
+	case "", "sha256":
+		return sha256.New, nil
+	case "sha512":
+		return sha512.New, nil
+	default:
+		return nil, errors.Errorf("unknown hmac algorithm %q", v.Algorithm)
+	}
+}
+
+func (v *Verification) verifyHMAC(header http.Header, body []byte) error {
+	name := v.Header
+	if name == "" {
+		name = DefaultHMACHeader
+	}
+	signature := header.Get(name)
+	if signature == "" || !strings.HasPrefix(signature, v.Prefix) {
+		return errors.Wrapf(ErrInvalidSignature, "missing %s", name)
+	}
+	signature = strings.TrimPrefix(signature, v.Prefix)
+	newHash, err := v.hashFunc()
+	if err != nil {
+		return errors.Wrap(ErrInvalidSignature, err.Error())
+	}
+	expected := v.sum(newHash, body)
+	if v.Encoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(signature)
+		if err != nil || !hmac.Equal(decoded, expected) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	if !equalHex(signature, expected) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package policy
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint: gas
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "shhh"
+
+var testBody = []byte(`{"hello":"world"}`)
+
+func sign(newHash func() hash.Hash, parts ...string) []byte {
+	mac := hmac.New(newHash, []byte(testSecret))
+	for _, part := range parts {
+		mac.Write([]byte(part)) //nolint: errcheck
+	}
+	return mac.Sum(nil)
+}
+
+func signHex(parts ...string) string {
+	return hex.EncodeToString(sign(sha256.New, parts...))
+}
+
+func assertInvalid(t *testing.T, err error) {
+	t.Helper()
+	assert.Equal(t, ErrInvalidSignature, errors.Cause(err))
+}
+
+func TestVerification_Verify(t *testing.T) {
+	now := time.Now()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	old := strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)
+
+	t.Run("github", func(t *testing.T) {
+		v := &Verification{Scheme: SchemeGitHub, Secret: testSecret}
+		header := http.Header{}
+		header.Set("X-Hub-Signature-256", "sha256="+signHex(string(testBody)))
+		assert.Nil(t, v.Verify(header, testBody, now))
+		assertInvalid(t, v.Verify(header, []byte("tampered"), now))
+		assertInvalid(t, v.Verify(http.Header{}, testBody, now))
+	})
+
+	t.Run("stripe", func(t *testing.T) {
+		v := &Verification{Scheme: SchemeStripe, Secret: testSecret}
+		header := http.Header{}
+		header.Set("Stripe-Signature", "t="+timestamp+",v1=deadbeef,v1="+signHex(timestamp, ".", string(testBody)))
+		assert.Nil(t, v.Verify(header, testBody, now))
+		assertInvalid(t, v.Verify(header, []byte("tampered"), now))
+
+		header.Set("Stripe-Signature", "t="+old+",v1="+signHex(old, ".", string(testBody)))
+		assertInvalid(t, v.Verify(header, testBody, now))
+		v.Tolerance = Duration(2 * time.Hour)
+		assert.Nil(t, v.Verify(header, testBody, now))
+
+		assertInvalid(t, v.Verify(http.Header{}, testBody, now))
+	})
+
+	t.Run("slack", func(t *testing.T) {
+		v := &Verification{Scheme: SchemeSlack, Secret: testSecret}
+		header := http.Header{}
+		header.Set("X-Slack-Request-Timestamp", timestamp)
+		header.Set("X-Slack-Signature", "v0="+signHex("v0:", timestamp, ":", string(testBody)))
+		assert.Nil(t, v.Verify(header, testBody, now))
+		assertInvalid(t, v.Verify(header, []byte("tampered"), now))
+
+		header.Set("X-Slack-Request-Timestamp", old)
+		header.Set("X-Slack-Signature", "v0="+signHex("v0:", old, ":", string(testBody)))
+		assertInvalid(t, v.Verify(header, testBody, now))
+	})
+
+	t.Run("hmac", func(t *testing.T) {
+		v := &Verification{Scheme: SchemeHMAC, Secret: testSecret}
+		header := http.Header{}
+		header.Set(DefaultHMACHeader, signHex(string(testBody)))
+		assert.Nil(t, v.Verify(header, testBody, now))
+		assertInvalid(t, v.Verify(header, []byte("tampered"), now))
+		assertInvalid(t, v.Verify(http.Header{}, testBody, now))
+	})
+
+	t.Run("hmac with options", func(t *testing.T) {
+		v := &Verification{
+			Scheme:    SchemeHMAC,
+			Secret:    testSecret,
+			Header:    "X-Custom",
+			Algorithm: "sha1",
+			Encoding:  "base64",
+			Prefix:    "sha1=",
+		}
+		header := http.Header{}
+		header.Set("X-Custom", "sha1="+base64.StdEncoding.EncodeToString(sign(sha1.New, string(testBody))))
+		assert.Nil(t, v.Verify(header, testBody, now))
+		header.Set("X-Custom", base64.StdEncoding.EncodeToString(sign(sha1.New, string(testBody))))
+		assertInvalid(t, v.Verify(header, testBody, now))
+	})
+}
+
+func TestVerification_validate(t *testing.T) {
+	for _, v := range []*Verification{
+		{Scheme: SchemeGitHub},
+		{Scheme: "nope", Secret: testSecret},
+		{Scheme: SchemeHMAC, Secret: testSecret, Algorithm: "md5"},
+		{Scheme: SchemeHMAC, Secret: testSecret, Encoding: "base32"},
+	} {
+		assert.NotNil(t, v.validate(), "%+v", v)
+	}
+	assert.Nil(t, (&Verification{Scheme: SchemeSlack, Secret: testSecret}).validate())
+}
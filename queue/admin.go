@@ -0,0 +1,93 @@
+package queue
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errNoAdmin = status.Error(codes.Unimplemented, "this backend doesn't support admin rpcs")
+
+//AdminHandler handles Admin grpc requests
+type AdminHandler struct {
+	q Queue
+}
+
+//NewAdminHandler returns a new AdminHandler. Its rpcs return Unimplemented when q isn't an Administrator.
+func NewAdminHandler(q Queue) *AdminHandler {
+	return &AdminHandler{q: q}
+}
+
+func (a *AdminHandler) administrator() (Administrator, error) {
+	admin, ok := a.q.(Administrator)
+	if !ok {
+		return nil, errNoAdmin
+	}
+	return admin, nil
+}
+
+//ListQueues describes every queue
+func (a *AdminHandler) ListQueues(ctx context.Context, request *ListQueuesRequest) (*ListQueuesResponse, error) {
+	admin, err := a.administrator()
+	if err != nil {
+		return nil, err
+	}
+	queueNames, err := admin.ListQueues(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if batcher, ok := admin.(StatsBatcher); ok {
+		queues, err := batcher.StatsBatch(ctx, queueNames)
+		if err != nil {
+			return nil, err
+		}
+		return &ListQueuesResponse{Queues: queues}, nil
+	}
+	response := &ListQueuesResponse{Queues: make([]*QueueStats, 0, len(queueNames))}
+	for _, queueName := range queueNames {
+		stats, err := admin.Stats(ctx, queueName)
+		if err != nil {
+			return nil, err
+		}
+		response.Queues = append(response.Queues, stats)
+	}
+	return response, nil
+}
+
+//Stats describes one queue
+func (a *AdminHandler) Stats(ctx context.Context, request *StatsRequest) (*QueueStats, error) {
+	if request.GetQueueName() == "" {
+		return nil, errNoQueueName
+	}
+	admin, err := a.administrator()
+	if err != nil {
+		return nil, err
+	}
+	return admin.Stats(ctx, request.GetQueueName())
+}
+
+//Purge removes a queue's waiting items
+func (a *AdminHandler) Purge(ctx context.Context, request *PurgeRequest) (*PurgeResponse, error) {
+	if request.GetQueueName() == "" {
+		return nil, errNoQueueName
+	}
+	admin, err := a.administrator()
+	if err != nil {
+		return nil, err
+	}
+	count, err := admin.Purge(ctx, request.GetQueueName())
+	return &PurgeResponse{Count: count}, err
+}
+
+//Delete removes everything in a queue
+func (a *AdminHandler) Delete(ctx context.Context, request *DeleteRequest) (*DeleteResponse, error) {
+	if request.GetQueueName() == "" {
+		return nil, errNoQueueName
+	}
+	admin, err := a.administrator()
+	if err != nil {
+		return nil, err
+	}
+	return &DeleteResponse{}, admin.Delete(ctx, request.GetQueueName())
+}
@@ -0,0 +1,94 @@
+package queue_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/WillAbides/xqsmee/queue/mockqueue"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type adminQueue struct {
+	*mockqueue.MockQueue
+	*mockqueue.MockAdministrator
+}
+
+func adminSetup(t *testing.T) (*mockqueue.MockAdministrator, *queue.AdminHandler, func()) {
+	t.Helper()
+	ctrl := gomock.NewController(t)
+	admin := mockqueue.NewMockAdministrator(ctrl)
+	q := adminQueue{MockQueue: mockqueue.NewMockQueue(ctrl), MockAdministrator: admin}
+	return admin, queue.NewAdminHandler(q), ctrl.Finish
+}
+
+func TestAdminHandler_ListQueues(t *testing.T) {
+	admin, handler, teardown := adminSetup(t)
+	defer teardown()
+	admin.EXPECT().ListQueues(gomock.Any()).Return([]string{"bar", "baz"}, nil)
+	admin.EXPECT().Stats(gomock.Any(), "bar").Return(&queue.QueueStats{QueueName: "bar", Depth: 2}, nil)
+	admin.EXPECT().Stats(gomock.Any(), "baz").Return(&queue.QueueStats{QueueName: "baz"}, nil)
+	response, err := handler.ListQueues(context.Background(), &queue.ListQueuesRequest{})
+	require.Nil(t, err)
+	assert.Equal(t, []*queue.QueueStats{{QueueName: "bar", Depth: 2}, {QueueName: "baz"}}, response.GetQueues())
+}
+
+func TestAdminHandler_ListQueues_batch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	admin := mockqueue.NewMockAdministrator(ctrl)
+	batcher := mockqueue.NewMockStatsBatcher(ctrl)
+	handler := queue.NewAdminHandler(struct {
+		adminQueue
+		*mockqueue.MockStatsBatcher
+	}{adminQueue{MockQueue: mockqueue.NewMockQueue(ctrl), MockAdministrator: admin}, batcher})
+	want := []*queue.QueueStats{{QueueName: "bar", Depth: 2}, {QueueName: "baz"}}
+	admin.EXPECT().ListQueues(gomock.Any()).Return([]string{"bar", "baz"}, nil)
+	batcher.EXPECT().StatsBatch(gomock.Any(), []string{"bar", "baz"}).Return(want, nil)
+	response, err := handler.ListQueues(context.Background(), &queue.ListQueuesRequest{})
+	require.Nil(t, err)
+	assert.Equal(t, want, response.GetQueues())
+}
+
+func TestAdminHandler_Stats(t *testing.T) {
+	admin, handler, teardown := adminSetup(t)
+	defer teardown()
+	admin.EXPECT().Stats(gomock.Any(), "bar").Return(&queue.QueueStats{QueueName: "bar", InFlight: 1}, nil)
+	stats, err := handler.Stats(context.Background(), &queue.StatsRequest{QueueName: "bar"})
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), stats.GetInFlight())
+
+	_, err = handler.Stats(context.Background(), &queue.StatsRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestAdminHandler_Purge(t *testing.T) {
+	admin, handler, teardown := adminSetup(t)
+	defer teardown()
+	admin.EXPECT().Purge(gomock.Any(), "bar").Return(int64(3), nil)
+	response, err := handler.Purge(context.Background(), &queue.PurgeRequest{QueueName: "bar"})
+	require.Nil(t, err)
+	assert.Equal(t, int64(3), response.GetCount())
+}
+
+func TestAdminHandler_Delete(t *testing.T) {
+	admin, handler, teardown := adminSetup(t)
+	defer teardown()
+	admin.EXPECT().Delete(gomock.Any(), "bar").Return(nil)
+	_, err := handler.Delete(context.Background(), &queue.DeleteRequest{QueueName: "bar"})
+	assert.Nil(t, err)
+}
+
+func TestAdminHandler_unsupported(t *testing.T) {
+	tt := testSetup(t)
+	defer tt.teardown()
+	handler := queue.NewAdminHandler(tt.queue)
+	_, err := handler.ListQueues(context.Background(), &queue.ListQueuesRequest{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+	_, err = handler.Purge(context.Background(), &queue.PurgeRequest{QueueName: "bar"})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
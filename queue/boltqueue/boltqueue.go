@@ -0,0 +1,677 @@
+//Package boltqueue is a queue.Queue that is persisted to a bolt database file
+package boltqueue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Each queue gets a bucket inside queuesBucket with items, inflight and dead sub-buckets and an activity key. items and dead are keyed
+// by big-endian uint64s so cursor order is queue order. inflight is keyed by id, and its values are an 8 byte lease
+// expiration followed by the item.
+var (
+	queuesBucket   = []byte("queues")
+	itemsBucket    = []byte("items")
+	inflightBucket = []byte("inflight")
+	deadBucket     = []byte("dead")
+	// activityKey holds when something was last pushed, popped, acked or nacked as big-endian unix nanoseconds
+	activityKey = []byte("activity")
+)
+
+// firstSeq leaves room in front of the first pushed item for items that are returned to the head of the queue
+const firstSeq = 1 << 62
+
+//Queue is a queue backed by a bolt database
+type Queue struct {
+	// LeaseDuration is how long a popped item stays reserved before it is requeued. Defaults to queue.DefaultLeaseDuration.
+	LeaseDuration time.Duration
+	// MaxAttempts is how many times an item is delivered before it goes to the dead-letter list. Zero means no limit.
+	MaxAttempts int64
+
+	db        *bolt.DB
+	mux       sync.Mutex
+	notifiers map[string]chan struct{}
+}
+
+//Open opens the bolt database at path, creating it if it doesn't exist
+func Open(path string) (*Queue, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed opening bolt database")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(queuesBucket)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed creating queues bucket")
+	}
+	return &Queue{
+		db:        db,
+		notifiers: map[string]chan struct{}{},
+	}, nil
+}
+
+//Close closes the database
+func (q *Queue) Close() error {
+	return q.db.Close()
+}
+
+//HealthCheck checks that the database is open and readable
+func (q *Queue) HealthCheck(ctx context.Context) error {
+	return q.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(queuesBucket) == nil {
+			return errors.New("queues bucket is missing")
+		}
+		return nil
+	})
+}
+
+// notifier returns a channel that is closed the next time something is added to queueName
+func (q *Queue) notifier(queueName string) <-chan struct{} {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	ch := q.notifiers[queueName]
+	if ch == nil {
+		ch = make(chan struct{})
+		q.notifiers[queueName] = ch
+	}
+	return ch
+}
+
+func (q *Queue) notify(queueName string) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	ch := q.notifiers[queueName]
+	if ch != nil {
+		close(ch)
+		delete(q.notifiers, queueName)
+	}
+}
+
+func (q *Queue) leaseDuration() time.Duration {
+	if q.LeaseDuration > 0 {
+		return q.LeaseDuration
+	}
+	return queue.DefaultLeaseDuration
+}
+
+// queueBucket returns the bucket for queueName, or nil when nothing has been pushed to the queue
+func queueBucket(tx *bolt.Tx, queueName string) *bolt.Bucket {
+	return tx.Bucket(queuesBucket).Bucket([]byte(queueName))
+}
+
+// createQueueBucket returns the bucket for queueName, creating it when it doesn't exist. Only pushes create queues.
+func createQueueBucket(tx *bolt.Tx, queueName string) (*bolt.Bucket, error) {
+	b, err := tx.Bucket(queuesBucket).CreateBucketIfNotExists([]byte(queueName))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range [][]byte{itemsBucket, inflightBucket, deadBucket} {
+		_, err = b.CreateBucketIfNotExists(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func pushBack(b *bolt.Bucket, value []byte) error {
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	return b.Put(itob(firstSeq+seq), value)
+}
+
+func pushFront(b *bolt.Bucket, value []byte) error {
+	k, _ := b.Cursor().First()
+	if k == nil {
+		return pushBack(b, value)
+	}
+	return b.Put(itob(binary.BigEndian.Uint64(k)-1), value)
+}
+
+func unmarshal(value []byte) (*queue.WebRequest, error) {
+	webRequest := new(queue.WebRequest)
+	// bolt values are only valid during the transaction
+	err := proto.Unmarshal(append([]byte(nil), value...), webRequest)
+	return webRequest, err
+}
+
+func touch(b *bolt.Bucket, now time.Time) error {
+	return b.Put(activityKey, itob(uint64(now.UnixNano())))
+}
+
+// release moves an in-flight item back to the front of the queue, or to the dead-letter list
+func (q *Queue) release(b *bolt.Bucket, id []byte) (requeued bool, err error) {
+	inflight := b.Bucket(inflightBucket)
+	value := inflight.Get(id)
+	if value == nil {
+		return false, queue.ErrNotInFlight
+	}
+	item := append([]byte(nil), value[8:]...)
+	err = inflight.Delete(id)
+	if err != nil {
+		return false, err
+	}
+	webRequest, err := unmarshal(item)
+	if err != nil {
+		return false, err
+	}
+	if q.MaxAttempts > 0 && webRequest.GetAttempts() >= q.MaxAttempts {
+		return false, pushBack(b.Bucket(deadBucket), item)
+	}
+	return true, pushFront(b.Bucket(itemsBucket), item)
+}
+
+// requeueExpired releases expired leases and returns when the next lease expires
+func (q *Queue) requeueExpired(b *bolt.Bucket, now time.Time) (requeued bool, nextExpiration time.Time, err error) {
+	var expired [][]byte
+	err = b.Bucket(inflightBucket).ForEach(func(k, v []byte) error {
+		expiresAt := time.Unix(0, int64(binary.BigEndian.Uint64(v[:8])))
+		if !expiresAt.After(now) {
+			expired = append(expired, append([]byte(nil), k...))
+			return nil
+		}
+		if nextExpiration.IsZero() || expiresAt.Before(nextExpiration) {
+			nextExpiration = expiresAt
+		}
+		return nil
+	})
+	if err != nil {
+		return false, nextExpiration, err
+	}
+	for _, id := range expired {
+		r, err := q.release(b, id)
+		if err != nil {
+			return false, nextExpiration, err
+		}
+		requeued = requeued || r
+	}
+	return requeued, nextExpiration, nil
+}
+
+//Push adds to the queue
+func (q *Queue) Push(ctx context.Context, queueName string, webRequests []*queue.WebRequest) error {
+	_, err := q.PushLimited(ctx, queueName, webRequests, queue.Limits{})
+	return err
+}
+
+//PushLimited adds to the queue while keeping its waiting items within limits and returns how many items it dropped
+func (q *Queue) PushLimited(ctx context.Context, queueName string, webRequests []*queue.WebRequest,
+	limits queue.Limits) (int64, error) {
+	values := make([][]byte, len(webRequests))
+	for i, webRequest := range webRequests {
+		protoBytes, err := proto.Marshal(webRequest)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed marshaling protobuf")
+		}
+		values[i] = protoBytes
+	}
+	var dropped int64
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b, err := createQueueBucket(tx, queueName)
+		if err != nil {
+			return err
+		}
+		dropped, err = pushLimited(b.Bucket(itemsBucket), values, limits)
+		if err != nil {
+			return err
+		}
+		return touch(b, time.Now())
+	})
+	if err != nil {
+		return 0, err
+	}
+	q.notify(queueName)
+	return dropped, nil
+}
+
+// pushLimited pushes values to the back of items, keeping it within limits
+func pushLimited(items *bolt.Bucket, values [][]byte, limits queue.Limits) (dropped int64, err error) {
+	var count, size int64
+	if limits.Limited() {
+		err = items.ForEach(func(k, v []byte) error {
+			count++
+			size += int64(len(v))
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	if limits.Overflow == "" || limits.Overflow == queue.OverflowReject {
+		total := size
+		for _, value := range values {
+			total += int64(len(value))
+		}
+		err = limits.Check(count+int64(len(values)), total)
+		if err != nil {
+			return 0, err
+		}
+	}
+	for _, value := range values {
+		valueSize := int64(len(value))
+		if limits.Check(1, valueSize) != nil {
+			// it wouldn't fit in an empty queue
+			dropped++
+			continue
+		}
+		if limits.Overflow == queue.OverflowDropNewest && limits.Check(count+1, size+valueSize) != nil {
+			dropped++
+			continue
+		}
+		for count > 0 && limits.Check(count+1, size+valueSize) != nil {
+			k, v := items.Cursor().First()
+			size -= int64(len(v))
+			err = items.Delete(k)
+			if err != nil {
+				return dropped, err
+			}
+			count--
+			dropped++
+		}
+		err = pushBack(items, value)
+		if err != nil {
+			return dropped, err
+		}
+		count++
+		size += valueSize
+	}
+	return dropped, nil
+}
+
+// reserve moves the next item to in-flight. When the queue is empty it returns how long until the next lease
+// expires, if any.
+func (q *Queue) reserve(queueName string) (webRequest *queue.WebRequest, wait time.Duration, err error) {
+	// check in a read-only tx first so popping a queue that doesn't exist writes nothing
+	var exists bool
+	err = q.db.View(func(tx *bolt.Tx) error {
+		exists = queueBucket(tx, queueName) != nil
+		return nil
+	})
+	if err != nil || !exists {
+		return nil, 0, err
+	}
+	var requeued bool
+	err = q.db.Update(func(tx *bolt.Tx) error {
+		b := queueBucket(tx, queueName)
+		if b == nil {
+			return nil
+		}
+		now := time.Now()
+		var nextExpiration time.Time
+		requeued, nextExpiration, err = q.requeueExpired(b, now)
+		if err != nil {
+			return err
+		}
+		items := b.Bucket(itemsBucket)
+		k, v := items.Cursor().First()
+		if k == nil {
+			if !nextExpiration.IsZero() {
+				wait = nextExpiration.Sub(now)
+			}
+			return nil
+		}
+		webRequest, err = unmarshal(v)
+		if err != nil {
+			return err
+		}
+		err = items.Delete(k)
+		if err != nil {
+			return err
+		}
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		webRequest.Attempts++
+		protoBytes, err := proto.Marshal(webRequest)
+		if err != nil {
+			return errors.Wrap(err, "failed marshaling protobuf")
+		}
+		expiresAt := now.Add(q.leaseDuration())
+		err = b.Bucket(inflightBucket).Put([]byte(id), append(itob(uint64(expiresAt.UnixNano())), protoBytes...))
+		if err != nil {
+			return err
+		}
+		webRequest.ID = id
+		return touch(b, now)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if requeued {
+		q.notify(queueName)
+	}
+	return webRequest, wait, nil
+}
+
+//Pop pops the next item off the queue
+func (q *Queue) Pop(ctx context.Context, queueName string, timeout time.Duration) (*queue.WebRequest, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	for {
+		notify := q.notifier(queueName)
+		webRequest, wait, err := q.reserve(queueName)
+		if err != nil || webRequest != nil {
+			return webRequest, err
+		}
+		var expired <-chan time.Time
+		var timer *time.Timer
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			expired = timer.C
+		}
+		select {
+		case <-notify:
+		case <-expired:
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return nil, nil
+		}
+	}
+}
+
+//Ack removes a popped item from in-flight
+func (q *Queue) Ack(ctx context.Context, queueName, id string) error {
+	var requeued bool
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := queueBucket(tx, queueName)
+		if b == nil {
+			return queue.ErrNotInFlight
+		}
+		var err error
+		requeued, _, err = q.requeueExpired(b, time.Now())
+		if err != nil {
+			return err
+		}
+		inflight := b.Bucket(inflightBucket)
+		if inflight.Get([]byte(id)) == nil {
+			return queue.ErrNotInFlight
+		}
+		err = inflight.Delete([]byte(id))
+		if err != nil {
+			return err
+		}
+		return touch(b, time.Now())
+	})
+	if requeued {
+		q.notify(queueName)
+	}
+	return err
+}
+
+//Nack returns a popped item to the head of the queue, or to the dead-letter list once it reaches MaxAttempts
+func (q *Queue) Nack(ctx context.Context, queueName, id string) error {
+	var requeued bool
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := queueBucket(tx, queueName)
+		if b == nil {
+			return queue.ErrNotInFlight
+		}
+		var err error
+		requeued, _, err = q.requeueExpired(b, time.Now())
+		if err != nil {
+			return err
+		}
+		r, err := q.release(b, []byte(id))
+		requeued = requeued || r
+		if err != nil {
+			return err
+		}
+		return touch(b, time.Now())
+	})
+	if requeued {
+		q.notify(queueName)
+	}
+	return err
+}
+
+//Peek show the next few items in the queue
+func (q *Queue) Peek(ctx context.Context, queueName string, count int64) ([]*queue.WebRequest, error) {
+	return q.peek(queueName, itemsBucket, count)
+}
+
+//PeekDead shows the next few items in the queue's dead-letter list
+func (q *Queue) PeekDead(ctx context.Context, queueName string, count int64) ([]*queue.WebRequest, error) {
+	return q.peek(queueName, deadBucket, count)
+}
+
+func (q *Queue) peek(queueName string, bucket []byte, count int64) ([]*queue.WebRequest, error) {
+	response := make([]*queue.WebRequest, 0)
+	if count <= 0 {
+		count = 10
+	}
+	err := q.db.View(func(tx *bolt.Tx) error {
+		b := queueBucket(tx, queueName)
+		if b == nil {
+			return nil
+		}
+		c := b.Bucket(bucket).Cursor()
+		for k, v := c.First(); k != nil && int64(len(response)) < count; k, v = c.Next() {
+			webRequest, err := unmarshal(v)
+			if err != nil {
+				return err
+			}
+			response = append(response, webRequest)
+		}
+		return nil
+	})
+	return response, err
+}
+
+//RequeueDead moves everything in the dead-letter list to the front of the queue and returns how many items it moved
+func (q *Queue) RequeueDead(ctx context.Context, queueName string) (int64, error) {
+	var count int64
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := queueBucket(tx, queueName)
+		if b == nil {
+			return nil
+		}
+		dead := b.Bucket(deadBucket)
+		items := b.Bucket(itemsBucket)
+		c := dead.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Last() {
+			err := pushFront(items, append([]byte(nil), v...))
+			if err != nil {
+				return err
+			}
+			err = dead.Delete(k)
+			if err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		q.notify(queueName)
+	}
+	return count, nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errors.Wrap(err, "failed generating id")
+	}
+	return hex.EncodeToString(b), nil
+}
+
+//ListQueues returns the names of queues that have been used
+func (q *Queue) ListQueues(ctx context.Context) ([]string, error) {
+	var queueNames []string
+	err := q.db.View(func(tx *bolt.Tx) error {
+		queues := tx.Bucket(queuesBucket)
+		return queues.ForEach(func(k, v []byte) error {
+			// empty pops used to create the queue's bucket
+			if v == nil && used(queues.Bucket(k)) {
+				queueNames = append(queueNames, string(k))
+			}
+			return nil
+		})
+	})
+	return queueNames, err
+}
+
+// used reports whether a queue bucket has activity or items. Queues written before activity was recorded only have
+// items.
+func used(b *bolt.Bucket) bool {
+	if b.Get(activityKey) != nil {
+		return true
+	}
+	for _, name := range [][]byte{itemsBucket, inflightBucket, deadBucket} {
+		if k, _ := b.Bucket(name).Cursor().First(); k != nil {
+			return true
+		}
+	}
+	return false
+}
+
+//Stats describes a queue
+func (q *Queue) Stats(ctx context.Context, queueName string) (*queue.QueueStats, error) {
+	stats := &queue.QueueStats{QueueName: queueName}
+	var requeued bool
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := queueBucket(tx, queueName)
+		if b == nil {
+			return nil
+		}
+		var err error
+		requeued, _, err = q.requeueExpired(b, time.Now())
+		if err != nil {
+			return err
+		}
+		items := b.Bucket(itemsBucket)
+		stats.Depth = int64(items.Stats().KeyN)
+		stats.InFlight = int64(b.Bucket(inflightBucket).Stats().KeyN)
+		stats.Dead = int64(b.Bucket(deadBucket).Stats().KeyN)
+		if k, v := items.Cursor().First(); k != nil {
+			oldest, err := unmarshal(v)
+			if err != nil {
+				return err
+			}
+			stats.OldestReceivedAt = oldest.GetReceivedAt()
+		}
+		if k, v := items.Cursor().Last(); k != nil {
+			newest, err := unmarshal(v)
+			if err != nil {
+				return err
+			}
+			stats.NewestReceivedAt = newest.GetReceivedAt()
+		}
+		if v := b.Get(activityKey); v != nil {
+			stats.LastActivity, err = ptypes.TimestampProto(time.Unix(0, int64(binary.BigEndian.Uint64(v))))
+		}
+		return err
+	})
+	if requeued {
+		q.notify(queueName)
+	}
+	return stats, err
+}
+
+//Purge removes the waiting items and returns how many it removed
+func (q *Queue) Purge(ctx context.Context, queueName string) (int64, error) {
+	var count int64
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := queueBucket(tx, queueName)
+		if b == nil {
+			return nil
+		}
+		count = int64(b.Bucket(itemsBucket).Stats().KeyN)
+		err := b.DeleteBucket(itemsBucket)
+		if err != nil {
+			return err
+		}
+		_, err = b.CreateBucket(itemsBucket)
+		return err
+	})
+	return count, err
+}
+
+//Delete removes everything in the queue
+func (q *Queue) Delete(ctx context.Context, queueName string) error {
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(queuesBucket).DeleteBucket([]byte(queueName))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// waiting pops go on with a new bucket
+	q.notify(queueName)
+	return nil
+}
+
+//Expire discards waiting items and dead letters received before receivedBefore and returns how many it discarded
+func (q *Queue) Expire(ctx context.Context, queueName string, receivedBefore time.Time) (int64, error) {
+	var count int64
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := queueBucket(tx, queueName)
+		if b == nil {
+			return nil
+		}
+		for _, name := range [][]byte{itemsBucket, deadBucket} {
+			bucket := b.Bucket(name)
+			var expired [][]byte
+			err := bucket.ForEach(func(k, v []byte) error {
+				webRequest, err := unmarshal(v)
+				if err != nil {
+					return err
+				}
+				if webRequest.ReceivedBefore(receivedBefore) {
+					expired = append(expired, append([]byte(nil), k...))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range expired {
+				err = bucket.Delete(k)
+				if err != nil {
+					return err
+				}
+			}
+			count += int64(len(expired))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
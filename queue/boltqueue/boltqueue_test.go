@@ -0,0 +1,101 @@
+package boltqueue
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/WillAbides/xqsmee/queue/queuetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boltqueue")
+	require.Nil(t, err)
+	defer func() {
+		require.Nil(t, os.RemoveAll(dir))
+	}()
+	var queues []*Queue
+	defer func() {
+		for _, q := range queues {
+			assert.Nil(t, q.Close())
+		}
+	}()
+	queuetest.Run(t, func(t *testing.T, opts queuetest.Options) queue.Queue {
+		q, err := Open(filepath.Join(dir, strconv.Itoa(len(queues))+".db"))
+		require.Nil(t, err)
+		queues = append(queues, q)
+		q.LeaseDuration = opts.LeaseDuration
+		q.MaxAttempts = opts.MaxAttempts
+		return q
+	})
+}
+
+func TestQueue_persistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boltqueue")
+	require.Nil(t, err)
+	defer func() {
+		require.Nil(t, os.RemoveAll(dir))
+	}()
+	path := filepath.Join(dir, "xqsmee.db")
+	ctx := context.Background()
+
+	q, err := Open(path)
+	require.Nil(t, err)
+	q.LeaseDuration = 10 * time.Millisecond
+	err = q.Push(ctx, "bar", []*queue.WebRequest{{Body: []byte("1")}, {Body: []byte("2")}})
+	require.Nil(t, err)
+	popped, err := q.Pop(ctx, "bar", time.Second)
+	require.Nil(t, err)
+	require.NotNil(t, popped)
+	require.Nil(t, q.Close())
+
+	q, err = Open(path)
+	require.Nil(t, err)
+	defer func() {
+		assert.Nil(t, q.Close())
+	}()
+	time.Sleep(20 * time.Millisecond)
+	for _, body := range []string{"1", "2"} {
+		got, err := q.Pop(ctx, "bar", time.Second)
+		assert.Nil(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, body, string(got.GetBody()))
+	}
+}
+
+func TestQueue_unknownQueues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boltqueue")
+	require.Nil(t, err)
+	defer func() {
+		require.Nil(t, os.RemoveAll(dir))
+	}()
+	q, err := Open(filepath.Join(dir, "xqsmee.db"))
+	require.Nil(t, err)
+	defer func() {
+		assert.Nil(t, q.Close())
+	}()
+	ctx := context.Background()
+
+	got, err := q.Pop(ctx, "bar", 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Nil(t, got)
+	_, err = q.Peek(ctx, "bar", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, queue.ErrNotInFlight, q.Ack(ctx, "bar", "nope"))
+	assert.Equal(t, queue.ErrNotInFlight, q.Nack(ctx, "bar", "nope"))
+	_, err = q.RequeueDead(ctx, "bar")
+	assert.Nil(t, err)
+	err = q.db.View(func(tx *bolt.Tx) error {
+		assert.Nil(t, queueBucket(tx, "bar"))
+		return nil
+	})
+	assert.Nil(t, err)
+}
@@ -0,0 +1,77 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	//ErrMaxItems is returned when a push would put more than MaxItems items in a queue that rejects overflow
+	ErrMaxItems = errors.New("queue is full")
+	//ErrMaxBytes is returned when a push would put more than MaxBytes in a queue that rejects overflow
+	ErrMaxBytes = errors.New("queue is out of space")
+	//ErrNotLimiter is returned when a push has limits but the queue isn't a Limiter
+	ErrNotLimiter = errors.New("this backend can't limit queues")
+)
+
+//Overflow is what happens to pushes that don't fit in a queue
+type Overflow string
+
+const (
+	//OverflowReject refuses the whole push
+	OverflowReject Overflow = "reject"
+	//OverflowDropOldest drops items from the front of the queue until the new ones fit
+	OverflowDropOldest Overflow = "dropOldest"
+	//OverflowDropNewest drops the new items that don't fit
+	OverflowDropNewest Overflow = "dropNewest"
+)
+
+//Valid reports whether o is a known overflow policy. Empty is valid and means OverflowReject.
+func (o Overflow) Valid() bool {
+	switch o {
+	case "", OverflowReject, OverflowDropOldest, OverflowDropNewest:
+		return true
+	}
+	return false
+}
+
+//Limits caps the waiting items in a queue. In-flight items and dead letters don't count.
+type Limits struct {
+	//MaxItems is how many items a queue holds. Zero means no limit.
+	MaxItems int64
+	//MaxBytes is how many bytes of marshaled items a queue holds. Zero means no limit.
+	MaxBytes int64
+	//Overflow is what happens to pushes that don't fit. Empty means OverflowReject.
+	Overflow Overflow
+}
+
+//Limited reports whether l limits anything
+func (l Limits) Limited() bool {
+	return l.MaxItems > 0 || l.MaxBytes > 0
+}
+
+//Check returns ErrMaxItems or ErrMaxBytes when a queue holding count items totaling size bytes is over l
+func (l Limits) Check(count, size int64) error {
+	if l.MaxItems > 0 && count > l.MaxItems {
+		return ErrMaxItems
+	}
+	if l.MaxBytes > 0 && size > l.MaxBytes {
+		return ErrMaxBytes
+	}
+	return nil
+}
+
+//PushLimited pushes to q within limits and returns how many items were dropped. Limits that don't limit anything get
+//a plain Push. Queues that aren't Limiters get ErrNotLimiter instead of being allowed to grow past the limits.
+func PushLimited(ctx context.Context, q Queue, queueName string, webRequests []*WebRequest,
+	limits Limits) (int64, error) {
+	if !limits.Limited() {
+		return 0, q.Push(ctx, queueName, webRequests)
+	}
+	limiter, ok := q.(Limiter)
+	if !ok {
+		return 0, ErrNotLimiter
+	}
+	return limiter.PushLimited(ctx, queueName, webRequests, limits)
+}
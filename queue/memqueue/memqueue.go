@@ -0,0 +1,442 @@
+//Package memqueue is a queue.Queue that lives in memory. Nothing is persisted, so it is only for development and tests.
+package memqueue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+)
+
+//Queue is an in-memory queue
+type Queue struct {
+	// LeaseDuration is how long a popped item stays reserved before it is requeued. Defaults to queue.DefaultLeaseDuration.
+	LeaseDuration time.Duration
+	// MaxAttempts is how many times an item is delivered before it goes to the dead-letter list. Zero means no limit.
+	MaxAttempts int64
+
+	mux    sync.Mutex
+	queues map[string]*namedQueue
+	// created is closed and replaced whenever a queue is created, so pops can wait for queues that don't exist yet
+	created chan struct{}
+}
+
+type (
+	namedQueue struct {
+		items    []*queue.WebRequest
+		dead     []*queue.WebRequest
+		inflight map[string]*lease
+		// lastActivity is when something was last pushed, popped, acked or nacked
+		lastActivity time.Time
+		// notify is closed and replaced whenever items are added
+		notify chan struct{}
+	}
+
+	lease struct {
+		webRequest *queue.WebRequest
+		expiresAt  time.Time
+	}
+)
+
+//New returns a new Queue
+func New() *Queue {
+	return &Queue{
+		queues: map[string]*namedQueue{},
+	}
+}
+
+// createQueue returns the queue for queueName, creating it when it doesn't exist. Only pushes create queues, so
+// reading made-up queue names doesn't use memory. q.mux must be held.
+func (q *Queue) createQueue(queueName string) *namedQueue {
+	if q.queues == nil {
+		q.queues = map[string]*namedQueue{}
+	}
+	nq := q.queues[queueName]
+	if nq == nil {
+		nq = &namedQueue{
+			inflight: map[string]*lease{},
+			notify:   make(chan struct{}),
+		}
+		q.queues[queueName] = nq
+		if q.created != nil {
+			close(q.created)
+			q.created = nil
+		}
+	}
+	return nq
+}
+
+// waitCreated returns a channel that is closed when a queue is created. q.mux must be held.
+func (q *Queue) waitCreated() <-chan struct{} {
+	if q.created == nil {
+		q.created = make(chan struct{})
+	}
+	return q.created
+}
+
+func (q *Queue) leaseDuration() time.Duration {
+	if q.LeaseDuration > 0 {
+		return q.LeaseDuration
+	}
+	return queue.DefaultLeaseDuration
+}
+
+func (nq *namedQueue) wake() {
+	close(nq.notify)
+	nq.notify = make(chan struct{})
+}
+
+// release moves an in-flight item back to the front of the queue, or to the dead-letter list
+func (nq *namedQueue) release(id string, maxAttempts int64) {
+	l := nq.inflight[id]
+	delete(nq.inflight, id)
+	if maxAttempts > 0 && l.webRequest.GetAttempts() >= maxAttempts {
+		nq.dead = append(nq.dead, l.webRequest)
+		return
+	}
+	nq.items = append([]*queue.WebRequest{l.webRequest}, nq.items...)
+	nq.wake()
+}
+
+// requeueExpired releases expired leases and returns when the next lease expires
+func (nq *namedQueue) requeueExpired(now time.Time, maxAttempts int64) (nextExpiration time.Time) {
+	for id, l := range nq.inflight {
+		if !l.expiresAt.After(now) {
+			nq.release(id, maxAttempts)
+			continue
+		}
+		if nextExpiration.IsZero() || l.expiresAt.Before(nextExpiration) {
+			nextExpiration = l.expiresAt
+		}
+	}
+	return nextExpiration
+}
+
+//Push adds to the queue
+func (q *Queue) Push(ctx context.Context, queueName string, webRequests []*queue.WebRequest) error {
+	_, err := q.PushLimited(ctx, queueName, webRequests, queue.Limits{})
+	return err
+}
+
+//PushLimited adds to the queue while keeping its waiting items within limits and returns how many items it dropped
+func (q *Queue) PushLimited(ctx context.Context, queueName string, webRequests []*queue.WebRequest,
+	limits queue.Limits) (int64, error) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	var count, size int64
+	if nq := q.queues[queueName]; nq != nil {
+		count = int64(len(nq.items))
+		if limits.MaxBytes > 0 {
+			size = nq.size()
+		}
+	}
+	if limits.Overflow == "" || limits.Overflow == queue.OverflowReject {
+		total := size
+		for _, webRequest := range webRequests {
+			total += int64(proto.Size(webRequest))
+		}
+		err := limits.Check(count+int64(len(webRequests)), total)
+		if err != nil {
+			return 0, err
+		}
+	}
+	nq := q.createQueue(queueName)
+	var dropped int64
+	for _, webRequest := range webRequests {
+		itemSize := int64(proto.Size(webRequest))
+		if limits.Check(1, itemSize) != nil {
+			// it wouldn't fit in an empty queue
+			dropped++
+			continue
+		}
+		if limits.Overflow == queue.OverflowDropNewest && limits.Check(count+1, size+itemSize) != nil {
+			dropped++
+			continue
+		}
+		for count > 0 && limits.Check(count+1, size+itemSize) != nil {
+			size -= int64(proto.Size(nq.items[0]))
+			nq.items[0] = nil
+			nq.items = nq.items[1:]
+			count--
+			dropped++
+		}
+		nq.items = append(nq.items, proto.Clone(webRequest).(*queue.WebRequest))
+		count++
+		size += itemSize
+	}
+	nq.lastActivity = time.Now()
+	nq.wake()
+	return dropped, nil
+}
+
+// size is the number of bytes in the waiting items
+func (nq *namedQueue) size() int64 {
+	var size int64
+	for _, item := range nq.items {
+		size += int64(proto.Size(item))
+	}
+	return size
+}
+
+// reserve pops the next item into in-flight. When the queue is empty it returns a channel that is closed when
+// something is pushed and how long until the next lease expires, if any.
+func (q *Queue) reserve(queueName string) (*queue.WebRequest, <-chan struct{}, time.Duration, error) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	nq := q.queues[queueName]
+	if nq == nil {
+		return nil, q.waitCreated(), 0, nil
+	}
+	now := time.Now()
+	nextExpiration := nq.requeueExpired(now, q.MaxAttempts)
+	if len(nq.items) == 0 {
+		var wait time.Duration
+		if !nextExpiration.IsZero() {
+			wait = nextExpiration.Sub(now)
+		}
+		return nil, nq.notify, wait, nil
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	webRequest := nq.items[0]
+	nq.items[0] = nil
+	nq.items = nq.items[1:]
+	webRequest.Attempts++
+	nq.lastActivity = now
+	nq.inflight[id] = &lease{
+		webRequest: webRequest,
+		expiresAt:  now.Add(q.leaseDuration()),
+	}
+	popped := proto.Clone(webRequest).(*queue.WebRequest)
+	popped.ID = id
+	return popped, nil, 0, nil
+}
+
+//Pop pops the next item off the queue
+func (q *Queue) Pop(ctx context.Context, queueName string, timeout time.Duration) (*queue.WebRequest, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	for {
+		webRequest, notify, wait, err := q.reserve(queueName)
+		if err != nil || webRequest != nil {
+			return webRequest, err
+		}
+		var expired <-chan time.Time
+		var timer *time.Timer
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			expired = timer.C
+		}
+		select {
+		case <-notify:
+		case <-expired:
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return nil, nil
+		}
+	}
+}
+
+//Ack removes a popped item from in-flight
+func (q *Queue) Ack(ctx context.Context, queueName, id string) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	nq := q.queues[queueName]
+	if nq == nil {
+		return queue.ErrNotInFlight
+	}
+	nq.requeueExpired(time.Now(), q.MaxAttempts)
+	if nq.inflight[id] == nil {
+		return queue.ErrNotInFlight
+	}
+	delete(nq.inflight, id)
+	nq.lastActivity = time.Now()
+	return nil
+}
+
+//Nack returns a popped item to the head of the queue, or to the dead-letter list once it reaches MaxAttempts
+func (q *Queue) Nack(ctx context.Context, queueName, id string) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	nq := q.queues[queueName]
+	if nq == nil {
+		return queue.ErrNotInFlight
+	}
+	nq.requeueExpired(time.Now(), q.MaxAttempts)
+	if nq.inflight[id] == nil {
+		return queue.ErrNotInFlight
+	}
+	nq.release(id, q.MaxAttempts)
+	nq.lastActivity = time.Now()
+	return nil
+}
+
+//Peek show the next few items in the queue
+func (q *Queue) Peek(ctx context.Context, queueName string, count int64) ([]*queue.WebRequest, error) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	nq := q.queues[queueName]
+	if nq == nil {
+		return peek(nil, count), nil
+	}
+	return peek(nq.items, count), nil
+}
+
+//PeekDead shows the next few items in the queue's dead-letter list
+func (q *Queue) PeekDead(ctx context.Context, queueName string, count int64) ([]*queue.WebRequest, error) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	nq := q.queues[queueName]
+	if nq == nil {
+		return peek(nil, count), nil
+	}
+	return peek(nq.dead, count), nil
+}
+
+func peek(items []*queue.WebRequest, count int64) []*queue.WebRequest {
+	if count <= 0 {
+		count = 10
+	}
+	if int64(len(items)) < count {
+		count = int64(len(items))
+	}
+	response := make([]*queue.WebRequest, 0, count)
+	for _, item := range items[:count] {
+		response = append(response, proto.Clone(item).(*queue.WebRequest))
+	}
+	return response
+}
+
+//RequeueDead moves everything in the dead-letter list to the front of the queue and returns how many items it moved
+func (q *Queue) RequeueDead(ctx context.Context, queueName string) (int64, error) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	nq := q.queues[queueName]
+	if nq == nil || len(nq.dead) == 0 {
+		return 0, nil
+	}
+	count := int64(len(nq.dead))
+	nq.items = append(nq.dead, nq.items...)
+	nq.dead = nil
+	nq.wake()
+	return count, nil
+}
+
+//ListQueues returns the names of queues that have been used
+func (q *Queue) ListQueues(ctx context.Context) ([]string, error) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	queueNames := make([]string, 0, len(q.queues))
+	for queueName := range q.queues {
+		queueNames = append(queueNames, queueName)
+	}
+	sort.Strings(queueNames)
+	return queueNames, nil
+}
+
+//Stats describes a queue
+func (q *Queue) Stats(ctx context.Context, queueName string) (*queue.QueueStats, error) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	stats := &queue.QueueStats{QueueName: queueName}
+	nq := q.queues[queueName]
+	if nq == nil {
+		return stats, nil
+	}
+	nq.requeueExpired(time.Now(), q.MaxAttempts)
+	stats.Depth = int64(len(nq.items))
+	stats.InFlight = int64(len(nq.inflight))
+	stats.Dead = int64(len(nq.dead))
+	if len(nq.items) > 0 {
+		stats.OldestReceivedAt = nq.items[0].GetReceivedAt()
+		stats.NewestReceivedAt = nq.items[len(nq.items)-1].GetReceivedAt()
+	}
+	if nq.lastActivity.IsZero() {
+		return stats, nil
+	}
+	var err error
+	stats.LastActivity, err = ptypes.TimestampProto(nq.lastActivity)
+	return stats, err
+}
+
+//Purge removes the waiting items and returns how many it removed
+func (q *Queue) Purge(ctx context.Context, queueName string) (int64, error) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	nq := q.queues[queueName]
+	if nq == nil {
+		return 0, nil
+	}
+	count := int64(len(nq.items))
+	nq.items = nil
+	return count, nil
+}
+
+//Delete removes everything in the queue
+func (q *Queue) Delete(ctx context.Context, queueName string) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	nq := q.queues[queueName]
+	if nq == nil {
+		return nil
+	}
+	// waiting pops go on with a new queue
+	nq.wake()
+	delete(q.queues, queueName)
+	return nil
+}
+
+//Expire discards waiting items and dead letters received before receivedBefore and returns how many it discarded
+func (q *Queue) Expire(ctx context.Context, queueName string, receivedBefore time.Time) (int64, error) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	nq := q.queues[queueName]
+	if nq == nil {
+		return 0, nil
+	}
+	var count int64
+	nq.items, count = expire(nq.items, receivedBefore)
+	var dead int64
+	nq.dead, dead = expire(nq.dead, receivedBefore)
+	return count + dead, nil
+}
+
+// expire returns the items that were received at or after receivedBefore and how many it left out
+func expire(items []*queue.WebRequest, receivedBefore time.Time) ([]*queue.WebRequest, int64) {
+	kept := items[:0]
+	for _, item := range items {
+		if !item.ReceivedBefore(receivedBefore) {
+			kept = append(kept, item)
+		}
+	}
+	count := int64(len(items) - len(kept))
+	for i := len(kept); i < len(items); i++ {
+		items[i] = nil
+	}
+	return kept, count
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errors.Wrap(err, "failed generating id")
+	}
+	return hex.EncodeToString(b), nil
+}
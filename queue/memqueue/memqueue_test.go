@@ -0,0 +1,60 @@
+package memqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/WillAbides/xqsmee/queue/queuetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	queuetest.Run(t, func(t *testing.T, opts queuetest.Options) queue.Queue {
+		q := New()
+		q.LeaseDuration = opts.LeaseDuration
+		q.MaxAttempts = opts.MaxAttempts
+		return q
+	})
+}
+
+func TestQueue_zeroValue(t *testing.T) {
+	queuetest.Run(t, func(t *testing.T, opts queuetest.Options) queue.Queue {
+		return &Queue{
+			LeaseDuration: opts.LeaseDuration,
+			MaxAttempts:   opts.MaxAttempts,
+		}
+	})
+}
+
+func TestQueue_unknownQueues(t *testing.T) {
+	ctx := context.Background()
+	q := New()
+	_, err := q.Peek(ctx, "nope", 0)
+	assert.Nil(t, err)
+	_, err = q.PeekDead(ctx, "nope", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, queue.ErrNotInFlight, q.Ack(ctx, "nope", "id"))
+	assert.Equal(t, queue.ErrNotInFlight, q.Nack(ctx, "nope", "id"))
+	_, err = q.RequeueDead(ctx, "nope")
+	assert.Nil(t, err)
+	got, err := q.Pop(ctx, "nope", time.Millisecond)
+	assert.Nil(t, err)
+	assert.Nil(t, got)
+	_, err = q.PushLimited(ctx, "nope", []*queue.WebRequest{{Body: []byte("too big")}}, queue.Limits{MaxBytes: 1})
+	assert.Equal(t, queue.ErrMaxBytes, err)
+	assert.Empty(t, q.queues, "only pushes create queues")
+
+	popped := make(chan *queue.WebRequest, 1)
+	go func() {
+		got, _ := q.Pop(ctx, "later", time.Second)
+		popped <- got
+	}()
+	time.Sleep(10 * time.Millisecond)
+	require.Nil(t, q.Push(ctx, "later", []*queue.WebRequest{{Body: []byte("hi")}}))
+	got = <-popped
+	require.NotNil(t, got, "pops wait for queues to be created")
+	assert.Equal(t, "hi", string(got.GetBody()))
+}
@@ -72,3 +72,270 @@ func (m *MockQueue) Push(arg0 context.Context, arg1 string, arg2 []*queue.WebReq
 func (mr *MockQueueMockRecorder) Push(arg0, arg1, arg2 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Push", reflect.TypeOf((*MockQueue)(nil).Push), arg0, arg1, arg2)
 }
+
+// Ack mocks base method
+func (m *MockQueue) Ack(arg0 context.Context, arg1, arg2 string) error {
+	ret := m.ctrl.Call(m, "Ack", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ack indicates an expected call of Ack
+func (mr *MockQueueMockRecorder) Ack(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ack", reflect.TypeOf((*MockQueue)(nil).Ack), arg0, arg1, arg2)
+}
+
+// Nack mocks base method
+func (m *MockQueue) Nack(arg0 context.Context, arg1, arg2 string) error {
+	ret := m.ctrl.Call(m, "Nack", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Nack indicates an expected call of Nack
+func (mr *MockQueueMockRecorder) Nack(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Nack", reflect.TypeOf((*MockQueue)(nil).Nack), arg0, arg1, arg2)
+}
+
+// PeekDead mocks base method
+func (m *MockQueue) PeekDead(arg0 context.Context, arg1 string, arg2 int64) ([]*queue.WebRequest, error) {
+	ret := m.ctrl.Call(m, "PeekDead", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]*queue.WebRequest)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PeekDead indicates an expected call of PeekDead
+func (mr *MockQueueMockRecorder) PeekDead(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PeekDead", reflect.TypeOf((*MockQueue)(nil).PeekDead), arg0, arg1, arg2)
+}
+
+// RequeueDead mocks base method
+func (m *MockQueue) RequeueDead(arg0 context.Context, arg1 string) (int64, error) {
+	ret := m.ctrl.Call(m, "RequeueDead", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RequeueDead indicates an expected call of RequeueDead
+func (mr *MockQueueMockRecorder) RequeueDead(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequeueDead", reflect.TypeOf((*MockQueue)(nil).RequeueDead), arg0, arg1)
+}
+
+// MockHealthChecker is a mock of HealthChecker interface
+type MockHealthChecker struct {
+	ctrl     *gomock.Controller
+	recorder *MockHealthCheckerMockRecorder
+}
+
+// MockHealthCheckerMockRecorder is the mock recorder for MockHealthChecker
+type MockHealthCheckerMockRecorder struct {
+	mock *MockHealthChecker
+}
+
+// NewMockHealthChecker creates a new mock instance
+func NewMockHealthChecker(ctrl *gomock.Controller) *MockHealthChecker {
+	mock := &MockHealthChecker{ctrl: ctrl}
+	mock.recorder = &MockHealthCheckerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockHealthChecker) EXPECT() *MockHealthCheckerMockRecorder {
+	return m.recorder
+}
+
+// HealthCheck mocks base method
+func (m *MockHealthChecker) HealthCheck(arg0 context.Context) error {
+	ret := m.ctrl.Call(m, "HealthCheck", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// HealthCheck indicates an expected call of HealthCheck
+func (mr *MockHealthCheckerMockRecorder) HealthCheck(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HealthCheck", reflect.TypeOf((*MockHealthChecker)(nil).HealthCheck), arg0)
+}
+
+// MockAdministrator is a mock of Administrator interface
+type MockAdministrator struct {
+	ctrl     *gomock.Controller
+	recorder *MockAdministratorMockRecorder
+}
+
+// MockAdministratorMockRecorder is the mock recorder for MockAdministrator
+type MockAdministratorMockRecorder struct {
+	mock *MockAdministrator
+}
+
+// NewMockAdministrator creates a new mock instance
+func NewMockAdministrator(ctrl *gomock.Controller) *MockAdministrator {
+	mock := &MockAdministrator{ctrl: ctrl}
+	mock.recorder = &MockAdministratorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockAdministrator) EXPECT() *MockAdministratorMockRecorder {
+	return m.recorder
+}
+
+// ListQueues mocks base method
+func (m *MockAdministrator) ListQueues(arg0 context.Context) ([]string, error) {
+	ret := m.ctrl.Call(m, "ListQueues", arg0)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListQueues indicates an expected call of ListQueues
+func (mr *MockAdministratorMockRecorder) ListQueues(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListQueues", reflect.TypeOf((*MockAdministrator)(nil).ListQueues), arg0)
+}
+
+// Stats mocks base method
+func (m *MockAdministrator) Stats(arg0 context.Context, arg1 string) (*queue.QueueStats, error) {
+	ret := m.ctrl.Call(m, "Stats", arg0, arg1)
+	ret0, _ := ret[0].(*queue.QueueStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stats indicates an expected call of Stats
+func (mr *MockAdministratorMockRecorder) Stats(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockAdministrator)(nil).Stats), arg0, arg1)
+}
+
+// Purge mocks base method
+func (m *MockAdministrator) Purge(arg0 context.Context, arg1 string) (int64, error) {
+	ret := m.ctrl.Call(m, "Purge", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Purge indicates an expected call of Purge
+func (mr *MockAdministratorMockRecorder) Purge(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*MockAdministrator)(nil).Purge), arg0, arg1)
+}
+
+// Delete mocks base method
+func (m *MockAdministrator) Delete(arg0 context.Context, arg1 string) error {
+	ret := m.ctrl.Call(m, "Delete", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete
+func (mr *MockAdministratorMockRecorder) Delete(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockAdministrator)(nil).Delete), arg0, arg1)
+}
+
+// MockStatsBatcher is a mock of StatsBatcher interface
+type MockStatsBatcher struct {
+	ctrl     *gomock.Controller
+	recorder *MockStatsBatcherMockRecorder
+}
+
+// MockStatsBatcherMockRecorder is the mock recorder for MockStatsBatcher
+type MockStatsBatcherMockRecorder struct {
+	mock *MockStatsBatcher
+}
+
+// NewMockStatsBatcher creates a new mock instance
+func NewMockStatsBatcher(ctrl *gomock.Controller) *MockStatsBatcher {
+	mock := &MockStatsBatcher{ctrl: ctrl}
+	mock.recorder = &MockStatsBatcherMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockStatsBatcher) EXPECT() *MockStatsBatcherMockRecorder {
+	return m.recorder
+}
+
+// StatsBatch mocks base method
+func (m *MockStatsBatcher) StatsBatch(arg0 context.Context, arg1 []string) ([]*queue.QueueStats, error) {
+	ret := m.ctrl.Call(m, "StatsBatch", arg0, arg1)
+	ret0, _ := ret[0].([]*queue.QueueStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StatsBatch indicates an expected call of StatsBatch
+func (mr *MockStatsBatcherMockRecorder) StatsBatch(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StatsBatch", reflect.TypeOf((*MockStatsBatcher)(nil).StatsBatch), arg0, arg1)
+}
+
+// MockExpirer is a mock of Expirer interface
+type MockExpirer struct {
+	ctrl     *gomock.Controller
+	recorder *MockExpirerMockRecorder
+}
+
+// MockExpirerMockRecorder is the mock recorder for MockExpirer
+type MockExpirerMockRecorder struct {
+	mock *MockExpirer
+}
+
+// NewMockExpirer creates a new mock instance
+func NewMockExpirer(ctrl *gomock.Controller) *MockExpirer {
+	mock := &MockExpirer{ctrl: ctrl}
+	mock.recorder = &MockExpirerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockExpirer) EXPECT() *MockExpirerMockRecorder {
+	return m.recorder
+}
+
+// Expire mocks base method
+func (m *MockExpirer) Expire(arg0 context.Context, arg1 string, arg2 time.Time) (int64, error) {
+	ret := m.ctrl.Call(m, "Expire", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Expire indicates an expected call of Expire
+func (mr *MockExpirerMockRecorder) Expire(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Expire", reflect.TypeOf((*MockExpirer)(nil).Expire), arg0, arg1, arg2)
+}
+
+// MockLimiter is a mock of Limiter interface
+type MockLimiter struct {
+	ctrl     *gomock.Controller
+	recorder *MockLimiterMockRecorder
+}
+
+// MockLimiterMockRecorder is the mock recorder for MockLimiter
+type MockLimiterMockRecorder struct {
+	mock *MockLimiter
+}
+
+// NewMockLimiter creates a new mock instance
+func NewMockLimiter(ctrl *gomock.Controller) *MockLimiter {
+	mock := &MockLimiter{ctrl: ctrl}
+	mock.recorder = &MockLimiterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockLimiter) EXPECT() *MockLimiterMockRecorder {
+	return m.recorder
+}
+
+// PushLimited mocks base method
+func (m *MockLimiter) PushLimited(arg0 context.Context, arg1 string, arg2 []*queue.WebRequest, arg3 queue.Limits) (int64, error) {
+	ret := m.ctrl.Call(m, "PushLimited", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PushLimited indicates an expected call of PushLimited
+func (mr *MockLimiterMockRecorder) PushLimited(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PushLimited", reflect.TypeOf((*MockLimiter)(nil).PushLimited), arg0, arg1, arg2, arg3)
+}
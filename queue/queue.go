@@ -3,41 +3,226 @@ package queue
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/WillAbides/xqsmee/metrics"
 	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 //go:generate protoc --go_out=plugins=grpc:. queue.proto
 //go:generate mockgen -destination mockqueue/mockqueue.go -package mockqueue -source=queue.go
 
+//DefaultLeaseDuration is how long a popped item stays reserved when a queue doesn't say otherwise
+const DefaultLeaseDuration = 30 * time.Second
+
+//HealthCheckTimeout is how long CheckHealth waits for a backend to answer
+const HealthCheckTimeout = 5 * time.Second
+
+//DefaultMaxBodySize is the largest body in bytes NewWebRequestFromHTTPRequest reads when it isn't given a limit
+const DefaultMaxBodySize = 10 << 20
+
 var (
 	errInvalidArgument = errors.New("invalid argument")
 	errNilReq          = errors.Wrap(errInvalidArgument, "req is nil")
+
+	//ErrNotInFlight is returned when acking or nacking an id that is not reserved, usually because its lease expired
+	ErrNotInFlight = errors.New("id is not in flight")
+
+	//ErrBodyTooLarge is returned when an http request's body is larger than the limit it is read with
+	ErrBodyTooLarge = errors.New("request body is too large")
+
+	errStopped     = status.Error(codes.Unavailable, "server is shutting down")
+	errNoQueueName = status.Error(codes.InvalidArgument, "QueueName is required")
+	errBadCount    = status.Error(codes.InvalidArgument, "Count can't be negative")
+
+	pops       = metrics.NewCounterVec("xqsmee_pops_total", "items handed to grpc clients", "queue")
+	grpcPushes = metrics.NewCounterVec("xqsmee_grpc_pushes_total", "items added to a queue over grpc", "queue")
+	grpcPeek   = metrics.NewCounterVec("xqsmee_grpc_peeks_total", "grpc peeks at a queue or its dead-letter list", "queue")
+	popWait    = metrics.NewHistogramVec("xqsmee_pop_wait_seconds", "how long pops wait for an item, by whether they got one",
+		[]float64{.01, .1, 1, 5, 10, 30, 60, 300}, "result")
 )
 
+//IsNotInFlight reports whether err is ErrNotInFlight, including when it comes back from an Ack or Nack rpc
+func IsNotInFlight(err error) bool {
+	if errors.Cause(err) == ErrNotInFlight {
+		return true
+	}
+	s, ok := status.FromError(err)
+	return ok && s.Message() == ErrNotInFlight.Error()
+}
+
 type (
 	//Queue is a queue
 	Queue interface {
 		Peek(context.Context, string, int64) ([]*WebRequest, error)
 		Pop(context.Context, string, time.Duration) (*WebRequest, error)
 		Push(context.Context, string, []*WebRequest) error
+		Ack(context.Context, string, string) error
+		Nack(context.Context, string, string) error
+		PeekDead(context.Context, string, int64) ([]*WebRequest, error)
+		RequeueDead(context.Context, string) (int64, error)
+	}
+
+	//HealthChecker is implemented by queues that can tell whether their backend is reachable
+	HealthChecker interface {
+		HealthCheck(context.Context) error
+	}
+
+	//Administrator is implemented by queues that can list, describe and clear their queues
+	Administrator interface {
+		ListQueues(context.Context) ([]string, error)
+		Stats(context.Context, string) (*QueueStats, error)
+		Purge(context.Context, string) (int64, error)
+		Delete(context.Context, string) error
+	}
+
+	//StatsBatcher is implemented by Administrators that can describe many queues in fewer round trips than calling
+	//Stats for each
+	StatsBatcher interface {
+		//StatsBatch describes the named queues, in the same order
+		StatsBatch(context.Context, []string) ([]*QueueStats, error)
+	}
+
+	//Expirer is implemented by queues that can discard old items
+	Expirer interface {
+		//Expire discards waiting items and dead letters received before a time and returns how many it discarded
+		Expire(context.Context, string, time.Time) (int64, error)
+	}
+
+	//Limiter is implemented by queues that can cap how much a queue holds
+	Limiter interface {
+		//PushLimited pushes like Push while keeping the waiting items within Limits. It returns how many items were
+		//dropped, and ErrMaxItems or ErrMaxBytes when the limits reject the push.
+		PushLimited(context.Context, string, []*WebRequest, Limits) (int64, error)
 	}
 
 	//GRPCHandler handle grpc requests
 	GRPCHandler struct {
-		q Queue
+		// LeaseDuration is how long Subscribe waits for an ack before giving up on an item. It should match the queue's.
+		LeaseDuration time.Duration
+		q             Queue
+		outstanding   *outstandingItems
+		stopOnce      sync.Once
+		stopped       chan struct{}
+	}
+
+	// outstandingItems tracks items sent by Subscribe that haven't been acked or nacked yet
+	outstandingItems struct {
+		sync.Mutex
+		items map[string]*outstandingItem
+	}
+
+	outstandingItem struct {
+		release func()
+		timer   *time.Timer
 	}
 )
 
+//CheckHealth runs q's HealthCheck, giving it up to HealthCheckTimeout. Queues that aren't HealthCheckers are always healthy.
+func CheckHealth(ctx context.Context, q Queue) error {
+	checker, ok := q.(HealthChecker)
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, HealthCheckTimeout)
+	defer cancel()
+	return checker.HealthCheck(ctx)
+}
+
 //NewGRPCHandler returns a new GRPCHandler
 func NewGRPCHandler(q Queue) *GRPCHandler {
-	return &GRPCHandler{q: q}
+	return &GRPCHandler{
+		LeaseDuration: DefaultLeaseDuration,
+		q:             q,
+		outstanding:   &outstandingItems{items: map[string]*outstandingItem{}},
+		stopped:       make(chan struct{}),
+	}
+}
+
+//Stop makes waiting Pop calls return empty and ends Subscribe streams, so the grpc server can stop gracefully
+func (g *GRPCHandler) Stop() {
+	g.stopOnce.Do(func() {
+		close(g.stopped)
+	})
+}
+
+// popContext returns a context that is also canceled when g is stopped
+func (g *GRPCHandler) popContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-g.stopped:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// pop pops from the queue and records how long it waited
+func (g *GRPCHandler) pop(ctx context.Context, queueName string, timeout time.Duration) (*WebRequest, error) {
+	start := time.Now()
+	webRequest, err := g.q.Pop(ctx, queueName, timeout)
+	result := "item"
+	switch {
+	case err != nil:
+		result = "error"
+	case webRequest == nil:
+		result = "empty"
+	}
+	popWait.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	return webRequest, err
+}
+
+// nackUndelivered hands back an item that was popped for a client that can't receive it anymore
+func (g *GRPCHandler) nackUndelivered(queueName, id string) {
+	err := g.q.Nack(context.Background(), queueName, id)
+	if err != nil {
+		log.Println("failed nacking undelivered item: ", err)
+	}
+}
+
+func outstandingKey(queueName, id string) string {
+	return queueName + "\x00" + id
+}
+
+// add calls release when the item is acked, nacked or its lease expires
+func (o *outstandingItems) add(queueName, id string, leaseDuration time.Duration, release func()) {
+	key := outstandingKey(queueName, id)
+	o.Lock()
+	defer o.Unlock()
+	o.items[key] = &outstandingItem{
+		release: release,
+		timer: time.AfterFunc(leaseDuration, func() {
+			o.done(queueName, id)
+		}),
+	}
+}
+
+func (o *outstandingItems) done(queueName, id string) {
+	key := outstandingKey(queueName, id)
+	o.Lock()
+	item := o.items[key]
+	delete(o.items, key)
+	o.Unlock()
+	if item != nil {
+		item.timer.Stop()
+		item.release()
+	}
 }
 
 //Pop pops an item off the queue
@@ -47,16 +232,131 @@ func (g *GRPCHandler) Pop(ctx context.Context, request *PopRequest) (*PopRespons
 	if timeout != nil {
 		duration = time.Duration(timeout.GetNanos()) + time.Duration(timeout.GetSeconds())*time.Second
 	}
-	webRequest, err := g.q.Pop(ctx, request.GetQueueName(), duration)
+	popCtx, cancel := g.popContext(ctx)
+	defer cancel()
+	webRequest, err := g.pop(popCtx, request.GetQueueName(), duration)
+	if webRequest != nil && ctx.Err() != nil {
+		g.nackUndelivered(request.GetQueueName(), webRequest.GetID())
+		return nil, ctx.Err()
+	}
+	if webRequest != nil {
+		pops.WithLabelValues(metrics.QueueLabel(request.GetQueueName())).Inc()
+	}
 	return &PopResponse{WebRequest: webRequest}, err
 }
 
-//Peek shows the next few items in the queue
+//Peek shows the next few items in the queue or its dead-letter list
 func (g *GRPCHandler) Peek(ctx context.Context, request *PeekRequest) (*PeekResponse, error) {
-	webRequests, err := g.q.Peek(ctx, request.GetQueueName(), request.GetCount())
+	if request.GetCount() < 0 {
+		return nil, errBadCount
+	}
+	grpcPeek.WithLabelValues(metrics.QueueLabel(request.GetQueueName())).Inc()
+	peek := g.q.Peek
+	if request.GetDeadLetter() {
+		peek = g.q.PeekDead
+	}
+	webRequests, err := peek(ctx, request.GetQueueName(), request.GetCount())
 	return &PeekResponse{WebRequest: webRequests}, err
 }
 
+//Ack confirms delivery of a popped item
+func (g *GRPCHandler) Ack(ctx context.Context, request *AckRequest) (*AckResponse, error) {
+	err := g.q.Ack(ctx, request.GetQueueName(), request.GetID())
+	g.outstanding.done(request.GetQueueName(), request.GetID())
+	return &AckResponse{}, err
+}
+
+//Nack returns a popped item to the queue
+func (g *GRPCHandler) Nack(ctx context.Context, request *NackRequest) (*NackResponse, error) {
+	err := g.q.Nack(ctx, request.GetQueueName(), request.GetID())
+	g.outstanding.done(request.GetQueueName(), request.GetID())
+	return &NackResponse{}, err
+}
+
+//Subscribe streams items off the queue, keeping no more than MaxOutstanding unacked items at a time
+func (g *GRPCHandler) Subscribe(request *SubscribeRequest, stream Queue_SubscribeServer) error {
+	ctx := stream.Context()
+	queueName := request.GetQueueName()
+	maxOutstanding := request.GetMaxOutstanding()
+	if maxOutstanding < 1 {
+		maxOutstanding = 1
+	}
+	slots := make(chan struct{}, maxOutstanding)
+	popCtx, cancel := g.popContext(ctx)
+	defer cancel()
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		case <-g.stopped:
+			return errStopped
+		}
+		webRequest, err := g.pop(popCtx, queueName, 0)
+		if err != nil {
+			return err
+		}
+		if webRequest == nil {
+			<-slots
+			continue
+		}
+		id := webRequest.GetID()
+		g.outstanding.add(queueName, id, g.LeaseDuration, func() {
+			<-slots
+		})
+		err = stream.Send(webRequest)
+		if err != nil {
+			g.outstanding.done(queueName, id)
+			g.nackUndelivered(queueName, id)
+			return err
+		}
+		pops.WithLabelValues(metrics.QueueLabel(queueName)).Inc()
+	}
+}
+
+//RequeueDead moves everything in the dead-letter list back to the queue
+func (g *GRPCHandler) RequeueDead(ctx context.Context, request *RequeueDeadRequest) (*RequeueDeadResponse, error) {
+	count, err := g.q.RequeueDead(ctx, request.GetQueueName())
+	return &RequeueDeadResponse{Count: count}, err
+}
+
+//Push adds items to the queue with IDs and attempts cleared. Items without ReceivedAt get the current time.
+func (g *GRPCHandler) Push(ctx context.Context, request *PushRequest) (*PushResponse, error) {
+	queueName := request.GetQueueName()
+	if queueName == "" {
+		return nil, errNoQueueName
+	}
+	if len(request.GetWebRequest()) == 0 {
+		return &PushResponse{}, nil
+	}
+	now := ptypes.TimestampNow()
+	webRequests := make([]*WebRequest, 0, len(request.GetWebRequest()))
+	for _, webRequest := range request.GetWebRequest() {
+		if webRequest == nil {
+			return nil, status.Error(codes.InvalidArgument, "WebRequest can't be null")
+		}
+		webRequest = proto.Clone(webRequest).(*WebRequest)
+		webRequest.ID = ""
+		webRequest.Attempts = 0
+		if webRequest.ReceivedAt == nil {
+			webRequest.ReceivedAt = now
+		}
+		webRequests = append(webRequests, webRequest)
+	}
+	err := g.q.Push(ctx, queueName, webRequests)
+	if err != nil {
+		return nil, err
+	}
+	grpcPushes.WithLabelValues(metrics.QueueLabel(queueName)).Add(float64(len(webRequests)))
+	return &PushResponse{Count: int64(len(webRequests))}, nil
+}
+
+//ReceivedBefore reports whether w was received before t. Items without ReceivedAt never are.
+func (w *WebRequest) ReceivedBefore(t time.Time) bool {
+	receivedAt, err := ptypes.Timestamp(w.GetReceivedAt())
+	return err == nil && receivedAt.Before(t)
+}
+
 func getHeadersFromHTTPRequest(req *http.Request) []*Header {
 	headers := []*Header{}
 	if req != nil {
@@ -67,9 +367,10 @@ func getHeadersFromHTTPRequest(req *http.Request) []*Header {
 	return headers
 }
 
-func readBodyFromHTTPRequest(req *http.Request) (string, error) {
+// readBodyFromHTTPRequest reads up to maxBodySize bytes of req's body. Bodies that are larger get ErrBodyTooLarge.
+func readBodyFromHTTPRequest(req *http.Request, maxBodySize int64) ([]byte, error) {
 	if req == nil {
-		return "", errNilReq
+		return nil, errNilReq
 	}
 	defer func() {
 		err := req.Body.Close()
@@ -77,20 +378,40 @@ func readBodyFromHTTPRequest(req *http.Request) (string, error) {
 			log.Println("failed closing request body: ", err)
 		}
 	}()
-	body, err := ioutil.ReadAll(req.Body)
+	if req.ContentLength > maxBodySize {
+		return nil, ErrBodyTooLarge
+	}
+	// reading one byte past the limit tells a body that is too large from one that is exactly the limit
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, maxBodySize+1))
 	if err != nil {
-		return "", errors.Wrap(err, "failed reading body")
+		return nil, errors.Wrap(err, "failed reading body")
+	}
+	if int64(len(body)) > maxBodySize {
+		return nil, ErrBodyTooLarge
 	}
 	req.Body = ioutil.NopCloser(bytes.NewReader(body))
-	return string(body), nil
+	return body, nil
+}
+
+func bodyEncoding(body []byte) BodyEncoding {
+	if utf8.Valid(body) {
+		return BodyEncoding_UTF8
+	}
+	return BodyEncoding_BASE64
 }
 
-//NewWebRequestFromHTTPRequest is a helper to build a WebRequest from an HTTP request
-func NewWebRequestFromHTTPRequest(req *http.Request, receivedAt time.Time) (*WebRequest, error) {
+//NewWebRequestFromHTTPRequest is a helper to build a WebRequest from an HTTP request. Path is the request's path with
+//pathPrefix removed. It reads at most maxBodySize bytes of the body, or DefaultMaxBodySize when maxBodySize isn't
+//positive, and returns ErrBodyTooLarge for larger bodies.
+func NewWebRequestFromHTTPRequest(req *http.Request, pathPrefix string, receivedAt time.Time,
+	maxBodySize int64) (*WebRequest, error) {
 	if req == nil {
 		return nil, errNilReq
 	}
-	body, err := readBodyFromHTTPRequest(req)
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultMaxBodySize
+	}
+	body, err := readBodyFromHTTPRequest(req, maxBodySize)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed reading request body")
 	}
@@ -99,23 +420,90 @@ func NewWebRequestFromHTTPRequest(req *http.Request, receivedAt time.Time) (*Web
 		return nil, err
 	}
 	return &WebRequest{
-		ReceivedAt: ts,
-		Header:     getHeadersFromHTTPRequest(req),
-		Body:       body,
-		Host:       req.Host,
+		ReceivedAt:   ts,
+		Header:       getHeadersFromHTTPRequest(req),
+		Body:         body,
+		BodyEncoding: bodyEncoding(body),
+		Host:         req.Host,
+		Method:       req.Method,
+		Path:         strings.TrimPrefix(req.URL.Path, pathPrefix),
+		RawQuery:     req.URL.RawQuery,
+		RemoteAddr:   req.RemoteAddr,
+		Proto:        req.Proto,
 	}, nil
 }
 
-// MarshalJSON creates a json representation of q WebRequest
+// MarshalJSON creates a json representation of q WebRequest. The body is a plain string when it is valid utf-8.
+// Otherwise it is base64 encoded and BodyEncoding is BASE64. Fields are in the same order jsonpb writes them.
 func (w *WebRequest) MarshalJSON() ([]byte, error) {
-	s, err := new(jsonpb.Marshaler).MarshalToString(w)
+	// jsonpb writes the fields before Body and the ones after it, and Body goes between them
+	before := &WebRequest{ReceivedAt: w.GetReceivedAt(), Header: w.GetHeader(), Host: w.GetHost()}
+	after := proto.Clone(w).(*WebRequest)
+	after.ReceivedAt, after.Header, after.Host, after.Body = nil, nil, "", nil
+	after.BodyEncoding = bodyEncoding(w.GetBody())
+	var fields [][]byte
+	for _, part := range []*WebRequest{before, after} {
+		s, err := new(jsonpb.Marshaler).MarshalToString(part)
+		if err != nil {
+			return nil, err
+		}
+		if s != "{}" {
+			fields = append(fields, []byte(s[1:len(s)-1]))
+		}
+		if part != before || len(w.GetBody()) == 0 {
+			continue
+		}
+		body, err := marshalBody(w.GetBody(), after.BodyEncoding)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, append([]byte(`"Body":`), body...))
+	}
+	return append(append([]byte("{"), bytes.Join(fields, []byte(","))...), '}'), nil
+}
+
+// marshalBody writes a body as a json string without escaping html, so it reads the same as the request did
+func marshalBody(body []byte, encoding BodyEncoding) ([]byte, error) {
+	s := string(body)
+	if encoding == BodyEncoding_BASE64 {
+		s = base64.StdEncoding.EncodeToString(body)
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(s)
 	if err != nil {
 		return nil, err
 	}
-	return []byte(s), nil
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
 }
 
 //UnmarshalJSON builds a WebRequest from JSON
 func (w *WebRequest) UnmarshalJSON(src []byte) error {
-	return jsonpb.UnmarshalString(string(src), w)
+	fields := map[string]json.RawMessage{}
+	err := json.Unmarshal(src, &fields)
+	if err != nil {
+		return err
+	}
+	rawBody, hasBody := fields["Body"]
+	delete(fields, "Body")
+	withoutBody, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	err = jsonpb.UnmarshalString(string(withoutBody), w)
+	if err != nil || !hasBody {
+		return err
+	}
+	var body string
+	err = json.Unmarshal(rawBody, &body)
+	if err != nil {
+		return errors.Wrap(err, "Body is not a string")
+	}
+	if w.BodyEncoding == BodyEncoding_BASE64 {
+		w.Body, err = base64.StdEncoding.DecodeString(body)
+		return errors.Wrap(err, "failed decoding base64 Body")
+	}
+	w.Body = []byte(body)
+	return nil
 }
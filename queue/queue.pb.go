@@ -25,6 +25,32 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
+// BodyEncoding is how a WebRequest's body is written in json
+type BodyEncoding int32
+
+const (
+	// UTF8 bodies are written as a plain string
+	BodyEncoding_UTF8 BodyEncoding = 0
+	// BASE64 bodies are not valid utf-8, so they are base64 encoded
+	BodyEncoding_BASE64 BodyEncoding = 1
+)
+
+var BodyEncoding_name = map[int32]string{
+	0: "UTF8",
+	1: "BASE64",
+}
+var BodyEncoding_value = map[string]int32{
+	"UTF8":   0,
+	"BASE64": 1,
+}
+
+func (x BodyEncoding) String() string {
+	return proto.EnumName(BodyEncoding_name, int32(x))
+}
+func (BodyEncoding) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_queue_a395565a916eab6c, []int{0}
+}
+
 type Header struct {
 	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
 	Value                []string `protobuf:"bytes,2,rep,name=value,proto3" json:"value,omitempty"`
@@ -37,7 +63,7 @@ func (m *Header) Reset()         { *m = Header{} }
 func (m *Header) String() string { return proto.CompactTextString(m) }
 func (*Header) ProtoMessage()    {}
 func (*Header) Descriptor() ([]byte, []int) {
-	return fileDescriptor_queue_a1db7d3982343bc1, []int{0}
+	return fileDescriptor_queue_a395565a916eab6c, []int{0}
 }
 func (m *Header) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_Header.Unmarshal(m, b)
@@ -72,20 +98,30 @@ func (m *Header) GetValue() []string {
 }
 
 type WebRequest struct {
-	ReceivedAt           *timestamp.Timestamp `protobuf:"bytes,1,opt,name=ReceivedAt,proto3" json:"ReceivedAt,omitempty"`
-	Header               []*Header            `protobuf:"bytes,2,rep,name=Header,proto3" json:"Header,omitempty"`
-	Host                 string               `protobuf:"bytes,3,opt,name=Host,proto3" json:"Host,omitempty"`
-	Body                 string               `protobuf:"bytes,4,opt,name=Body,proto3" json:"Body,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
-	XXX_unrecognized     []byte               `json:"-"`
-	XXX_sizecache        int32                `json:"-"`
+	ReceivedAt *timestamp.Timestamp `protobuf:"bytes,1,opt,name=ReceivedAt,proto3" json:"ReceivedAt,omitempty"`
+	Header     []*Header            `protobuf:"bytes,2,rep,name=Header,proto3" json:"Header,omitempty"`
+	Host       string               `protobuf:"bytes,3,opt,name=Host,proto3" json:"Host,omitempty"`
+	// Body used to be a string. bytes has the same wire format, so items stored before the change still decode.
+	Body     []byte `protobuf:"bytes,4,opt,name=Body,proto3" json:"Body,omitempty"`
+	ID       string `protobuf:"bytes,5,opt,name=ID,proto3" json:"ID,omitempty"`
+	Attempts int64  `protobuf:"varint,6,opt,name=Attempts,proto3" json:"Attempts,omitempty"`
+	Method   string `protobuf:"bytes,7,opt,name=Method,proto3" json:"Method,omitempty"`
+	// Path is the part of the url path after the queue's /q/{key}
+	Path                 string       `protobuf:"bytes,8,opt,name=Path,proto3" json:"Path,omitempty"`
+	RawQuery             string       `protobuf:"bytes,9,opt,name=RawQuery,proto3" json:"RawQuery,omitempty"`
+	RemoteAddr           string       `protobuf:"bytes,10,opt,name=RemoteAddr,proto3" json:"RemoteAddr,omitempty"`
+	Proto                string       `protobuf:"bytes,11,opt,name=Proto,proto3" json:"Proto,omitempty"`
+	BodyEncoding         BodyEncoding `protobuf:"varint,12,opt,name=BodyEncoding,proto3,enum=BodyEncoding" json:"BodyEncoding,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
 }
 
 func (m *WebRequest) Reset()         { *m = WebRequest{} }
 func (m *WebRequest) String() string { return proto.CompactTextString(m) }
 func (*WebRequest) ProtoMessage()    {}
 func (*WebRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_queue_a1db7d3982343bc1, []int{1}
+	return fileDescriptor_queue_a395565a916eab6c, []int{1}
 }
 func (m *WebRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_WebRequest.Unmarshal(m, b)
@@ -126,13 +162,69 @@ func (m *WebRequest) GetHost() string {
 	return ""
 }
 
-func (m *WebRequest) GetBody() string {
+func (m *WebRequest) GetBody() []byte {
 	if m != nil {
 		return m.Body
 	}
+	return nil
+}
+
+func (m *WebRequest) GetID() string {
+	if m != nil {
+		return m.ID
+	}
+	return ""
+}
+
+func (m *WebRequest) GetAttempts() int64 {
+	if m != nil {
+		return m.Attempts
+	}
+	return 0
+}
+
+func (m *WebRequest) GetMethod() string {
+	if m != nil {
+		return m.Method
+	}
+	return ""
+}
+
+func (m *WebRequest) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
 	return ""
 }
 
+func (m *WebRequest) GetRawQuery() string {
+	if m != nil {
+		return m.RawQuery
+	}
+	return ""
+}
+
+func (m *WebRequest) GetRemoteAddr() string {
+	if m != nil {
+		return m.RemoteAddr
+	}
+	return ""
+}
+
+func (m *WebRequest) GetProto() string {
+	if m != nil {
+		return m.Proto
+	}
+	return ""
+}
+
+func (m *WebRequest) GetBodyEncoding() BodyEncoding {
+	if m != nil {
+		return m.BodyEncoding
+	}
+	return BodyEncoding_UTF8
+}
+
 type PopRequest struct {
 	QueueName            string             `protobuf:"bytes,1,opt,name=QueueName,proto3" json:"QueueName,omitempty"`
 	Timeout              *duration.Duration `protobuf:"bytes,2,opt,name=Timeout,proto3" json:"Timeout,omitempty"`
@@ -145,7 +237,7 @@ func (m *PopRequest) Reset()         { *m = PopRequest{} }
 func (m *PopRequest) String() string { return proto.CompactTextString(m) }
 func (*PopRequest) ProtoMessage()    {}
 func (*PopRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_queue_a1db7d3982343bc1, []int{2}
+	return fileDescriptor_queue_a395565a916eab6c, []int{2}
 }
 func (m *PopRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_PopRequest.Unmarshal(m, b)
@@ -190,7 +282,7 @@ func (m *PopResponse) Reset()         { *m = PopResponse{} }
 func (m *PopResponse) String() string { return proto.CompactTextString(m) }
 func (*PopResponse) ProtoMessage()    {}
 func (*PopResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_queue_a1db7d3982343bc1, []int{3}
+	return fileDescriptor_queue_a395565a916eab6c, []int{3}
 }
 func (m *PopResponse) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_PopResponse.Unmarshal(m, b)
@@ -220,6 +312,7 @@ func (m *PopResponse) GetWebRequest() *WebRequest {
 type PeekRequest struct {
 	QueueName            string   `protobuf:"bytes,1,opt,name=QueueName,proto3" json:"QueueName,omitempty"`
 	Count                int64    `protobuf:"varint,2,opt,name=Count,proto3" json:"Count,omitempty"`
+	DeadLetter           bool     `protobuf:"varint,3,opt,name=DeadLetter,proto3" json:"DeadLetter,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -229,7 +322,7 @@ func (m *PeekRequest) Reset()         { *m = PeekRequest{} }
 func (m *PeekRequest) String() string { return proto.CompactTextString(m) }
 func (*PeekRequest) ProtoMessage()    {}
 func (*PeekRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_queue_a1db7d3982343bc1, []int{4}
+	return fileDescriptor_queue_a395565a916eab6c, []int{4}
 }
 func (m *PeekRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_PeekRequest.Unmarshal(m, b)
@@ -263,6 +356,13 @@ func (m *PeekRequest) GetCount() int64 {
 	return 0
 }
 
+func (m *PeekRequest) GetDeadLetter() bool {
+	if m != nil {
+		return m.DeadLetter
+	}
+	return false
+}
+
 type PeekResponse struct {
 	WebRequest           []*WebRequest `protobuf:"bytes,1,rep,name=WebRequest,proto3" json:"WebRequest,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
@@ -274,7 +374,7 @@ func (m *PeekResponse) Reset()         { *m = PeekResponse{} }
 func (m *PeekResponse) String() string { return proto.CompactTextString(m) }
 func (*PeekResponse) ProtoMessage()    {}
 func (*PeekResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_queue_a1db7d3982343bc1, []int{5}
+	return fileDescriptor_queue_a395565a916eab6c, []int{5}
 }
 func (m *PeekResponse) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_PeekResponse.Unmarshal(m, b)
@@ -301,143 +401,1253 @@ func (m *PeekResponse) GetWebRequest() []*WebRequest {
 	return nil
 }
 
-func init() {
-	proto.RegisterType((*Header)(nil), "Header")
-	proto.RegisterType((*WebRequest)(nil), "WebRequest")
-	proto.RegisterType((*PopRequest)(nil), "PopRequest")
-	proto.RegisterType((*PopResponse)(nil), "PopResponse")
-	proto.RegisterType((*PeekRequest)(nil), "PeekRequest")
-	proto.RegisterType((*PeekResponse)(nil), "PeekResponse")
+type AckRequest struct {
+	QueueName            string   `protobuf:"bytes,1,opt,name=QueueName,proto3" json:"QueueName,omitempty"`
+	ID                   string   `protobuf:"bytes,2,opt,name=ID,proto3" json:"ID,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-// Reference imports to suppress errors if they are not otherwise used.
-var _ context.Context
-var _ grpc.ClientConn
+func (m *AckRequest) Reset()         { *m = AckRequest{} }
+func (m *AckRequest) String() string { return proto.CompactTextString(m) }
+func (*AckRequest) ProtoMessage()    {}
+func (*AckRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_queue_a395565a916eab6c, []int{6}
+}
+func (m *AckRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AckRequest.Unmarshal(m, b)
+}
+func (m *AckRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AckRequest.Marshal(b, m, deterministic)
+}
+func (dst *AckRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AckRequest.Merge(dst, src)
+}
+func (m *AckRequest) XXX_Size() int {
+	return xxx_messageInfo_AckRequest.Size(m)
+}
+func (m *AckRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_AckRequest.DiscardUnknown(m)
+}
 
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the grpc package it is being compiled against.
-const _ = grpc.SupportPackageIsVersion4
+var xxx_messageInfo_AckRequest proto.InternalMessageInfo
 
-// QueueClient is the client API for Queue service.
-//
-// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
-type QueueClient interface {
-	Pop(ctx context.Context, in *PopRequest, opts ...grpc.CallOption) (*PopResponse, error)
-	Peek(ctx context.Context, in *PeekRequest, opts ...grpc.CallOption) (*PeekResponse, error)
+func (m *AckRequest) GetQueueName() string {
+	if m != nil {
+		return m.QueueName
+	}
+	return ""
 }
 
-type queueClient struct {
-	cc *grpc.ClientConn
+func (m *AckRequest) GetID() string {
+	if m != nil {
+		return m.ID
+	}
+	return ""
 }
 
-func NewQueueClient(cc *grpc.ClientConn) QueueClient {
-	return &queueClient{cc}
+type AckResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-func (c *queueClient) Pop(ctx context.Context, in *PopRequest, opts ...grpc.CallOption) (*PopResponse, error) {
-	out := new(PopResponse)
-	err := c.cc.Invoke(ctx, "/Queue/Pop", in, out, opts...)
-	if err != nil {
-		return nil, err
+func (m *AckResponse) Reset()         { *m = AckResponse{} }
+func (m *AckResponse) String() string { return proto.CompactTextString(m) }
+func (*AckResponse) ProtoMessage()    {}
+func (*AckResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_queue_a395565a916eab6c, []int{7}
+}
+func (m *AckResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AckResponse.Unmarshal(m, b)
+}
+func (m *AckResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AckResponse.Marshal(b, m, deterministic)
+}
+func (dst *AckResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AckResponse.Merge(dst, src)
+}
+func (m *AckResponse) XXX_Size() int {
+	return xxx_messageInfo_AckResponse.Size(m)
+}
+func (m *AckResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_AckResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AckResponse proto.InternalMessageInfo
+
+type NackRequest struct {
+	QueueName            string   `protobuf:"bytes,1,opt,name=QueueName,proto3" json:"QueueName,omitempty"`
+	ID                   string   `protobuf:"bytes,2,opt,name=ID,proto3" json:"ID,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *NackRequest) Reset()         { *m = NackRequest{} }
+func (m *NackRequest) String() string { return proto.CompactTextString(m) }
+func (*NackRequest) ProtoMessage()    {}
+func (*NackRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_queue_a395565a916eab6c, []int{8}
+}
+func (m *NackRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_NackRequest.Unmarshal(m, b)
+}
+func (m *NackRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_NackRequest.Marshal(b, m, deterministic)
+}
+func (dst *NackRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_NackRequest.Merge(dst, src)
+}
+func (m *NackRequest) XXX_Size() int {
+	return xxx_messageInfo_NackRequest.Size(m)
+}
+func (m *NackRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_NackRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_NackRequest proto.InternalMessageInfo
+
+func (m *NackRequest) GetQueueName() string {
+	if m != nil {
+		return m.QueueName
 	}
-	return out, nil
+	return ""
 }
 
-func (c *queueClient) Peek(ctx context.Context, in *PeekRequest, opts ...grpc.CallOption) (*PeekResponse, error) {
-	out := new(PeekResponse)
-	err := c.cc.Invoke(ctx, "/Queue/Peek", in, out, opts...)
-	if err != nil {
-		return nil, err
+func (m *NackRequest) GetID() string {
+	if m != nil {
+		return m.ID
 	}
-	return out, nil
+	return ""
 }
 
-// QueueServer is the server API for Queue service.
-type QueueServer interface {
-	Pop(context.Context, *PopRequest) (*PopResponse, error)
-	Peek(context.Context, *PeekRequest) (*PeekResponse, error)
+type NackResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-func RegisterQueueServer(s *grpc.Server, srv QueueServer) {
-	s.RegisterService(&_Queue_serviceDesc, srv)
+func (m *NackResponse) Reset()         { *m = NackResponse{} }
+func (m *NackResponse) String() string { return proto.CompactTextString(m) }
+func (*NackResponse) ProtoMessage()    {}
+func (*NackResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_queue_a395565a916eab6c, []int{9}
+}
+func (m *NackResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_NackResponse.Unmarshal(m, b)
+}
+func (m *NackResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_NackResponse.Marshal(b, m, deterministic)
+}
+func (dst *NackResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_NackResponse.Merge(dst, src)
+}
+func (m *NackResponse) XXX_Size() int {
+	return xxx_messageInfo_NackResponse.Size(m)
+}
+func (m *NackResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_NackResponse.DiscardUnknown(m)
 }
 
-func _Queue_Pop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(PopRequest)
-	if err := dec(in); err != nil {
-		return nil, err
-	}
-	if interceptor == nil {
-		return srv.(QueueServer).Pop(ctx, in)
-	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/Queue/Pop",
-	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(QueueServer).Pop(ctx, req.(*PopRequest))
-	}
-	return interceptor(ctx, in, info, handler)
+var xxx_messageInfo_NackResponse proto.InternalMessageInfo
+
+type RequeueDeadRequest struct {
+	QueueName            string   `protobuf:"bytes,1,opt,name=QueueName,proto3" json:"QueueName,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-func _Queue_Peek_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(PeekRequest)
-	if err := dec(in); err != nil {
-		return nil, err
+func (m *RequeueDeadRequest) Reset()         { *m = RequeueDeadRequest{} }
+func (m *RequeueDeadRequest) String() string { return proto.CompactTextString(m) }
+func (*RequeueDeadRequest) ProtoMessage()    {}
+func (*RequeueDeadRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_queue_a395565a916eab6c, []int{10}
+}
+func (m *RequeueDeadRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RequeueDeadRequest.Unmarshal(m, b)
+}
+func (m *RequeueDeadRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RequeueDeadRequest.Marshal(b, m, deterministic)
+}
+func (dst *RequeueDeadRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RequeueDeadRequest.Merge(dst, src)
+}
+func (m *RequeueDeadRequest) XXX_Size() int {
+	return xxx_messageInfo_RequeueDeadRequest.Size(m)
+}
+func (m *RequeueDeadRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RequeueDeadRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RequeueDeadRequest proto.InternalMessageInfo
+
+func (m *RequeueDeadRequest) GetQueueName() string {
+	if m != nil {
+		return m.QueueName
 	}
-	if interceptor == nil {
-		return srv.(QueueServer).Peek(ctx, in)
+	return ""
+}
+
+type RequeueDeadResponse struct {
+	Count                int64    `protobuf:"varint,1,opt,name=Count,proto3" json:"Count,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RequeueDeadResponse) Reset()         { *m = RequeueDeadResponse{} }
+func (m *RequeueDeadResponse) String() string { return proto.CompactTextString(m) }
+func (*RequeueDeadResponse) ProtoMessage()    {}
+func (*RequeueDeadResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_queue_a395565a916eab6c, []int{11}
+}
+func (m *RequeueDeadResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RequeueDeadResponse.Unmarshal(m, b)
+}
+func (m *RequeueDeadResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RequeueDeadResponse.Marshal(b, m, deterministic)
+}
+func (dst *RequeueDeadResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RequeueDeadResponse.Merge(dst, src)
+}
+func (m *RequeueDeadResponse) XXX_Size() int {
+	return xxx_messageInfo_RequeueDeadResponse.Size(m)
+}
+func (m *RequeueDeadResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_RequeueDeadResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RequeueDeadResponse proto.InternalMessageInfo
+
+func (m *RequeueDeadResponse) GetCount() int64 {
+	if m != nil {
+		return m.Count
 	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/Queue/Peek",
+	return 0
+}
+
+type PushRequest struct {
+	QueueName            string        `protobuf:"bytes,1,opt,name=QueueName,proto3" json:"QueueName,omitempty"`
+	WebRequest           []*WebRequest `protobuf:"bytes,2,rep,name=WebRequest,proto3" json:"WebRequest,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *PushRequest) Reset()         { *m = PushRequest{} }
+func (m *PushRequest) String() string { return proto.CompactTextString(m) }
+func (*PushRequest) ProtoMessage()    {}
+func (*PushRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_queue_a395565a916eab6c, []int{12}
+}
+func (m *PushRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PushRequest.Unmarshal(m, b)
+}
+func (m *PushRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PushRequest.Marshal(b, m, deterministic)
+}
+func (dst *PushRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PushRequest.Merge(dst, src)
+}
+func (m *PushRequest) XXX_Size() int {
+	return xxx_messageInfo_PushRequest.Size(m)
+}
+func (m *PushRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PushRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PushRequest proto.InternalMessageInfo
+
+func (m *PushRequest) GetQueueName() string {
+	if m != nil {
+		return m.QueueName
 	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(QueueServer).Peek(ctx, req.(*PeekRequest))
+	return ""
+}
+
+func (m *PushRequest) GetWebRequest() []*WebRequest {
+	if m != nil {
+		return m.WebRequest
 	}
-	return interceptor(ctx, in, info, handler)
+	return nil
 }
 
-var _Queue_serviceDesc = grpc.ServiceDesc{
-	ServiceName: "Queue",
-	HandlerType: (*QueueServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "Pop",
-			Handler:    _Queue_Pop_Handler,
-		},
-		{
-			MethodName: "Peek",
-			Handler:    _Queue_Peek_Handler,
-		},
-	},
-	Streams:  []grpc.StreamDesc{},
-	Metadata: "queue.proto",
+type PushResponse struct {
+	Count                int64    `protobuf:"varint,1,opt,name=Count,proto3" json:"Count,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PushResponse) Reset()         { *m = PushResponse{} }
+func (m *PushResponse) String() string { return proto.CompactTextString(m) }
+func (*PushResponse) ProtoMessage()    {}
+func (*PushResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_queue_a395565a916eab6c, []int{13}
 }
+func (m *PushResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PushResponse.Unmarshal(m, b)
+}
+func (m *PushResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PushResponse.Marshal(b, m, deterministic)
+}
+func (dst *PushResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PushResponse.Merge(dst, src)
+}
+func (m *PushResponse) XXX_Size() int {
+	return xxx_messageInfo_PushResponse.Size(m)
+}
+func (m *PushResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_PushResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PushResponse proto.InternalMessageInfo
+
+func (m *PushResponse) GetCount() int64 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+type SubscribeRequest struct {
+	QueueName            string   `protobuf:"bytes,1,opt,name=QueueName,proto3" json:"QueueName,omitempty"`
+	MaxOutstanding       int64    `protobuf:"varint,2,opt,name=MaxOutstanding,proto3" json:"MaxOutstanding,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SubscribeRequest) Reset()         { *m = SubscribeRequest{} }
+func (m *SubscribeRequest) String() string { return proto.CompactTextString(m) }
+func (*SubscribeRequest) ProtoMessage()    {}
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_queue_a395565a916eab6c, []int{14}
+}
+func (m *SubscribeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubscribeRequest.Unmarshal(m, b)
+}
+func (m *SubscribeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubscribeRequest.Marshal(b, m, deterministic)
+}
+func (dst *SubscribeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubscribeRequest.Merge(dst, src)
+}
+func (m *SubscribeRequest) XXX_Size() int {
+	return xxx_messageInfo_SubscribeRequest.Size(m)
+}
+func (m *SubscribeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubscribeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubscribeRequest proto.InternalMessageInfo
+
+func (m *SubscribeRequest) GetQueueName() string {
+	if m != nil {
+		return m.QueueName
+	}
+	return ""
+}
+
+func (m *SubscribeRequest) GetMaxOutstanding() int64 {
+	if m != nil {
+		return m.MaxOutstanding
+	}
+	return 0
+}
+
+// QueueStats describes one queue. The oldest and newest times are from the first and last waiting items.
+type QueueStats struct {
+	QueueName        string               `protobuf:"bytes,1,opt,name=QueueName,proto3" json:"QueueName,omitempty"`
+	Depth            int64                `protobuf:"varint,2,opt,name=Depth,proto3" json:"Depth,omitempty"`
+	InFlight         int64                `protobuf:"varint,3,opt,name=InFlight,proto3" json:"InFlight,omitempty"`
+	Dead             int64                `protobuf:"varint,4,opt,name=Dead,proto3" json:"Dead,omitempty"`
+	OldestReceivedAt *timestamp.Timestamp `protobuf:"bytes,5,opt,name=OldestReceivedAt,proto3" json:"OldestReceivedAt,omitempty"`
+	NewestReceivedAt *timestamp.Timestamp `protobuf:"bytes,6,opt,name=NewestReceivedAt,proto3" json:"NewestReceivedAt,omitempty"`
+	// LastActivity is the last time something was pushed, popped, acked or nacked
+	LastActivity         *timestamp.Timestamp `protobuf:"bytes,7,opt,name=LastActivity,proto3" json:"LastActivity,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *QueueStats) Reset()         { *m = QueueStats{} }
+func (m *QueueStats) String() string { return proto.CompactTextString(m) }
+func (*QueueStats) ProtoMessage()    {}
+func (*QueueStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_queue_a395565a916eab6c, []int{15}
+}
+func (m *QueueStats) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_QueueStats.Unmarshal(m, b)
+}
+func (m *QueueStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_QueueStats.Marshal(b, m, deterministic)
+}
+func (dst *QueueStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QueueStats.Merge(dst, src)
+}
+func (m *QueueStats) XXX_Size() int {
+	return xxx_messageInfo_QueueStats.Size(m)
+}
+func (m *QueueStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_QueueStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QueueStats proto.InternalMessageInfo
+
+func (m *QueueStats) GetQueueName() string {
+	if m != nil {
+		return m.QueueName
+	}
+	return ""
+}
+
+func (m *QueueStats) GetDepth() int64 {
+	if m != nil {
+		return m.Depth
+	}
+	return 0
+}
+
+func (m *QueueStats) GetInFlight() int64 {
+	if m != nil {
+		return m.InFlight
+	}
+	return 0
+}
+
+func (m *QueueStats) GetDead() int64 {
+	if m != nil {
+		return m.Dead
+	}
+	return 0
+}
+
+func (m *QueueStats) GetOldestReceivedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.OldestReceivedAt
+	}
+	return nil
+}
+
+func (m *QueueStats) GetNewestReceivedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.NewestReceivedAt
+	}
+	return nil
+}
+
+func (m *QueueStats) GetLastActivity() *timestamp.Timestamp {
+	if m != nil {
+		return m.LastActivity
+	}
+	return nil
+}
+
+type ListQueuesRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListQueuesRequest) Reset()         { *m = ListQueuesRequest{} }
+func (m *ListQueuesRequest) String() string { return proto.CompactTextString(m) }
+func (*ListQueuesRequest) ProtoMessage()    {}
+func (*ListQueuesRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_queue_a395565a916eab6c, []int{16}
+}
+func (m *ListQueuesRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListQueuesRequest.Unmarshal(m, b)
+}
+func (m *ListQueuesRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListQueuesRequest.Marshal(b, m, deterministic)
+}
+func (dst *ListQueuesRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListQueuesRequest.Merge(dst, src)
+}
+func (m *ListQueuesRequest) XXX_Size() int {
+	return xxx_messageInfo_ListQueuesRequest.Size(m)
+}
+func (m *ListQueuesRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListQueuesRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListQueuesRequest proto.InternalMessageInfo
+
+type ListQueuesResponse struct {
+	Queues               []*QueueStats `protobuf:"bytes,1,rep,name=Queues,proto3" json:"Queues,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *ListQueuesResponse) Reset()         { *m = ListQueuesResponse{} }
+func (m *ListQueuesResponse) String() string { return proto.CompactTextString(m) }
+func (*ListQueuesResponse) ProtoMessage()    {}
+func (*ListQueuesResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_queue_a395565a916eab6c, []int{17}
+}
+func (m *ListQueuesResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListQueuesResponse.Unmarshal(m, b)
+}
+func (m *ListQueuesResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListQueuesResponse.Marshal(b, m, deterministic)
+}
+func (dst *ListQueuesResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListQueuesResponse.Merge(dst, src)
+}
+func (m *ListQueuesResponse) XXX_Size() int {
+	return xxx_messageInfo_ListQueuesResponse.Size(m)
+}
+func (m *ListQueuesResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListQueuesResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListQueuesResponse proto.InternalMessageInfo
+
+func (m *ListQueuesResponse) GetQueues() []*QueueStats {
+	if m != nil {
+		return m.Queues
+	}
+	return nil
+}
+
+type StatsRequest struct {
+	QueueName            string   `protobuf:"bytes,1,opt,name=QueueName,proto3" json:"QueueName,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *StatsRequest) Reset()         { *m = StatsRequest{} }
+func (m *StatsRequest) String() string { return proto.CompactTextString(m) }
+func (*StatsRequest) ProtoMessage()    {}
+func (*StatsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_queue_a395565a916eab6c, []int{18}
+}
+func (m *StatsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StatsRequest.Unmarshal(m, b)
+}
+func (m *StatsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StatsRequest.Marshal(b, m, deterministic)
+}
+func (dst *StatsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StatsRequest.Merge(dst, src)
+}
+func (m *StatsRequest) XXX_Size() int {
+	return xxx_messageInfo_StatsRequest.Size(m)
+}
+func (m *StatsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_StatsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StatsRequest proto.InternalMessageInfo
+
+func (m *StatsRequest) GetQueueName() string {
+	if m != nil {
+		return m.QueueName
+	}
+	return ""
+}
+
+type PurgeRequest struct {
+	QueueName            string   `protobuf:"bytes,1,opt,name=QueueName,proto3" json:"QueueName,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PurgeRequest) Reset()         { *m = PurgeRequest{} }
+func (m *PurgeRequest) String() string { return proto.CompactTextString(m) }
+func (*PurgeRequest) ProtoMessage()    {}
+func (*PurgeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_queue_a395565a916eab6c, []int{19}
+}
+func (m *PurgeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PurgeRequest.Unmarshal(m, b)
+}
+func (m *PurgeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PurgeRequest.Marshal(b, m, deterministic)
+}
+func (dst *PurgeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PurgeRequest.Merge(dst, src)
+}
+func (m *PurgeRequest) XXX_Size() int {
+	return xxx_messageInfo_PurgeRequest.Size(m)
+}
+func (m *PurgeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PurgeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PurgeRequest proto.InternalMessageInfo
+
+func (m *PurgeRequest) GetQueueName() string {
+	if m != nil {
+		return m.QueueName
+	}
+	return ""
+}
+
+type PurgeResponse struct {
+	Count                int64    `protobuf:"varint,1,opt,name=Count,proto3" json:"Count,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PurgeResponse) Reset()         { *m = PurgeResponse{} }
+func (m *PurgeResponse) String() string { return proto.CompactTextString(m) }
+func (*PurgeResponse) ProtoMessage()    {}
+func (*PurgeResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_queue_a395565a916eab6c, []int{20}
+}
+func (m *PurgeResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PurgeResponse.Unmarshal(m, b)
+}
+func (m *PurgeResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PurgeResponse.Marshal(b, m, deterministic)
+}
+func (dst *PurgeResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PurgeResponse.Merge(dst, src)
+}
+func (m *PurgeResponse) XXX_Size() int {
+	return xxx_messageInfo_PurgeResponse.Size(m)
+}
+func (m *PurgeResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_PurgeResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PurgeResponse proto.InternalMessageInfo
+
+func (m *PurgeResponse) GetCount() int64 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+type DeleteRequest struct {
+	QueueName            string   `protobuf:"bytes,1,opt,name=QueueName,proto3" json:"QueueName,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteRequest) Reset()         { *m = DeleteRequest{} }
+func (m *DeleteRequest) String() string { return proto.CompactTextString(m) }
+func (*DeleteRequest) ProtoMessage()    {}
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_queue_a395565a916eab6c, []int{21}
+}
+func (m *DeleteRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteRequest.Unmarshal(m, b)
+}
+func (m *DeleteRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteRequest.Marshal(b, m, deterministic)
+}
+func (dst *DeleteRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteRequest.Merge(dst, src)
+}
+func (m *DeleteRequest) XXX_Size() int {
+	return xxx_messageInfo_DeleteRequest.Size(m)
+}
+func (m *DeleteRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteRequest proto.InternalMessageInfo
+
+func (m *DeleteRequest) GetQueueName() string {
+	if m != nil {
+		return m.QueueName
+	}
+	return ""
+}
+
+type DeleteResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteResponse) Reset()         { *m = DeleteResponse{} }
+func (m *DeleteResponse) String() string { return proto.CompactTextString(m) }
+func (*DeleteResponse) ProtoMessage()    {}
+func (*DeleteResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_queue_a395565a916eab6c, []int{22}
+}
+func (m *DeleteResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteResponse.Unmarshal(m, b)
+}
+func (m *DeleteResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteResponse.Marshal(b, m, deterministic)
+}
+func (dst *DeleteResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteResponse.Merge(dst, src)
+}
+func (m *DeleteResponse) XXX_Size() int {
+	return xxx_messageInfo_DeleteResponse.Size(m)
+}
+func (m *DeleteResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteResponse proto.InternalMessageInfo
+
+func init() {
+	proto.RegisterType((*Header)(nil), "Header")
+	proto.RegisterType((*WebRequest)(nil), "WebRequest")
+	proto.RegisterType((*PopRequest)(nil), "PopRequest")
+	proto.RegisterType((*PopResponse)(nil), "PopResponse")
+	proto.RegisterType((*PeekRequest)(nil), "PeekRequest")
+	proto.RegisterType((*PeekResponse)(nil), "PeekResponse")
+	proto.RegisterType((*AckRequest)(nil), "AckRequest")
+	proto.RegisterType((*AckResponse)(nil), "AckResponse")
+	proto.RegisterType((*NackRequest)(nil), "NackRequest")
+	proto.RegisterType((*NackResponse)(nil), "NackResponse")
+	proto.RegisterType((*RequeueDeadRequest)(nil), "RequeueDeadRequest")
+	proto.RegisterType((*RequeueDeadResponse)(nil), "RequeueDeadResponse")
+	proto.RegisterType((*PushRequest)(nil), "PushRequest")
+	proto.RegisterType((*PushResponse)(nil), "PushResponse")
+	proto.RegisterType((*SubscribeRequest)(nil), "SubscribeRequest")
+	proto.RegisterType((*QueueStats)(nil), "QueueStats")
+	proto.RegisterType((*ListQueuesRequest)(nil), "ListQueuesRequest")
+	proto.RegisterType((*ListQueuesResponse)(nil), "ListQueuesResponse")
+	proto.RegisterType((*StatsRequest)(nil), "StatsRequest")
+	proto.RegisterType((*PurgeRequest)(nil), "PurgeRequest")
+	proto.RegisterType((*PurgeResponse)(nil), "PurgeResponse")
+	proto.RegisterType((*DeleteRequest)(nil), "DeleteRequest")
+	proto.RegisterType((*DeleteResponse)(nil), "DeleteResponse")
+	proto.RegisterEnum("BodyEncoding", BodyEncoding_name, BodyEncoding_value)
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// QueueClient is the client API for Queue service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type QueueClient interface {
+	Pop(ctx context.Context, in *PopRequest, opts ...grpc.CallOption) (*PopResponse, error)
+	Peek(ctx context.Context, in *PeekRequest, opts ...grpc.CallOption) (*PeekResponse, error)
+	Ack(ctx context.Context, in *AckRequest, opts ...grpc.CallOption) (*AckResponse, error)
+	Nack(ctx context.Context, in *NackRequest, opts ...grpc.CallOption) (*NackResponse, error)
+	RequeueDead(ctx context.Context, in *RequeueDeadRequest, opts ...grpc.CallOption) (*RequeueDeadResponse, error)
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Queue_SubscribeClient, error)
+	Push(ctx context.Context, in *PushRequest, opts ...grpc.CallOption) (*PushResponse, error)
+}
+
+type queueClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewQueueClient(cc *grpc.ClientConn) QueueClient {
+	return &queueClient{cc}
+}
+
+func (c *queueClient) Pop(ctx context.Context, in *PopRequest, opts ...grpc.CallOption) (*PopResponse, error) {
+	out := new(PopResponse)
+	err := c.cc.Invoke(ctx, "/Queue/Pop", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) Peek(ctx context.Context, in *PeekRequest, opts ...grpc.CallOption) (*PeekResponse, error) {
+	out := new(PeekResponse)
+	err := c.cc.Invoke(ctx, "/Queue/Peek", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) Ack(ctx context.Context, in *AckRequest, opts ...grpc.CallOption) (*AckResponse, error) {
+	out := new(AckResponse)
+	err := c.cc.Invoke(ctx, "/Queue/Ack", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) Nack(ctx context.Context, in *NackRequest, opts ...grpc.CallOption) (*NackResponse, error) {
+	out := new(NackResponse)
+	err := c.cc.Invoke(ctx, "/Queue/Nack", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) RequeueDead(ctx context.Context, in *RequeueDeadRequest, opts ...grpc.CallOption) (*RequeueDeadResponse, error) {
+	out := new(RequeueDeadResponse)
+	err := c.cc.Invoke(ctx, "/Queue/RequeueDead", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queueClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Queue_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Queue_serviceDesc.Streams[0], "/Queue/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &queueSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Queue_SubscribeClient interface {
+	Recv() (*WebRequest, error)
+	grpc.ClientStream
+}
+
+type queueSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *queueSubscribeClient) Recv() (*WebRequest, error) {
+	m := new(WebRequest)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *queueClient) Push(ctx context.Context, in *PushRequest, opts ...grpc.CallOption) (*PushResponse, error) {
+	out := new(PushResponse)
+	err := c.cc.Invoke(ctx, "/Queue/Push", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// QueueServer is the server API for Queue service.
+type QueueServer interface {
+	Pop(context.Context, *PopRequest) (*PopResponse, error)
+	Peek(context.Context, *PeekRequest) (*PeekResponse, error)
+	Ack(context.Context, *AckRequest) (*AckResponse, error)
+	Nack(context.Context, *NackRequest) (*NackResponse, error)
+	RequeueDead(context.Context, *RequeueDeadRequest) (*RequeueDeadResponse, error)
+	Subscribe(*SubscribeRequest, Queue_SubscribeServer) error
+	Push(context.Context, *PushRequest) (*PushResponse, error)
+}
+
+func RegisterQueueServer(s *grpc.Server, srv QueueServer) {
+	s.RegisterService(&_Queue_serviceDesc, srv)
+}
+
+func _Queue_Pop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PopRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).Pop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Queue/Pop",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).Pop(ctx, req.(*PopRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_Peek_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PeekRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).Peek(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Queue/Peek",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).Peek(ctx, req.(*PeekRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_Ack_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).Ack(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Queue/Ack",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).Ack(ctx, req.(*AckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_Nack_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NackRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).Nack(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Queue/Nack",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).Nack(ctx, req.(*NackRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_RequeueDead_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RequeueDeadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).RequeueDead(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Queue/RequeueDead",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).RequeueDead(ctx, req.(*RequeueDeadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queue_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(QueueServer).Subscribe(m, &queueSubscribeServer{stream})
+}
+
+type Queue_SubscribeServer interface {
+	Send(*WebRequest) error
+	grpc.ServerStream
+}
+
+type queueSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *queueSubscribeServer) Send(m *WebRequest) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Queue_Push_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PushRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueueServer).Push(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Queue/Push",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueueServer).Push(ctx, req.(*PushRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Queue_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "Queue",
+	HandlerType: (*QueueServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Pop",
+			Handler:    _Queue_Pop_Handler,
+		},
+		{
+			MethodName: "Peek",
+			Handler:    _Queue_Peek_Handler,
+		},
+		{
+			MethodName: "Ack",
+			Handler:    _Queue_Ack_Handler,
+		},
+		{
+			MethodName: "Nack",
+			Handler:    _Queue_Nack_Handler,
+		},
+		{
+			MethodName: "RequeueDead",
+			Handler:    _Queue_RequeueDead_Handler,
+		},
+		{
+			MethodName: "Push",
+			Handler:    _Queue_Push_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _Queue_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "queue.proto",
+}
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type AdminClient interface {
+	ListQueues(ctx context.Context, in *ListQueuesRequest, opts ...grpc.CallOption) (*ListQueuesResponse, error)
+	Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*QueueStats, error)
+	// Purge removes the waiting items. In-flight items and dead letters are kept.
+	Purge(ctx context.Context, in *PurgeRequest, opts ...grpc.CallOption) (*PurgeResponse, error)
+	// Delete removes everything in the queue, including in-flight items and dead letters
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+}
+
+type adminClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewAdminClient(cc *grpc.ClientConn) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) ListQueues(ctx context.Context, in *ListQueuesRequest, opts ...grpc.CallOption) (*ListQueuesResponse, error) {
+	out := new(ListQueuesResponse)
+	err := c.cc.Invoke(ctx, "/Admin/ListQueues", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*QueueStats, error) {
+	out := new(QueueStats)
+	err := c.cc.Invoke(ctx, "/Admin/Stats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Purge(ctx context.Context, in *PurgeRequest, opts ...grpc.CallOption) (*PurgeResponse, error) {
+	out := new(PurgeResponse)
+	err := c.cc.Invoke(ctx, "/Admin/Purge", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, "/Admin/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+type AdminServer interface {
+	ListQueues(context.Context, *ListQueuesRequest) (*ListQueuesResponse, error)
+	Stats(context.Context, *StatsRequest) (*QueueStats, error)
+	// Purge removes the waiting items. In-flight items and dead letters are kept.
+	Purge(context.Context, *PurgeRequest) (*PurgeResponse, error)
+	// Delete removes everything in the queue, including in-flight items and dead letters
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+}
+
+func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
+	s.RegisterService(&_Admin_serviceDesc, srv)
+}
+
+func _Admin_ListQueues_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListQueuesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListQueues(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Admin/ListQueues",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListQueues(ctx, req.(*ListQueuesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Admin/Stats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Stats(ctx, req.(*StatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Purge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Purge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Admin/Purge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Purge(ctx, req.(*PurgeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Admin/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Admin_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListQueues",
+			Handler:    _Admin_ListQueues_Handler,
+		},
+		{
+			MethodName: "Stats",
+			Handler:    _Admin_Stats_Handler,
+		},
+		{
+			MethodName: "Purge",
+			Handler:    _Admin_Purge_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Admin_Delete_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "queue.proto",
+}
+
+func init() { proto.RegisterFile("queue.proto", fileDescriptor_queue_a395565a916eab6c) }
 
-func init() { proto.RegisterFile("queue.proto", fileDescriptor_queue_a1db7d3982343bc1) }
-
-var fileDescriptor_queue_a1db7d3982343bc1 = []byte{
-	// 332 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x90, 0x4d, 0x6b, 0xf2, 0x40,
-	0x10, 0x80, 0xd1, 0xf8, 0x81, 0xb3, 0xbe, 0x97, 0xc5, 0x43, 0xde, 0x50, 0xaa, 0xa4, 0x17, 0xa1,
-	0xb0, 0x42, 0xbc, 0xd9, 0x93, 0x6d, 0x0f, 0x9e, 0xc4, 0x2e, 0x85, 0x1e, 0x4b, 0x6c, 0xa6, 0x22,
-	0xd5, 0x4c, 0x34, 0xbb, 0x42, 0x7f, 0x46, 0xff, 0x71, 0xd9, 0x5d, 0x43, 0x96, 0x96, 0x96, 0xde,
-	0xe6, 0x6b, 0xf7, 0x79, 0x66, 0x80, 0x1d, 0x34, 0x6a, 0x14, 0xc5, 0x91, 0x14, 0x45, 0x97, 0x1b,
-	0xa2, 0xcd, 0x0e, 0x27, 0x36, 0x5b, 0xeb, 0xd7, 0x49, 0xa6, 0x8f, 0xa9, 0xda, 0x52, 0x7e, 0xee,
-	0x0f, 0xbf, 0xf6, 0xd5, 0x76, 0x8f, 0xa5, 0x4a, 0xf7, 0x85, 0x1b, 0x88, 0x13, 0xe8, 0x2c, 0x30,
-	0xcd, 0xf0, 0xc8, 0x39, 0xb4, 0xf2, 0x74, 0x8f, 0x61, 0x63, 0xd4, 0x18, 0xf7, 0xa4, 0x8d, 0xf9,
-	0x00, 0xda, 0xa7, 0x74, 0xa7, 0x31, 0x6c, 0x8e, 0x82, 0x71, 0x4f, 0xba, 0x24, 0xfe, 0x68, 0x00,
-	0x3c, 0xe1, 0x5a, 0xe2, 0x41, 0x63, 0xa9, 0xf8, 0x0c, 0x40, 0xe2, 0x0b, 0x6e, 0x4f, 0x98, 0xcd,
-	0x95, 0x7d, 0xce, 0x92, 0x48, 0x38, 0xb0, 0xa8, 0xc0, 0xe2, 0xb1, 0x02, 0x4b, 0x6f, 0x9a, 0x0f,
-	0x2b, 0xbc, 0x25, 0xb0, 0xa4, 0x2b, 0x5c, 0x2a, 0x3d, 0xab, 0x05, 0x95, 0x2a, 0x0c, 0x9c, 0x95,
-	0x89, 0x4d, 0xed, 0x96, 0xb2, 0xf7, 0xb0, 0xe5, 0x6a, 0x26, 0x8e, 0x9f, 0x01, 0x56, 0x54, 0x54,
-	0x4a, 0x17, 0xd0, 0x7b, 0x30, 0x57, 0x5a, 0xd6, 0x0b, 0xd5, 0x05, 0x3e, 0x85, 0xae, 0xb1, 0x21,
-	0xad, 0xc2, 0xa6, 0xb5, 0xfd, 0xff, 0xcd, 0xf6, 0xfe, 0x7c, 0x46, 0x59, 0x4d, 0xc6, 0x33, 0x60,
-	0x16, 0x50, 0x16, 0x94, 0x97, 0xc8, 0xaf, 0xfd, 0x13, 0x9c, 0x97, 0x66, 0xa2, 0x2e, 0x49, 0xaf,
-	0x1d, 0xcf, 0x81, 0xad, 0x10, 0xdf, 0xfe, 0x66, 0x37, 0x80, 0xf6, 0x1d, 0xe9, 0xdc, 0xb9, 0x05,
-	0xd2, 0x25, 0xf1, 0x0d, 0xf4, 0xdd, 0x17, 0x3f, 0xf0, 0x83, 0x5f, 0xf8, 0xc9, 0x12, 0xda, 0xf6,
-	0x7f, 0x3e, 0x82, 0x60, 0x45, 0x05, 0x67, 0xa2, 0xbe, 0x55, 0xd4, 0x17, 0xfe, 0x5e, 0x57, 0xd0,
-	0x32, 0x1c, 0xde, 0x17, 0x9e, 0x71, 0xf4, 0x4f, 0xf8, 0xf0, 0x75, 0xc7, 0xde, 0x69, 0xfa, 0x19,
-	0x00, 0x00, 0xff, 0xff, 0xb7, 0x14, 0xa9, 0x2a, 0x8b, 0x02, 0x00, 0x00,
+var fileDescriptor_queue_a395565a916eab6c = []byte{
+	// 900 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x54, 0xe1, 0x6e, 0xdb, 0x36,
+	0x10, 0x9e, 0xa4, 0xd8, 0x89, 0x4f, 0x92, 0xe7, 0x32, 0xc1, 0xa0, 0x09, 0x43, 0x6b, 0xa8, 0x5d,
+	0xe1, 0xad, 0x2d, 0xbb, 0xb9, 0xdb, 0xd0, 0xa5, 0xc0, 0x00, 0x75, 0x6e, 0xd0, 0x00, 0x69, 0xea,
+	0x32, 0x1d, 0xb6, 0x7f, 0x83, 0x6c, 0x71, 0xb6, 0x50, 0x5b, 0x72, 0x2d, 0x32, 0x5d, 0x9e, 0x67,
+	0xef, 0xb0, 0xdf, 0x7b, 0xa2, 0x3d, 0xc3, 0x40, 0x52, 0xb2, 0xa8, 0x24, 0x8b, 0x85, 0xfe, 0xe3,
+	0x1d, 0x8f, 0xdf, 0x1d, 0xef, 0xbe, 0xfb, 0xc0, 0x7e, 0xcf, 0x29, 0xa7, 0x78, 0xb5, 0xce, 0x58,
+	0xe6, 0xdf, 0x9e, 0x65, 0xd9, 0x6c, 0x41, 0x1f, 0x4b, 0x6b, 0xc2, 0xff, 0x78, 0x1c, 0xf3, 0x75,
+	0xc4, 0x92, 0x2c, 0x2d, 0xee, 0xef, 0x5c, 0xbe, 0x67, 0xc9, 0x92, 0xe6, 0x2c, 0x5a, 0xae, 0x54,
+	0x40, 0x30, 0x84, 0xf6, 0x4b, 0x1a, 0xc5, 0x74, 0x8d, 0x10, 0xec, 0xa4, 0xd1, 0x92, 0x7a, 0x46,
+	0xdf, 0x18, 0x74, 0x88, 0x3c, 0xa3, 0x03, 0x68, 0x9d, 0x47, 0x0b, 0x4e, 0x3d, 0xb3, 0x6f, 0x0d,
+	0x3a, 0x44, 0x19, 0xc1, 0xbf, 0x26, 0xc0, 0xaf, 0x74, 0x42, 0xe8, 0x7b, 0x4e, 0x73, 0x86, 0x0e,
+	0x01, 0x08, 0x9d, 0xd2, 0xe4, 0x9c, 0xc6, 0x21, 0x93, 0xcf, 0xed, 0xa1, 0x8f, 0x55, 0x62, 0x5c,
+	0x26, 0xc6, 0x6f, 0xcb, 0xc4, 0x44, 0x8b, 0x46, 0x77, 0xca, 0xf4, 0x32, 0x83, 0x3d, 0xdc, 0xc5,
+	0xca, 0x24, 0x5a, 0x55, 0x2f, 0xb3, 0x9c, 0x79, 0x96, 0xaa, 0x4a, 0x9c, 0x85, 0xef, 0x79, 0x16,
+	0x5f, 0x78, 0x3b, 0x7d, 0x63, 0xe0, 0x10, 0x79, 0x46, 0x5d, 0x30, 0x8f, 0x47, 0x5e, 0x4b, 0x46,
+	0x99, 0xc7, 0x23, 0xe4, 0xc3, 0x5e, 0xc8, 0x18, 0x5d, 0xae, 0x58, 0xee, 0xb5, 0xfb, 0xc6, 0xc0,
+	0x22, 0x1b, 0x1b, 0x7d, 0x06, 0xed, 0x57, 0x94, 0xcd, 0xb3, 0xd8, 0xdb, 0x95, 0xf1, 0x85, 0x25,
+	0x70, 0xc7, 0x11, 0x9b, 0x7b, 0x7b, 0x2a, 0x97, 0x38, 0x0b, 0x1c, 0x12, 0x7d, 0x78, 0xc3, 0xe9,
+	0xfa, 0xc2, 0xeb, 0x48, 0xff, 0xc6, 0x46, 0xb7, 0xc5, 0xc7, 0x97, 0x19, 0xa3, 0x61, 0x1c, 0xaf,
+	0x3d, 0x90, 0xb7, 0x9a, 0x47, 0x74, 0x6f, 0x2c, 0xbe, 0xef, 0xd9, 0xf2, 0x4a, 0x19, 0xe8, 0x5b,
+	0x70, 0x44, 0xc5, 0x2f, 0xd2, 0x69, 0x16, 0x27, 0xe9, 0xcc, 0x73, 0xfa, 0xc6, 0xa0, 0x3b, 0x74,
+	0xb1, 0xee, 0x24, 0xb5, 0x90, 0xe0, 0x77, 0x80, 0x71, 0xb6, 0x2a, 0xfb, 0xfd, 0x05, 0x74, 0xde,
+	0x70, 0xca, 0xe9, 0x69, 0x35, 0xad, 0xca, 0x81, 0x9e, 0xc0, 0xae, 0x68, 0x75, 0xc6, 0x99, 0x67,
+	0xca, 0x51, 0x7c, 0x7e, 0x65, 0x14, 0xa3, 0x82, 0x23, 0xa4, 0x8c, 0x0c, 0x0e, 0xc1, 0x96, 0x09,
+	0xf2, 0x55, 0x96, 0xe6, 0x14, 0x3d, 0xd0, 0xe7, 0x5b, 0x4c, 0xd4, 0xc6, 0x95, 0x8b, 0x68, 0xd7,
+	0x41, 0x04, 0xf6, 0x98, 0xd2, 0x77, 0xcd, 0xaa, 0x3b, 0x80, 0xd6, 0xcf, 0x19, 0x4f, 0x55, 0x6d,
+	0x16, 0x51, 0x86, 0x68, 0xe4, 0x88, 0x46, 0xf1, 0x09, 0x65, 0x8c, 0xae, 0xe5, 0xa8, 0xf7, 0x88,
+	0xe6, 0x09, 0x9e, 0x81, 0xa3, 0x52, 0xfc, 0x4f, 0x7d, 0xd6, 0x4d, 0xf5, 0x1d, 0x02, 0x84, 0xd3,
+	0x86, 0xe5, 0x29, 0x16, 0x99, 0x25, 0x8b, 0x02, 0x17, 0xec, 0x70, 0xba, 0xc9, 0x1b, 0x3c, 0x03,
+	0xfb, 0x34, 0xfa, 0x58, 0xac, 0x2e, 0x38, 0xa7, 0x91, 0x06, 0x36, 0x04, 0x24, 0x81, 0x38, 0x15,
+	0x3f, 0x6d, 0x84, 0x19, 0x3c, 0x80, 0xfd, 0xda, 0x9b, 0xa2, 0x1f, 0x9b, 0xae, 0x1a, 0x5a, 0x57,
+	0x83, 0xdf, 0xc0, 0x1e, 0xf3, 0x7c, 0xde, 0xac, 0xda, 0x7a, 0x4b, 0xcd, 0x9b, 0x5b, 0x7a, 0x0f,
+	0x1c, 0x85, 0xbc, 0x25, 0x7f, 0xef, 0x8c, 0x4f, 0xf2, 0xe9, 0x3a, 0x99, 0xd0, 0x66, 0x45, 0xdc,
+	0x87, 0xee, 0xab, 0xe8, 0xcf, 0xd7, 0x9c, 0xe5, 0x2c, 0x4a, 0xe5, 0x72, 0x28, 0x9a, 0x5c, 0xf2,
+	0x06, 0xff, 0x98, 0x00, 0xf2, 0xd5, 0x19, 0x8b, 0x58, 0xbe, 0x9d, 0x72, 0x23, 0xba, 0x62, 0xf3,
+	0x92, 0x72, 0xd2, 0x10, 0x7b, 0x7d, 0x9c, 0x1e, 0x2d, 0x92, 0xd9, 0x5c, 0x69, 0x8b, 0x45, 0x36,
+	0xb6, 0xd0, 0x01, 0xd1, 0x5e, 0xa9, 0x2f, 0x16, 0x91, 0x67, 0x74, 0x04, 0xbd, 0xd7, 0x8b, 0x58,
+	0x34, 0xa2, 0x92, 0xba, 0xd6, 0x56, 0xa9, 0xbb, 0xf2, 0x46, 0xe0, 0x9c, 0xd2, 0x0f, 0x75, 0x9c,
+	0xf6, 0x76, 0x9c, 0xcb, 0x6f, 0xd0, 0x4f, 0xe0, 0x9c, 0x44, 0x39, 0x0b, 0xa7, 0x2c, 0x39, 0x4f,
+	0xd8, 0x85, 0xb7, 0xbb, 0x15, 0xa3, 0x16, 0x1f, 0xec, 0xc3, 0xad, 0x93, 0x24, 0x67, 0xb2, 0x4d,
+	0x79, 0x39, 0xd7, 0x1f, 0x01, 0xe9, 0xce, 0x62, 0xba, 0x77, 0xa1, 0xad, 0x3c, 0x9b, 0x4d, 0xab,
+	0x7a, 0x4f, 0x8a, 0xab, 0xe0, 0x21, 0x38, 0xca, 0xd1, 0x88, 0xc7, 0x0f, 0x05, 0x81, 0xd6, 0xb3,
+	0x66, 0xb4, 0x08, 0xbe, 0x04, 0xb7, 0x88, 0xbe, 0x91, 0x6f, 0x8f, 0xc0, 0x1d, 0xd1, 0x05, 0x65,
+	0x0d, 0x51, 0x7b, 0xd0, 0x2d, 0xc3, 0x15, 0xec, 0xd7, 0xf7, 0xea, 0xca, 0x8c, 0xf6, 0x60, 0xe7,
+	0x97, 0xb7, 0x47, 0x4f, 0x7b, 0x9f, 0x20, 0x80, 0xf6, 0xf3, 0xf0, 0xec, 0xc5, 0x0f, 0xdf, 0xf5,
+	0x8c, 0xe1, 0x5f, 0x26, 0xb4, 0x24, 0x0a, 0xea, 0x83, 0x35, 0xce, 0x56, 0xc8, 0xc6, 0x95, 0x38,
+	0xfb, 0x0e, 0xd6, 0x85, 0xf4, 0x2e, 0xec, 0x08, 0xe1, 0x42, 0x0e, 0xd6, 0x24, 0xd2, 0x77, 0x71,
+	0x4d, 0xcd, 0xfa, 0x60, 0x85, 0xd3, 0x77, 0xc8, 0xc6, 0x95, 0x4c, 0xf9, 0x0e, 0xd6, 0x74, 0x47,
+	0xc0, 0x08, 0xe9, 0x40, 0x0e, 0xd6, 0xe4, 0xc7, 0x77, 0xb1, 0xae, 0x27, 0xe8, 0x29, 0xd8, 0x9a,
+	0x36, 0xa0, 0x7d, 0x7c, 0x55, 0x5d, 0xfc, 0x03, 0x7c, 0x9d, 0x7c, 0x3c, 0x82, 0xce, 0x66, 0x51,
+	0xd1, 0x2d, 0x7c, 0x79, 0x69, 0x7d, 0x5d, 0x07, 0xbe, 0x31, 0xe4, 0xa7, 0x78, 0x3e, 0x17, 0x9f,
+	0xaa, 0xe4, 0xc5, 0x77, 0x0b, 0x4b, 0x61, 0x0e, 0xff, 0x36, 0xa0, 0x15, 0xc6, 0xcb, 0x24, 0x45,
+	0xdf, 0x03, 0x54, 0xa4, 0x42, 0x08, 0x5f, 0xa1, 0x9d, 0xbf, 0x8f, 0xaf, 0x65, 0x5d, 0x4b, 0x6d,
+	0xb7, 0x8b, 0x75, 0x62, 0xf9, 0x3a, 0xfb, 0xd0, 0x7d, 0x68, 0x49, 0x66, 0x20, 0x17, 0x17, 0x0c,
+	0x51, 0x41, 0x5d, 0x5c, 0x27, 0xcc, 0x57, 0xd0, 0x56, 0xb3, 0x46, 0x5d, 0x5c, 0xe3, 0x88, 0xff,
+	0x29, 0xae, 0x93, 0x60, 0xd2, 0x96, 0xab, 0xf3, 0xe4, 0xbf, 0x01, 0x00, 0x5a, 0x90, 0x63, 0x77,
+	0x67, 0x09, 0x00, 0x00,
 }
@@ -1,7 +1,11 @@
 package queue_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -9,8 +13,12 @@ import (
 	"github.com/WillAbides/xqsmee/queue/mockqueue"
 	"github.com/golang/mock/gomock"
 	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type testObjects struct {
@@ -35,7 +43,7 @@ func testSetup(t *testing.T) *testObjects {
 		assert:     assert.New(t),
 		require:    require.New(t),
 		T:          t,
-		webRequest: &queue.WebRequest{Body: "hi"},
+		webRequest: &queue.WebRequest{Body: []byte("hi")},
 	}
 }
 
@@ -50,6 +58,39 @@ func TestGRPCHandler_Pop(t *testing.T) {
 	tt.assert.Equal(tt.webRequest, response.GetWebRequest())
 }
 
+func TestGRPCHandler_Pop_stop(t *testing.T) {
+	t.Run("returns empty when stopped", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		grpcHandler := queue.NewGRPCHandler(tt.queue)
+		tt.queue.EXPECT().Pop(gomock.Any(), "asdf", time.Duration(0)).DoAndReturn(
+			func(ctx context.Context, queueName string, timeout time.Duration) (*queue.WebRequest, error) {
+				grpcHandler.Stop()
+				<-ctx.Done()
+				return nil, nil
+			})
+		response, err := grpcHandler.Pop(context.Background(), &queue.PopRequest{QueueName: "asdf"})
+		tt.assert.Nil(err)
+		tt.assert.Nil(response.GetWebRequest())
+	})
+
+	t.Run("nacks items the client is gone for", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		ctx, cancel := context.WithCancel(context.Background())
+		webRequest := &queue.WebRequest{Body: []byte("hi"), ID: "1"}
+		tt.queue.EXPECT().Pop(gomock.Any(), "asdf", time.Duration(0)).DoAndReturn(
+			func(context.Context, string, time.Duration) (*queue.WebRequest, error) {
+				cancel()
+				return webRequest, nil
+			})
+		tt.queue.EXPECT().Nack(gomock.Any(), "asdf", "1").Return(nil)
+		grpcHandler := queue.NewGRPCHandler(tt.queue)
+		_, err := grpcHandler.Pop(ctx, &queue.PopRequest{QueueName: "asdf"})
+		tt.assert.Equal(context.Canceled, err)
+	})
+}
+
 func TestGRPCHandler_Peek(t *testing.T) {
 	tt := testSetup(t)
 	defer tt.teardown()
@@ -60,4 +101,324 @@ func TestGRPCHandler_Peek(t *testing.T) {
 	response, err := grpcHandler.Peek(context.Background(), peekRequest)
 	tt.assert.Nil(err)
 	tt.assert.Equal(expect, response.GetWebRequest())
+
+	_, err = grpcHandler.Peek(context.Background(), &queue.PeekRequest{QueueName: "asdf", Count: -1})
+	tt.assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCHandler_Ack(t *testing.T) {
+	tt := testSetup(t)
+	defer tt.teardown()
+	tt.queue.EXPECT().Ack(gomock.Any(), "asdf", "someid").Return(nil)
+	ackRequest := &queue.AckRequest{QueueName: "asdf", ID: "someid"}
+	grpcHandler := queue.NewGRPCHandler(tt.queue)
+	_, err := grpcHandler.Ack(context.Background(), ackRequest)
+	tt.assert.Nil(err)
+}
+
+func TestGRPCHandler_Nack(t *testing.T) {
+	tt := testSetup(t)
+	defer tt.teardown()
+	tt.queue.EXPECT().Nack(gomock.Any(), "asdf", "someid").Return(queue.ErrNotInFlight)
+	nackRequest := &queue.NackRequest{QueueName: "asdf", ID: "someid"}
+	grpcHandler := queue.NewGRPCHandler(tt.queue)
+	_, err := grpcHandler.Nack(context.Background(), nackRequest)
+	tt.assert.Equal(queue.ErrNotInFlight, err)
+}
+
+func TestIsNotInFlight(t *testing.T) {
+	assert.True(t, queue.IsNotInFlight(queue.ErrNotInFlight))
+	assert.True(t, queue.IsNotInFlight(errors.Wrap(queue.ErrNotInFlight, "failed acking")))
+	assert.True(t, queue.IsNotInFlight(status.Error(codes.Unknown, queue.ErrNotInFlight.Error())))
+	assert.False(t, queue.IsNotInFlight(nil))
+	assert.False(t, queue.IsNotInFlight(errors.New("nope")))
+	assert.False(t, queue.IsNotInFlight(status.Error(codes.Unavailable, "nope")))
+}
+
+func TestPushLimited(t *testing.T) {
+	tt := testSetup(t)
+	defer tt.teardown()
+	ctx := context.Background()
+	webRequests := []*queue.WebRequest{tt.webRequest}
+	tt.queue.EXPECT().Push(ctx, "foo", webRequests).Return(nil)
+	dropped, err := queue.PushLimited(ctx, tt.queue, "foo", webRequests, queue.Limits{Overflow: queue.OverflowDropOldest})
+	tt.assert.Nil(err)
+	tt.assert.Equal(int64(0), dropped)
+
+	_, err = queue.PushLimited(ctx, tt.queue, "foo", webRequests, queue.Limits{MaxItems: 1})
+	tt.assert.Equal(queue.ErrNotLimiter, err, "queues that can't limit aren't pushed to past the limits")
+}
+
+func TestGRPCHandler_PeekDead(t *testing.T) {
+	tt := testSetup(t)
+	defer tt.teardown()
+	expect := []*queue.WebRequest{tt.webRequest}
+	tt.queue.EXPECT().PeekDead(gomock.Any(), "asdf", int64(12)).Return(expect, nil)
+	peekRequest := &queue.PeekRequest{QueueName: "asdf", Count: 12, DeadLetter: true}
+	grpcHandler := queue.NewGRPCHandler(tt.queue)
+	response, err := grpcHandler.Peek(context.Background(), peekRequest)
+	tt.assert.Nil(err)
+	tt.assert.Equal(expect, response.GetWebRequest())
+}
+
+func TestGRPCHandler_RequeueDead(t *testing.T) {
+	tt := testSetup(t)
+	defer tt.teardown()
+	tt.queue.EXPECT().RequeueDead(gomock.Any(), "asdf").Return(int64(3), nil)
+	grpcHandler := queue.NewGRPCHandler(tt.queue)
+	response, err := grpcHandler.RequeueDead(context.Background(), &queue.RequeueDeadRequest{QueueName: "asdf"})
+	tt.assert.Nil(err)
+	tt.assert.Equal(int64(3), response.GetCount())
+}
+
+func TestGRPCHandler_Push(t *testing.T) {
+	t.Run("pushes", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		receivedAt := ptypes.TimestampNow()
+		archived := &queue.WebRequest{Body: []byte("old"), ID: "123", Attempts: 4, ReceivedAt: receivedAt}
+		tt.queue.EXPECT().Push(gomock.Any(), "asdf", gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ string, webRequests []*queue.WebRequest) error {
+				tt.require.Len(webRequests, 2)
+				tt.assert.Equal(&queue.WebRequest{Body: []byte("old"), ReceivedAt: receivedAt}, webRequests[0])
+				tt.assert.Equal([]byte("hi"), webRequests[1].GetBody())
+				tt.assert.NotNil(webRequests[1].GetReceivedAt())
+				return nil
+			})
+		grpcHandler := queue.NewGRPCHandler(tt.queue)
+		response, err := grpcHandler.Push(context.Background(), &queue.PushRequest{
+			QueueName:  "asdf",
+			WebRequest: []*queue.WebRequest{archived, tt.webRequest},
+		})
+		tt.require.Nil(err)
+		tt.assert.Equal(int64(2), response.GetCount())
+		tt.assert.Equal("123", archived.GetID(), "the request isn't modified")
+	})
+
+	t.Run("requires a queue name", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		grpcHandler := queue.NewGRPCHandler(tt.queue)
+		_, err := grpcHandler.Push(context.Background(), &queue.PushRequest{
+			WebRequest: []*queue.WebRequest{tt.webRequest},
+		})
+		tt.assert.Equal(codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("passes on queue errors", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		tt.queue.EXPECT().Push(gomock.Any(), "asdf", gomock.Any()).Return(errors.New("oops"))
+		grpcHandler := queue.NewGRPCHandler(tt.queue)
+		_, err := grpcHandler.Push(context.Background(), &queue.PushRequest{
+			QueueName:  "asdf",
+			WebRequest: []*queue.WebRequest{tt.webRequest},
+		})
+		tt.assert.EqualError(err, "oops")
+	})
+}
+
+type fakeSubscribeServer struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan *queue.WebRequest
+}
+
+func (f *fakeSubscribeServer) Context() context.Context {
+	return f.ctx
+}
+
+func (f *fakeSubscribeServer) Send(webRequest *queue.WebRequest) error {
+	f.sent <- webRequest
+	return nil
+}
+
+func TestGRPCHandler_Subscribe(t *testing.T) {
+	t.Run("waits for ack", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		first := &queue.WebRequest{Body: []byte("first"), ID: "1"}
+		second := &queue.WebRequest{Body: []byte("second"), ID: "2"}
+		gomock.InOrder(
+			tt.queue.EXPECT().Pop(gomock.Any(), "asdf", time.Duration(0)).Return(first, nil),
+			tt.queue.EXPECT().Ack(gomock.Any(), "asdf", "1").Return(nil),
+			tt.queue.EXPECT().Pop(gomock.Any(), "asdf", time.Duration(0)).Return(second, nil),
+		)
+		stream := &fakeSubscribeServer{ctx: ctx, sent: make(chan *queue.WebRequest, 2)}
+		grpcHandler := queue.NewGRPCHandler(tt.queue)
+		errs := make(chan error, 1)
+		go func() {
+			errs <- grpcHandler.Subscribe(&queue.SubscribeRequest{QueueName: "asdf", MaxOutstanding: 1}, stream)
+		}()
+		tt.assert.Equal(first, <-stream.sent)
+		select {
+		case <-stream.sent:
+			t.Fatal("sent a second item before the first was acked")
+		case <-time.After(10 * time.Millisecond):
+		}
+		_, err := grpcHandler.Ack(ctx, &queue.AckRequest{QueueName: "asdf", ID: "1"})
+		tt.assert.Nil(err)
+		tt.assert.Equal(second, <-stream.sent)
+		cancel()
+		tt.assert.Nil(<-errs)
+	})
+
+	t.Run("frees a slot when the lease expires", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		first := &queue.WebRequest{Body: []byte("first"), ID: "1"}
+		second := &queue.WebRequest{Body: []byte("second"), ID: "2"}
+		gomock.InOrder(
+			tt.queue.EXPECT().Pop(gomock.Any(), "asdf", time.Duration(0)).Return(first, nil),
+			tt.queue.EXPECT().Pop(gomock.Any(), "asdf", time.Duration(0)).Return(second, nil),
+		)
+		tt.queue.EXPECT().Pop(gomock.Any(), "asdf", time.Duration(0)).Return(nil, nil).AnyTimes()
+		stream := &fakeSubscribeServer{ctx: ctx, sent: make(chan *queue.WebRequest, 2)}
+		grpcHandler := queue.NewGRPCHandler(tt.queue)
+		grpcHandler.LeaseDuration = 10 * time.Millisecond
+		errs := make(chan error, 1)
+		go func() {
+			errs <- grpcHandler.Subscribe(&queue.SubscribeRequest{QueueName: "asdf"}, stream)
+		}()
+		tt.assert.Equal(first, <-stream.sent)
+		tt.assert.Equal(second, <-stream.sent)
+		cancel()
+		tt.assert.Nil(<-errs)
+	})
+
+	t.Run("ends when stopped", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		stream := &fakeSubscribeServer{ctx: context.Background(), sent: make(chan *queue.WebRequest, 1)}
+		grpcHandler := queue.NewGRPCHandler(tt.queue)
+		popping := make(chan struct{})
+		tt.queue.EXPECT().Pop(gomock.Any(), "asdf", time.Duration(0)).DoAndReturn(
+			func(ctx context.Context, queueName string, timeout time.Duration) (*queue.WebRequest, error) {
+				close(popping)
+				<-ctx.Done()
+				return nil, nil
+			})
+		tt.queue.EXPECT().Pop(gomock.Any(), "asdf", time.Duration(0)).Return(nil, nil).AnyTimes()
+		errs := make(chan error, 1)
+		go func() {
+			errs <- grpcHandler.Subscribe(&queue.SubscribeRequest{QueueName: "asdf"}, stream)
+		}()
+		<-popping
+		grpcHandler.Stop()
+		tt.assert.Equal(codes.Unavailable, status.Code(<-errs))
+	})
+}
+
+func TestWebRequest_MarshalJSON(t *testing.T) {
+	t.Run("utf-8 body is a string", func(t *testing.T) {
+		jb, err := json.Marshal(&queue.WebRequest{Body: []byte(`{"hi":"there"}`), Host: "foo"})
+		assert.Nil(t, err)
+		assert.JSONEq(t, `{"Body":"{\"hi\":\"there\"}","Host":"foo"}`, string(jb))
+	})
+
+	t.Run("keeps jsonpb's field order", func(t *testing.T) {
+		jb, err := (&queue.WebRequest{
+			Host:     "foo",
+			Body:     []byte("<b>hi</b> & bye"),
+			ID:       "abc",
+			Attempts: 2,
+			Header:   []*queue.Header{{Name: "A", Value: []string{"b"}}},
+		}).MarshalJSON()
+		require.Nil(t, err)
+		assert.Equal(t, `{"Header":[{"name":"A","value":["b"]}],"Host":"foo","Body":"<b>hi</b> & bye","ID":"abc",`+
+			`"Attempts":"2"}`, string(jb), "the body isn't html escaped")
+
+		jb, err = (&queue.WebRequest{Body: []byte("hi")}).MarshalJSON()
+		require.Nil(t, err)
+		assert.Equal(t, `{"Body":"hi"}`, string(jb))
+
+		jb, err = (&queue.WebRequest{}).MarshalJSON()
+		require.Nil(t, err)
+		assert.Equal(t, `{}`, string(jb))
+	})
+
+	t.Run("binary body is base64", func(t *testing.T) {
+		jb, err := json.Marshal(&queue.WebRequest{Body: []byte{0x1f, 0x8b, 0xff}})
+		assert.Nil(t, err)
+		assert.JSONEq(t, `{"Body":"H4v/","BodyEncoding":"BASE64"}`, string(jb))
+	})
+
+	t.Run("round trips", func(t *testing.T) {
+		for _, body := range [][]byte{[]byte("hi"), {0x1f, 0x8b, 0xff}, nil} {
+			webRequest := &queue.WebRequest{Body: body, Host: "foo", Attempts: 2}
+			jb, err := json.Marshal(webRequest)
+			require.Nil(t, err)
+			got := new(queue.WebRequest)
+			require.Nil(t, json.Unmarshal(jb, got))
+			assert.Equal(t, body, got.GetBody())
+			assert.Equal(t, "foo", got.GetHost())
+			assert.Equal(t, int64(2), got.GetAttempts())
+		}
+	})
+}
+
+func TestWebRequest_UnmarshalJSON(t *testing.T) {
+	t.Run("reads json written before bodies were bytes", func(t *testing.T) {
+		got := new(queue.WebRequest)
+		err := json.Unmarshal([]byte(`{"ReceivedAt":"2018-05-21T16:50:30.474Z","Host":"foo","Body":"hi"}`), got)
+		assert.Nil(t, err)
+		assert.Equal(t, "hi", string(got.GetBody()))
+		assert.Equal(t, queue.BodyEncoding_UTF8, got.GetBodyEncoding())
+	})
+
+	t.Run("errors on bad base64", func(t *testing.T) {
+		got := new(queue.WebRequest)
+		err := json.Unmarshal([]byte(`{"Body":"!!","BodyEncoding":"BASE64"}`), got)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestNewWebRequestFromHTTPRequest(t *testing.T) {
+	t.Run("keeps binary bodies", func(t *testing.T) {
+		body := []byte{0x1f, 0x8b, 0xff, 0x00}
+		req, err := http.NewRequest(http.MethodPost, "/q/foo?a=b", bytes.NewReader(body))
+		require.Nil(t, err)
+		got, err := queue.NewWebRequestFromHTTPRequest(req, "/q/foo", time.Now(), 0)
+		require.Nil(t, err)
+		assert.Equal(t, body, got.GetBody())
+		assert.Equal(t, queue.BodyEncoding_BASE64, got.GetBodyEncoding())
+		assert.Equal(t, "a=b", got.GetRawQuery())
+	})
+
+	t.Run("path is after the prefix", func(t *testing.T) {
+		for path, want := range map[string]string{
+			"/q/foo":         "",
+			"/q/foo/bar/baz": "/bar/baz",
+			"/other":         "/other",
+		} {
+			req, err := http.NewRequest(http.MethodPost, path, strings.NewReader(""))
+			require.Nil(t, err)
+			got, err := queue.NewWebRequestFromHTTPRequest(req, "/q/foo", time.Now(), 0)
+			require.Nil(t, err)
+			assert.Equal(t, want, got.GetPath(), path)
+		}
+	})
+
+	t.Run("limits the body", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/q/foo", strings.NewReader("hello"))
+		require.Nil(t, err)
+		got, err := queue.NewWebRequestFromHTTPRequest(req, "/q/foo", time.Now(), 5)
+		require.Nil(t, err)
+		assert.Equal(t, "hello", string(got.GetBody()))
+
+		req, err = http.NewRequest(http.MethodPost, "/q/foo", strings.NewReader("hello"))
+		require.Nil(t, err)
+		_, err = queue.NewWebRequestFromHTTPRequest(req, "/q/foo", time.Now(), 4)
+		assert.Equal(t, queue.ErrBodyTooLarge, errors.Cause(err))
+
+		req, err = http.NewRequest(http.MethodPost, "/q/foo", strings.NewReader("hello"))
+		require.Nil(t, err)
+		req.ContentLength = -1
+		_, err = queue.NewWebRequestFromHTTPRequest(req, "/q/foo", time.Now(), 4)
+		assert.Equal(t, queue.ErrBodyTooLarge, errors.Cause(err), "bodies without a content length are limited too")
+	})
 }
@@ -0,0 +1,614 @@
+//Package queuetest has behavioral tests for queue.Queue implementations
+package queuetest
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//Options are the settings a test needs on the queue it gets
+type Options struct {
+	LeaseDuration time.Duration
+	MaxAttempts   int64
+}
+
+//NewQueueFunc returns an empty queue.Queue configured with opts
+type NewQueueFunc func(t *testing.T, opts Options) queue.Queue
+
+func newWebRequest(t *testing.T, body string) *queue.WebRequest {
+	t.Helper()
+	ts, err := ptypes.TimestampProto(time.Now())
+	require.Nil(t, err)
+	return &queue.WebRequest{
+		Body: []byte(body),
+		Header: []*queue.Header{
+			{Name: "fakeheader", Value: []string{"hi"}},
+			{Name: "fakeheader2", Value: []string{"hi", "bye"}},
+		},
+		ReceivedAt: ts,
+		Host:       "yomamashost",
+	}
+}
+
+func push(t *testing.T, q queue.Queue, queueName string, bodies ...string) {
+	t.Helper()
+	var webRequests []*queue.WebRequest
+	for _, body := range bodies {
+		webRequests = append(webRequests, newWebRequest(t, body))
+	}
+	require.Nil(t, q.Push(context.Background(), queueName, webRequests))
+}
+
+func pop(t *testing.T, q queue.Queue, queueName string) *queue.WebRequest {
+	t.Helper()
+	got, err := q.Pop(context.Background(), queueName, 100*time.Millisecond)
+	require.Nil(t, err)
+	return got
+}
+
+//Run runs the behavioral tests against the queues returned by newQueue
+func Run(t *testing.T, newQueue NewQueueFunc) {
+	t.Run("Push and Pop", func(t *testing.T) {
+		t.Run("pops in order", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			push(t, q, "bar", "1", "2")
+			first := pop(t, q, "bar")
+			require.NotNil(t, first)
+			assert.Equal(t, "1", string(first.GetBody()))
+			assert.Equal(t, "yomamashost", first.GetHost())
+			assert.Len(t, first.GetHeader(), 2)
+			assert.NotEmpty(t, first.GetID())
+			assert.Equal(t, int64(1), first.GetAttempts())
+			second := pop(t, q, "bar")
+			require.NotNil(t, second)
+			assert.Equal(t, "2", string(second.GetBody()))
+			assert.NotEqual(t, first.GetID(), second.GetID())
+		})
+
+		t.Run("keeps queues separate", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			push(t, q, "bar", "bar")
+			push(t, q, "baz", "baz")
+			assert.Equal(t, "baz", string(pop(t, q, "baz").GetBody()))
+			assert.Equal(t, "bar", string(pop(t, q, "bar").GetBody()))
+		})
+
+		t.Run("blocks until push", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			gotChan := make(chan *queue.WebRequest, 1)
+			errChan := make(chan error, 1)
+			go func() {
+				got, err := q.Pop(context.Background(), "bar", time.Second)
+				gotChan <- got
+				errChan <- err
+			}()
+			time.Sleep(10 * time.Millisecond)
+			push(t, q, "bar", "foo")
+			assert.Nil(t, <-errChan)
+			got := <-gotChan
+			require.NotNil(t, got)
+			assert.Equal(t, "foo", string(got.GetBody()))
+		})
+
+		t.Run("returns empty after timeout", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			got, err := q.Pop(context.Background(), "bar", 10*time.Millisecond)
+			assert.Nil(t, err)
+			assert.Nil(t, got)
+		})
+
+		t.Run("returns empty when the context is canceled", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			got, err := q.Pop(ctx, "bar", 0)
+			assert.Nil(t, err)
+			assert.Nil(t, got)
+		})
+	})
+
+	t.Run("Peek", func(t *testing.T) {
+		t.Run("works", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			for i := 0; i < 20; i++ {
+				push(t, q, "bar", strconv.Itoa(i))
+			}
+			response, err := q.Peek(context.Background(), "bar", 15)
+			assert.Nil(t, err)
+			require.Len(t, response, 15)
+			for i := 0; i < 15; i++ {
+				assert.Equal(t, strconv.Itoa(i), string(response[i].GetBody()))
+			}
+		})
+
+		t.Run("defaults to 10", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			for i := 0; i < 20; i++ {
+				push(t, q, "bar", strconv.Itoa(i))
+			}
+			response, err := q.Peek(context.Background(), "bar", 0)
+			assert.Nil(t, err)
+			assert.Len(t, response, 10)
+		})
+
+		t.Run("doesn't remove items", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			push(t, q, "bar", "foo")
+			_, err := q.Peek(context.Background(), "bar", 0)
+			assert.Nil(t, err)
+			assert.Equal(t, "foo", string(pop(t, q, "bar").GetBody()))
+		})
+
+		t.Run("treats a negative count as the default", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			push(t, q, "bar", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11")
+			response, err := q.Peek(context.Background(), "bar", -1)
+			assert.Nil(t, err)
+			assert.Len(t, response, 10)
+			response, err = q.PeekDead(context.Background(), "bar", -1)
+			assert.Nil(t, err)
+			assert.Empty(t, response)
+		})
+
+		t.Run("works on empty queue", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			response, err := q.Peek(context.Background(), "bar", 15)
+			assert.Nil(t, err)
+			assert.Equal(t, 0, len(response))
+		})
+	})
+
+	t.Run("Ack", func(t *testing.T) {
+		t.Run("works", func(t *testing.T) {
+			q := newQueue(t, Options{LeaseDuration: 10 * time.Millisecond})
+			push(t, q, "bar", "foo")
+			got := pop(t, q, "bar")
+			require.NotNil(t, got)
+			assert.Nil(t, q.Ack(context.Background(), "bar", got.GetID()))
+			time.Sleep(20 * time.Millisecond)
+			assert.Nil(t, pop(t, q, "bar"))
+		})
+
+		t.Run("errors on unknown id", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			assert.Equal(t, queue.ErrNotInFlight, q.Ack(context.Background(), "bar", "nope"))
+		})
+	})
+
+	t.Run("Nack", func(t *testing.T) {
+		t.Run("returns the item to the front", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			push(t, q, "bar", "1", "2")
+			got := pop(t, q, "bar")
+			require.NotNil(t, got)
+			assert.Nil(t, q.Nack(context.Background(), "bar", got.GetID()))
+			again := pop(t, q, "bar")
+			require.NotNil(t, again)
+			assert.Equal(t, "1", string(again.GetBody()))
+			assert.Equal(t, int64(2), again.GetAttempts())
+			assert.Equal(t, queue.ErrNotInFlight, q.Ack(context.Background(), "bar", got.GetID()))
+		})
+
+		t.Run("errors on unknown id", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			assert.Equal(t, queue.ErrNotInFlight, q.Nack(context.Background(), "bar", "nope"))
+		})
+	})
+
+	t.Run("leases", func(t *testing.T) {
+		t.Run("requeues expired leases", func(t *testing.T) {
+			q := newQueue(t, Options{LeaseDuration: time.Millisecond})
+			push(t, q, "bar", "foo")
+			first := pop(t, q, "bar")
+			require.NotNil(t, first)
+			time.Sleep(5 * time.Millisecond)
+			second := pop(t, q, "bar")
+			require.NotNil(t, second)
+			assert.Equal(t, "foo", string(second.GetBody()))
+			assert.Equal(t, int64(2), second.GetAttempts())
+			assert.Equal(t, queue.ErrNotInFlight, q.Ack(context.Background(), "bar", first.GetID()))
+		})
+
+		t.Run("redelivers expired leases to blocked pops", func(t *testing.T) {
+			q := newQueue(t, Options{LeaseDuration: 50 * time.Millisecond})
+			push(t, q, "bar", "foo")
+			first := pop(t, q, "bar")
+			require.NotNil(t, first)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			second, err := q.Pop(ctx, "bar", 0)
+			assert.Nil(t, err)
+			require.NotNil(t, second)
+			assert.Equal(t, "foo", string(second.GetBody()))
+			assert.Equal(t, int64(2), second.GetAttempts())
+		})
+	})
+
+	t.Run("dead letters", func(t *testing.T) {
+		t.Run("dead-letters after max attempts", func(t *testing.T) {
+			q := newQueue(t, Options{MaxAttempts: 2})
+			push(t, q, "bar", "foo")
+			for i := 0; i < 2; i++ {
+				got := pop(t, q, "bar")
+				require.NotNil(t, got)
+				require.Nil(t, q.Nack(context.Background(), "bar", got.GetID()))
+			}
+			got, err := q.Pop(context.Background(), "bar", 10*time.Millisecond)
+			assert.Nil(t, err)
+			assert.Nil(t, got)
+			dead, err := q.PeekDead(context.Background(), "bar", 0)
+			assert.Nil(t, err)
+			require.Len(t, dead, 1)
+			assert.Equal(t, "foo", string(dead[0].GetBody()))
+			assert.Equal(t, int64(2), dead[0].GetAttempts())
+		})
+
+		t.Run("requeues dead letters", func(t *testing.T) {
+			q := newQueue(t, Options{MaxAttempts: 1})
+			push(t, q, "bar", "1", "2")
+			for i := 0; i < 2; i++ {
+				got := pop(t, q, "bar")
+				require.NotNil(t, got)
+				require.Nil(t, q.Nack(context.Background(), "bar", got.GetID()))
+			}
+			count, err := q.RequeueDead(context.Background(), "bar")
+			assert.Nil(t, err)
+			assert.Equal(t, int64(2), count)
+			dead, err := q.PeekDead(context.Background(), "bar", 0)
+			assert.Nil(t, err)
+			assert.Empty(t, dead)
+			// backends differ on whether requeued items go before or after what is already queued
+			for _, body := range []string{"1", "2"} {
+				got := pop(t, q, "bar")
+				require.NotNil(t, got)
+				assert.Equal(t, body, string(got.GetBody()))
+			}
+		})
+	})
+	t.Run("admin", func(t *testing.T) {
+		t.Run("lists used queues", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			admin := administrator(t, q)
+			push(t, q, "baz", "1")
+			push(t, q, "bar", "1")
+			_, err := q.Peek(context.Background(), "qux", 0)
+			require.Nil(t, err)
+			queueNames, err := admin.ListQueues(context.Background())
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"bar", "baz"}, queueNames)
+		})
+
+		t.Run("lists queue names that look like keys", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			admin := administrator(t, q)
+			push(t, q, "bar:dead", "1")
+			push(t, q, "bar:inflight:baz", "1")
+			push(t, q, "bar:quarantine", "1")
+			queueNames, err := admin.ListQueues(context.Background())
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"bar:dead", "bar:inflight:baz", "bar:quarantine"}, queueNames)
+		})
+
+		t.Run("describes queues in a batch", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			batcher, ok := q.(queue.StatsBatcher)
+			if !ok {
+				t.Skip("backend doesn't batch stats")
+			}
+			push(t, q, "bar", "1", "2")
+			push(t, q, "baz", "1")
+			require.NotNil(t, pop(t, q, "baz"))
+			queueNames := []string{"baz", "qux", "bar"}
+			got, err := batcher.StatsBatch(context.Background(), queueNames)
+			require.Nil(t, err)
+			require.Len(t, got, len(queueNames))
+			for i, queueName := range queueNames {
+				want, err := administrator(t, q).Stats(context.Background(), queueName)
+				require.Nil(t, err)
+				assert.Equal(t, want, got[i])
+			}
+		})
+
+		t.Run("describes a queue", func(t *testing.T) {
+			q := newQueue(t, Options{MaxAttempts: 1})
+			admin := administrator(t, q)
+			var webRequests []*queue.WebRequest
+			for i := 0; i < 4; i++ {
+				webRequest := newWebRequest(t, strconv.Itoa(i))
+				webRequest.ReceivedAt.Seconds += int64(i)
+				webRequests = append(webRequests, webRequest)
+			}
+			require.Nil(t, q.Push(context.Background(), "bar", webRequests))
+			require.Nil(t, q.Nack(context.Background(), "bar", pop(t, q, "bar").GetID()))
+			require.NotNil(t, pop(t, q, "bar"))
+			stats, err := admin.Stats(context.Background(), "bar")
+			require.Nil(t, err)
+			assert.Equal(t, "bar", stats.GetQueueName())
+			assert.Equal(t, int64(2), stats.GetDepth())
+			assert.Equal(t, int64(1), stats.GetInFlight())
+			assert.Equal(t, int64(1), stats.GetDead())
+			assert.Equal(t, webRequests[2].GetReceivedAt().GetSeconds(), stats.GetOldestReceivedAt().GetSeconds())
+			assert.Equal(t, webRequests[3].GetReceivedAt().GetSeconds(), stats.GetNewestReceivedAt().GetSeconds())
+			lastActivity, err := ptypes.Timestamp(stats.GetLastActivity())
+			require.Nil(t, err)
+			assert.WithinDuration(t, time.Now(), lastActivity, time.Minute)
+		})
+
+		t.Run("describes an unknown queue", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			stats, err := administrator(t, q).Stats(context.Background(), "bar")
+			require.Nil(t, err)
+			assert.Equal(t, &queue.QueueStats{QueueName: "bar"}, stats)
+		})
+
+		t.Run("purges waiting items", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			admin := administrator(t, q)
+			push(t, q, "bar", "1", "2", "3")
+			got := pop(t, q, "bar")
+			require.NotNil(t, got)
+			count, err := admin.Purge(context.Background(), "bar")
+			assert.Nil(t, err)
+			assert.Equal(t, int64(2), count)
+			peeked, err := q.Peek(context.Background(), "bar", 0)
+			assert.Nil(t, err)
+			assert.Empty(t, peeked)
+			assert.Nil(t, q.Ack(context.Background(), "bar", got.GetID()), "in-flight items are kept")
+		})
+
+		t.Run("deletes a queue", func(t *testing.T) {
+			q := newQueue(t, Options{MaxAttempts: 1})
+			admin := administrator(t, q)
+			push(t, q, "bar", "1", "2", "3")
+			require.Nil(t, q.Nack(context.Background(), "bar", pop(t, q, "bar").GetID()))
+			got := pop(t, q, "bar")
+			require.NotNil(t, got)
+			push(t, q, "baz", "1")
+			require.Nil(t, admin.Delete(context.Background(), "bar"))
+			queueNames, err := admin.ListQueues(context.Background())
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"baz"}, queueNames)
+			stats, err := admin.Stats(context.Background(), "bar")
+			require.Nil(t, err)
+			assert.Equal(t, &queue.QueueStats{QueueName: "bar"}, stats)
+			assert.Equal(t, queue.ErrNotInFlight, q.Ack(context.Background(), "bar", got.GetID()))
+			push(t, q, "bar", "4")
+			assert.Equal(t, "4", string(pop(t, q, "bar").GetBody()))
+		})
+
+		t.Run("wakes pops waiting on a deleted queue", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			admin := administrator(t, q)
+			popped := make(chan *queue.WebRequest)
+			go func() {
+				got, _ := q.Pop(context.Background(), "bar", 2*time.Second)
+				popped <- got
+			}()
+			time.Sleep(50 * time.Millisecond)
+			require.Nil(t, admin.Delete(context.Background(), "bar"))
+			time.Sleep(50 * time.Millisecond)
+			push(t, q, "bar", "1")
+			got := <-popped
+			require.NotNil(t, got)
+			assert.Equal(t, "1", string(got.GetBody()))
+		})
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		t.Run("expires old items and dead letters", func(t *testing.T) {
+			q := newQueue(t, Options{MaxAttempts: 1})
+			e := expirer(t, q)
+			old := newWebRequest(t, "old")
+			old.ReceivedAt.Seconds -= 7200
+			oldDead := newWebRequest(t, "old dead")
+			oldDead.ReceivedAt.Seconds -= 7200
+			require.Nil(t, q.Push(context.Background(), "bar", []*queue.WebRequest{oldDead}))
+			require.Nil(t, q.Nack(context.Background(), "bar", pop(t, q, "bar").GetID()))
+			require.Nil(t, q.Push(context.Background(), "bar", []*queue.WebRequest{
+				old, newWebRequest(t, "new"), old, {Body: []byte("never received")},
+			}))
+			count, err := e.Expire(context.Background(), "bar", time.Now().Add(-time.Hour))
+			assert.Nil(t, err)
+			assert.Equal(t, int64(3), count)
+			peeked, err := q.Peek(context.Background(), "bar", 0)
+			assert.Nil(t, err)
+			require.Len(t, peeked, 2)
+			assert.Equal(t, "new", string(peeked[0].GetBody()))
+			assert.Equal(t, "never received", string(peeked[1].GetBody()))
+			dead, err := q.PeekDead(context.Background(), "bar", 0)
+			assert.Nil(t, err)
+			assert.Empty(t, dead)
+		})
+
+		t.Run("leaves in-flight items", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			e := expirer(t, q)
+			old := newWebRequest(t, "old")
+			old.ReceivedAt.Seconds -= 7200
+			require.Nil(t, q.Push(context.Background(), "bar", []*queue.WebRequest{old}))
+			got := pop(t, q, "bar")
+			require.NotNil(t, got)
+			count, err := e.Expire(context.Background(), "bar", time.Now())
+			assert.Nil(t, err)
+			assert.Equal(t, int64(0), count)
+			assert.Nil(t, q.Ack(context.Background(), "bar", got.GetID()))
+		})
+
+		t.Run("works on unknown queues", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			count, err := expirer(t, q).Expire(context.Background(), "bar", time.Now())
+			assert.Nil(t, err)
+			assert.Equal(t, int64(0), count)
+		})
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		// every item is itemSize bytes until it is popped and gets an attempt count
+		const itemSize = 12
+		items := func(bodies ...string) []*queue.WebRequest {
+			webRequests := make([]*queue.WebRequest, len(bodies))
+			for i, body := range bodies {
+				webRequests[i] = &queue.WebRequest{Body: []byte(body + "_________")}
+			}
+			return webRequests
+		}
+
+		t.Run("rejects pushes over max items", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			l := limiter(t, q)
+			limits := queue.Limits{MaxItems: 2}
+			_, err := l.PushLimited(context.Background(), "bar", items("a"), limits)
+			require.Nil(t, err)
+			_, err = l.PushLimited(context.Background(), "bar", items("b", "c"), limits)
+			assert.Equal(t, queue.ErrMaxItems, err)
+			assert.Equal(t, []string{"a"}, peekBodies(t, q, "bar"))
+		})
+
+		t.Run("rejects pushes over max bytes", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			l := limiter(t, q)
+			limits := queue.Limits{MaxBytes: 2*itemSize + 1, Overflow: queue.OverflowReject}
+			_, err := l.PushLimited(context.Background(), "bar", items("a", "b"), limits)
+			require.Nil(t, err)
+			_, err = l.PushLimited(context.Background(), "bar", items("c"), limits)
+			assert.Equal(t, queue.ErrMaxBytes, err)
+			assert.Equal(t, []string{"a", "b"}, peekBodies(t, q, "bar"))
+		})
+
+		t.Run("drops the oldest items", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			l := limiter(t, q)
+			limits := queue.Limits{MaxItems: 3, MaxBytes: 2 * itemSize, Overflow: queue.OverflowDropOldest}
+			dropped, err := l.PushLimited(context.Background(), "bar", items("a", "b", "c"), limits)
+			assert.Nil(t, err)
+			assert.Equal(t, int64(1), dropped)
+			dropped, err = l.PushLimited(context.Background(), "bar", items("d"), limits)
+			assert.Nil(t, err)
+			assert.Equal(t, int64(1), dropped)
+			assert.Equal(t, []string{"c", "d"}, peekBodies(t, q, "bar"))
+		})
+
+		t.Run("drops the newest items", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			l := limiter(t, q)
+			limits := queue.Limits{MaxItems: 2, Overflow: queue.OverflowDropNewest}
+			dropped, err := l.PushLimited(context.Background(), "bar", items("a", "b", "c"), limits)
+			assert.Nil(t, err)
+			assert.Equal(t, int64(1), dropped)
+			dropped, err = l.PushLimited(context.Background(), "bar", items("d"), limits)
+			assert.Nil(t, err)
+			assert.Equal(t, int64(1), dropped)
+			assert.Equal(t, []string{"a", "b"}, peekBodies(t, q, "bar"))
+		})
+
+		t.Run("drops items that are bigger than max bytes", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			l := limiter(t, q)
+			limits := queue.Limits{MaxBytes: 2 * itemSize, Overflow: queue.OverflowDropOldest}
+			dropped, err := l.PushLimited(context.Background(), "bar", items("a", "b"), limits)
+			require.Nil(t, err)
+			require.Equal(t, int64(0), dropped)
+			dropped, err = l.PushLimited(context.Background(), "bar", items("way too big for this queue"), limits)
+			assert.Nil(t, err)
+			assert.Equal(t, int64(1), dropped)
+			assert.Equal(t, []string{"a", "b"}, peekBodies(t, q, "bar"))
+		})
+
+		t.Run("only counts waiting items", func(t *testing.T) {
+			q := newQueue(t, Options{MaxAttempts: 2})
+			l := limiter(t, q)
+			limits := queue.Limits{MaxItems: 2, MaxBytes: 2*itemSize + 4}
+			_, err := l.PushLimited(context.Background(), "bar", items("a", "b"), limits)
+			require.Nil(t, err)
+			got := pop(t, q, "bar")
+			require.NotNil(t, got)
+			_, err = l.PushLimited(context.Background(), "bar", items("c"), limits)
+			require.Nil(t, err)
+			require.Nil(t, q.Nack(context.Background(), "bar", got.GetID()))
+			_, err = l.PushLimited(context.Background(), "bar", items("d"), limits)
+			assert.Equal(t, queue.ErrMaxItems, err)
+
+			// dead letters don't count until they are requeued
+			got = pop(t, q, "bar")
+			require.Equal(t, "a_________", string(got.GetBody()))
+			require.Nil(t, q.Nack(context.Background(), "bar", got.GetID()))
+			got = pop(t, q, "bar")
+			require.NotNil(t, got)
+			require.Nil(t, q.Ack(context.Background(), "bar", got.GetID()))
+			_, err = l.PushLimited(context.Background(), "bar", items("d"), limits)
+			require.Nil(t, err)
+			_, err = q.RequeueDead(context.Background(), "bar")
+			require.Nil(t, err)
+			_, err = l.PushLimited(context.Background(), "bar", items("e"), limits)
+			assert.Equal(t, queue.ErrMaxItems, err)
+		})
+
+		t.Run("counts bytes after items leave", func(t *testing.T) {
+			q := newQueue(t, Options{})
+			l := limiter(t, q)
+			limits := queue.Limits{MaxBytes: 2 * itemSize}
+			_, err := l.PushLimited(context.Background(), "bar", items("a", "b"), limits)
+			require.Nil(t, err)
+			got := pop(t, q, "bar")
+			require.NotNil(t, got)
+			require.Nil(t, q.Ack(context.Background(), "bar", got.GetID()))
+			_, err = l.PushLimited(context.Background(), "bar", items("c"), limits)
+			require.Nil(t, err)
+			_, err = l.PushLimited(context.Background(), "bar", items("d"), limits)
+			assert.Equal(t, queue.ErrMaxBytes, err)
+			_, err = administrator(t, q).Purge(context.Background(), "bar")
+			require.Nil(t, err)
+			_, err = l.PushLimited(context.Background(), "bar", items("d", "e"), limits)
+			assert.Nil(t, err)
+		})
+	})
+}
+
+func peekBodies(t *testing.T, q queue.Queue, queueName string) []string {
+	t.Helper()
+	peeked, err := q.Peek(context.Background(), queueName, 0)
+	require.Nil(t, err)
+	var bodies []string
+	for _, item := range peeked {
+		bodies = append(bodies, strings.TrimRight(string(item.GetBody()), "_"))
+	}
+	return bodies
+}
+
+// limiter fails the test when q isn't a queue.Limiter
+func limiter(t *testing.T, q queue.Queue) queue.Limiter {
+	t.Helper()
+	l, ok := q.(queue.Limiter)
+	if !ok {
+		t.Fatal("not a Limiter")
+	}
+	return l
+}
+
+// expirer fails the test when q isn't a queue.Expirer
+func expirer(t *testing.T, q queue.Queue) queue.Expirer {
+	t.Helper()
+	e, ok := q.(queue.Expirer)
+	if !ok {
+		t.Fatal("not an Expirer")
+	}
+	return e
+}
+
+// administrator fails the test when q isn't a queue.Administrator
+func administrator(t *testing.T, q queue.Queue) queue.Administrator {
+	t.Helper()
+	admin, ok := q.(queue.Administrator)
+	if !ok {
+		t.Fatal("not an Administrator")
+	}
+	return admin
+}
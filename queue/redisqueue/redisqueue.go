@@ -2,51 +2,328 @@ package redisqueue
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"io"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/WillAbides/xqsmee/metrics"
 	"github.com/WillAbides/xqsmee/queue"
 	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/gomodule/redigo/redis"
 	"github.com/pkg/errors"
 )
 
+//DefaultLeaseDuration is the lease duration used when Queue.LeaseDuration is zero
+const DefaultLeaseDuration = queue.DefaultLeaseDuration
+
 var (
 	errEmptyPrefix = errors.New("prefix is empty")
 	errNilPool     = errors.New("pool is nil")
+
+	redisErrors = metrics.NewCounterVec("xqsmee_redis_errors_total", "errors from redis commands", "command")
 )
 
+// keySuffixes are added to a queue's key to name its other keys. Older servers also counted attempts in ":attempts".
+var keySuffixes = []string{":inflight", ":leases", ":attempts", ":dead", ":activity", ":bytes"}
+
+// All scripts take the keys returned by Queue.scriptArgs: list, inflight, leases, activity, dead, bytes, names
+
+// attemptsLua reads and replaces the Attempts field of a marshaled WebRequest, so the item itself is the only place
+// its attempts are counted. Attempts is field 6, a varint, so its tag is the byte 48.
+const attemptsLua = `
+local function readVarint(s, i)
+  local n, scale = 0, 1
+  while true do
+    local b = string.byte(s, i)
+    if not b then
+      error("truncated varint in queued item")
+    end
+    i = i + 1
+    n = n + (b % 128) * scale
+    if b < 128 then
+      return n, i
+    end
+    scale = scale * 128
+  end
+end
+
+local function writeVarint(n)
+  local bytes = {}
+  repeat
+    local b = n % 128
+    n = math.floor(n / 128)
+    if n > 0 then
+      b = b + 128
+    end
+    bytes[#bytes + 1] = string.char(b)
+  until n == 0
+  return table.concat(bytes)
+end
+
+-- splitAttempts returns the attempts in value and the rest of value's fields
+local function splitAttempts(value)
+  local attempts, rest, i = 0, {}, 1
+  while i <= #value do
+    local start, key, n = i
+    key, i = readVarint(value, i)
+    local field, wireType = math.floor(key / 8), key % 8
+    if wireType == 0 then
+      n, i = readVarint(value, i)
+    elseif wireType == 1 then
+      i = i + 8
+    elseif wireType == 2 then
+      n, i = readVarint(value, i)
+      i = i + n
+    elseif wireType == 5 then
+      i = i + 4
+    else
+      error("unexpected wire type in queued item")
+    end
+    if field == 6 and wireType == 0 then
+      attempts = n
+    else
+      rest[#rest + 1] = string.sub(value, start, i - 1)
+    end
+  end
+  return attempts, table.concat(rest)
+end
+
+local function withAttempts(rest, attempts)
+  if attempts == 0 then
+    return rest
+  end
+  return rest .. string.char(48) .. writeVarint(attempts)
+end
+`
+
+// bytesLua keeps the bytes key at the total length of the values in the list. Lists pushed to before it was kept
+// don't have one until listBytes counts them.
+const bytesLua = `
+local function addBytes(n)
+  if redis.call("LLEN", KEYS[1]) == 0 then
+    redis.call("DEL", KEYS[6])
+  elseif redis.call("EXISTS", KEYS[6]) == 1 then
+    redis.call("INCRBY", KEYS[6], n)
+  end
+end
+
+local function listBytes()
+  local size = redis.call("GET", KEYS[6])
+  if size then
+    return tonumber(size)
+  end
+  size = 0
+  for _, value in ipairs(redis.call("LRANGE", KEYS[1], 0, -1)) do
+    size = size + #value
+  end
+  return size
+end
+`
+
+// pushScript pushes values to the back of the list while keeping it within limits the way queue.Limits.Check does.
+// It returns how many values it dropped and which limit rejected the push, if any. The queue's name is added to the
+// names set.
+// ARGV: queue name, max items, max bytes, overflow, values...
+var pushScript = redis.NewScript(7, bytesLua+`
+redis.call("SADD", KEYS[7], ARGV[1])
+local maxItems, maxBytes, overflow = tonumber(ARGV[2]), tonumber(ARGV[3]), ARGV[4]
+local function over(count, size)
+  if maxItems > 0 and count > maxItems then
+    return "items"
+  end
+  if maxBytes > 0 and size > maxBytes then
+    return "bytes"
+  end
+  return ""
+end
+local count = redis.call("LLEN", KEYS[1])
+local size = listBytes()
+if overflow == "" or overflow == "reject" then
+  local total = size
+  for i = 5, #ARGV do
+    total = total + #ARGV[i]
+  end
+  local limit = over(count + #ARGV - 4, total)
+  if limit ~= "" then
+    return {0, limit}
+  end
+end
+local dropped = 0
+for i = 5, #ARGV do
+  local value = ARGV[i]
+  if over(1, #value) ~= "" or (overflow == "dropNewest" and over(count + 1, size + #value) ~= "") then
+    dropped = dropped + 1
+  else
+    while count > 0 and over(count + 1, size + #value) ~= "" do
+      size = size - #redis.call("LPOP", KEYS[1])
+      count = count - 1
+      dropped = dropped + 1
+    end
+    redis.call("RPUSH", KEYS[1], value)
+    redis.call("PUBLISH", KEYS[1], "new")
+    count = count + 1
+    size = size + #value
+  end
+end
+if count > 0 then
+  redis.call("SET", KEYS[6], size)
+end
+return {dropped, ""}
+`)
+
+// reserveScript pops the head of the list into the in-flight hash with one more attempt, gives it a lease and
+// records activity. It returns the in-flight value.
+// ARGV: id, lease expiration in unix milliseconds, now in unix milliseconds
+var reserveScript = redis.NewScript(7, bytesLua+attemptsLua+`
+local value = redis.call("LPOP", KEYS[1])
+if not value then
+  return false
+end
+addBytes(-#value)
+local attempts, rest = splitAttempts(value)
+value = withAttempts(rest, attempts + 1)
+redis.call("HSET", KEYS[2], ARGV[1], value)
+redis.call("ZADD", KEYS[3], ARGV[2], ARGV[1])
+redis.call("SET", KEYS[4], ARGV[3])
+return value
+`)
+
+// ackScript removes an item from in-flight.
+// ARGV: id
+var ackScript = redis.NewScript(7, `
+if redis.call("ZREM", KEYS[3], ARGV[1]) == 0 then
+  return 0
+end
+redis.call("HDEL", KEYS[2], ARGV[1])
+return 1
+`)
+
+// releaseLua moves an in-flight item back to the head of the list, or to the dead-letter list
+// when it has been delivered max attempts times.
+const releaseLua = bytesLua + attemptsLua + `
+local function release(id, max)
+  local value = redis.call("HGET", KEYS[2], id)
+  redis.call("ZREM", KEYS[3], id)
+  redis.call("HDEL", KEYS[2], id)
+  if not value then
+    return
+  end
+  local attempts = splitAttempts(value)
+  if max > 0 and attempts >= max then
+    redis.call("RPUSH", KEYS[5], value)
+  else
+    redis.call("LPUSH", KEYS[1], value)
+    addBytes(#value)
+    redis.call("PUBLISH", KEYS[1], "new")
+  end
+end
+`
+
+// nackScript releases an in-flight item.
+// ARGV: id, max attempts
+var nackScript = redis.NewScript(7, releaseLua+`
+if not redis.call("ZSCORE", KEYS[3], ARGV[1]) then
+  return 0
+end
+release(ARGV[1], tonumber(ARGV[2]))
+return 1
+`)
+
+// requeueScript releases every item with an expired lease.
+// ARGV: now in unix milliseconds, max attempts
+var requeueScript = redis.NewScript(7, releaseLua+`
+local ids = redis.call("ZRANGEBYSCORE", KEYS[3], "-inf", ARGV[1])
+for _, id in ipairs(ids) do
+  release(id, tonumber(ARGV[2]))
+end
+return #ids
+`)
+
+// requeueDeadScript moves the dead-letter list to the head of the list, keeping its order.
+var requeueDeadScript = redis.NewScript(7, bytesLua+`
+local count, size = 0, 0
+local value = redis.call("RPOPLPUSH", KEYS[5], KEYS[1])
+while value do
+  count = count + 1
+  size = size + #value
+  value = redis.call("RPOPLPUSH", KEYS[5], KEYS[1])
+end
+if count > 0 then
+  addBytes(size)
+  redis.call("PUBLISH", KEYS[1], "new")
+end
+return count
+`)
+
+// removeScript removes the first copy of a value from the list.
+// ARGV: value
+var removeScript = redis.NewScript(7, bytesLua+`
+local removed = redis.call("LREM", KEYS[1], 1, ARGV[1])
+addBytes(-removed * #ARGV[1])
+return removed
+`)
+
 //Queue is a queue
 type Queue struct {
 	Prefix string
 	Pool   *redis.Pool
+	// LeaseDuration is how long a popped item stays reserved before it is requeued. Defaults to DefaultLeaseDuration.
+	LeaseDuration time.Duration
+	// MaxAttempts is how many times an item is delivered before it goes to the dead-letter list. Zero means no limit.
+	MaxAttempts int64
+
+	// known has the names of queues pushed to or popped from, so their depth can be reported
+	known sync.Map
 }
 
 //Push adds to the queue
 func (q *Queue) Push(ctx context.Context, queueName string, webRequests []*queue.WebRequest) error {
+	_, err := q.PushLimited(ctx, queueName, webRequests, queue.Limits{})
+	return err
+}
+
+//PushLimited adds to the queue while keeping its waiting items within limits and returns how many items it dropped
+func (q *Queue) PushLimited(ctx context.Context, queueName string, webRequests []*queue.WebRequest,
+	limits queue.Limits) (int64, error) {
 	if err := q.validate(); err != nil {
-		return err
+		return 0, err
 	}
-	conn := q.Pool.Get()
-	defer closeOrLog(conn)
-	key := q.key(queueName)
+	q.known.Store(queueName, true)
+	args := q.scriptArgs(queueName, queueName, limits.MaxItems, limits.MaxBytes, string(limits.Overflow))
 	for _, webRequest := range webRequests {
 		protoBytes, err := proto.Marshal(webRequest)
 		if err != nil {
-			return errors.Wrap(err, "failed marshaling protobuf")
-		}
-		_, err = conn.Do("RPUSH", key, protoBytes)
-		if err != nil {
-			return err
-		}
-		_, err = conn.Do("PUBLISH", key, "new")
-		if err != nil {
-			return err
+			return 0, errors.Wrap(err, "failed marshaling protobuf")
 		}
+		args = append(args, protoBytes)
 	}
-	return nil
+	conn := q.conn()
+	defer closeOrLog(conn)
+	values, err := redis.Values(pushScript.Do(conn, args...))
+	if err != nil {
+		return 0, err
+	}
+	var dropped int64
+	var limit string
+	_, err = redis.Scan(values, &dropped, &limit)
+	if err != nil {
+		return 0, err
+	}
+	switch limit {
+	case "items":
+		return 0, queue.ErrMaxItems
+	case "bytes":
+		return 0, queue.ErrMaxBytes
+	}
+	return dropped, q.touch(conn, queueName)
 }
 
 // listenPubSubChannels listens for messages on Redis pubsub channels. The
@@ -61,6 +338,7 @@ func listenPubSubChannel(ctx context.Context, pool *redis.Pool,
 
 	c, err := pool.GetContext(ctx)
 	if err != nil {
+		countError("SUBSCRIBE", err)
 		return err
 	}
 	defer closeOrLog(c)
@@ -139,12 +417,25 @@ func (q *Queue) Pop(ctx context.Context, queueName string, timeout time.Duration
 	if err := q.validate(); err != nil {
 		return nil, err
 	}
-	conn := q.Pool.Get()
+	q.known.Store(queueName, true)
+	conn := q.conn()
 	defer closeOrLog(conn)
 	key := q.key(queueName)
+	err := q.requeueExpired(conn, queueName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed requeueing expired leases")
+	}
+
+	// only subscribe when there is nothing to pop right away
+	webRequest, err := q.reserve(conn, queueName)
+	if err != nil || webRequest != nil {
+		return webRequest, err
+	}
 
 	cancelChan := make(chan struct{})
 
+	go q.requeueWhenExpired(ctx, queueName)
+
 	go func() {
 		select {
 		case <-cancelChan:
@@ -154,19 +445,17 @@ func (q *Queue) Pop(ctx context.Context, queueName string, timeout time.Duration
 	}()
 
 	var requestMux = &sync.Mutex{}
-	var webRequest *queue.WebRequest
 
 	doPop := func() error {
 		requestMux.Lock()
 		defer requestMux.Unlock()
 		if webRequest != nil {
-			close(cancelChan)
 			return nil
 		}
 		var err error
-		conn := q.Pool.Get()
+		conn := q.conn()
 		defer closeOrLog(conn)
-		webRequest, err = lpop(key, conn)
+		webRequest, err = q.reserve(conn, queueName)
 		if err != nil {
 			return err
 		}
@@ -176,12 +465,22 @@ func (q *Queue) Pop(ctx context.Context, queueName string, timeout time.Duration
 		return nil
 	}
 
-	err := listenPubSubChannel(ctx, q.Pool, doPop, key)
+	err = listenPubSubChannel(ctx, q.Pool, doPop, key)
+	if err != nil && webRequest == nil && ctx.Err() != nil {
+		// timing out or being canceled while waiting isn't an error
+		err = nil
+	}
 	return webRequest, err
 }
 
-func lpop(key string, conn redis.Conn) (*queue.WebRequest, error) {
-	value, err := redis.Bytes(conn.Do("LPOP", key))
+func (q *Queue) reserve(conn redis.Conn, queueName string) (*queue.WebRequest, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	value, err := redis.Bytes(reserveScript.Do(conn, q.scriptArgs(queueName, id,
+		unixMillis(now.Add(q.leaseDuration())), unixMillis(now))...))
 	switch err {
 	case nil:
 	case redis.ErrNil:
@@ -191,21 +490,116 @@ func lpop(key string, conn redis.Conn) (*queue.WebRequest, error) {
 	}
 	webRequest := new(queue.WebRequest)
 	err = proto.Unmarshal(value, webRequest)
-	return webRequest, err
+	if err != nil {
+		return nil, err
+	}
+	webRequest.ID = id
+	return webRequest, nil
+}
+
+func (q *Queue) requeueExpired(conn redis.Conn, queueName string) error {
+	_, err := requeueScript.Do(conn, q.scriptArgs(queueName, unixMillis(time.Now()), q.MaxAttempts)...)
+	return err
+}
+
+// requeueWhenExpired requeues expired leases whenever the earliest one is due until ctx is done. Nothing is published
+// when a lease expires, but releasing its item publishes to the list and wakes up waiting pops.
+func (q *Queue) requeueWhenExpired(ctx context.Context, queueName string) {
+	for {
+		timer := time.NewTimer(q.untilNextExpiration(queueName))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		conn := q.conn()
+		err := q.requeueExpired(conn, queueName)
+		closeOrLog(conn)
+		if err != nil {
+			log.Println("failed requeueing expired leases: ", err)
+		}
+	}
+}
+
+// untilNextExpiration returns how long until the earliest lease on a queue expires. Leases given out later expire
+// at least a lease duration from now, so it never waits longer than that.
+func (q *Queue) untilNextExpiration(queueName string) time.Duration {
+	wait := q.leaseDuration()
+	conn := q.conn()
+	defer closeOrLog(conn)
+	values, err := redis.Strings(conn.Do("ZRANGE", q.leasesKey(queueName), 0, 0, "WITHSCORES"))
+	if err != nil || len(values) < 2 {
+		return wait
+	}
+	expiresAt, err := strconv.ParseFloat(values[1], 64)
+	if err != nil {
+		return wait
+	}
+	until := time.Duration(int64(expiresAt)-unixMillis(time.Now())) * time.Millisecond
+	if until < wait {
+		wait = until
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+//Ack removes a popped item from in-flight
+func (q *Queue) Ack(ctx context.Context, queueName, id string) error {
+	if err := q.validate(); err != nil {
+		return err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	acked, err := redis.Bool(ackScript.Do(conn, q.scriptArgs(queueName, id)...))
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return queue.ErrNotInFlight
+	}
+	return q.touch(conn, queueName)
+}
+
+//Nack returns a popped item to the head of the queue, or to the dead-letter list once it reaches MaxAttempts
+func (q *Queue) Nack(ctx context.Context, queueName, id string) error {
+	if err := q.validate(); err != nil {
+		return err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	nacked, err := redis.Bool(nackScript.Do(conn, q.scriptArgs(queueName, id, q.MaxAttempts)...))
+	if err != nil {
+		return err
+	}
+	if !nacked {
+		return queue.ErrNotInFlight
+	}
+	return q.touch(conn, queueName)
 }
 
 //Peek show the next few items in the queue
 func (q *Queue) Peek(ctx context.Context, queueName string, count int64) ([]*queue.WebRequest, error) {
+	return q.peek(q.key(queueName), count)
+}
+
+//PeekDead shows the next few items in the queue's dead-letter list
+func (q *Queue) PeekDead(ctx context.Context, queueName string, count int64) ([]*queue.WebRequest, error) {
+	return q.peek(q.deadKey(queueName), count)
+}
+
+func (q *Queue) peek(key string, count int64) ([]*queue.WebRequest, error) {
 	response := make([]*queue.WebRequest, 0)
 	if err := q.validate(); err != nil {
 		return response, err
 	}
-	conn := q.Pool.Get()
+	conn := q.conn()
 	defer closeOrLog(conn)
-	if count == 0 {
+	if count <= 0 {
 		count = 10
 	}
-	key := q.key(queueName)
 	values, err := redis.ByteSlices(conn.Do("LRANGE", key, 0, count-1))
 	switch err {
 	case nil:
@@ -225,6 +619,356 @@ func (q *Queue) Peek(ctx context.Context, queueName string, count int64) ([]*que
 	return response, nil
 }
 
+//RequeueDead moves everything in the dead-letter list to the front of the queue and returns how many items it moved
+func (q *Queue) RequeueDead(ctx context.Context, queueName string) (int64, error) {
+	if err := q.validate(); err != nil {
+		return 0, err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	return redis.Int64(requeueDeadScript.Do(conn, q.scriptArgs(queueName)...))
+}
+
+//HealthCheck pings redis
+func (q *Queue) HealthCheck(ctx context.Context) error {
+	if err := q.validate(); err != nil {
+		return err
+	}
+	errs := make(chan error, 1)
+	go func() {
+		conn := q.conn()
+		defer closeOrLog(conn)
+		_, err := conn.Do("PING")
+		errs <- err
+	}()
+	select {
+	case err := <-errs:
+		return errors.Wrap(err, "failed pinging redis")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//ListQueues returns the names of the queues that have been pushed to
+func (q *Queue) ListQueues(ctx context.Context) ([]string, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	exists, err := redis.Bool(conn.Do("EXISTS", q.namesKey()))
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		err = q.addLegacyNames(conn)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed finding queues pushed to by older servers")
+		}
+	}
+	queueNames, err := redis.Strings(conn.Do("SMEMBERS", q.namesKey()))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(queueNames)
+	return queueNames, nil
+}
+
+// addLegacyNames adds queues that older servers pushed to, before the names set was kept, to the names set. They are
+// found by their keys, so a queue whose name ends in one of keySuffixes may be listed under the wrong name.
+func (q *Queue) addLegacyNames(conn redis.Conn) error {
+	keyPrefix := q.key("")
+	cursor := "0"
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", escapeGlob(keyPrefix)+"*", "COUNT", 1000))
+		if err != nil {
+			return err
+		}
+		var keys []string
+		_, err = redis.Scan(values, &cursor, &keys)
+		if err != nil {
+			return err
+		}
+		args := []interface{}{q.namesKey()}
+		for _, key := range keys {
+			args = append(args, queueNameFromKey(strings.TrimPrefix(key, keyPrefix)))
+		}
+		if len(args) > 1 {
+			_, err = conn.Do("SADD", args...)
+			if err != nil {
+				return err
+			}
+		}
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// queueNameFromKey removes the suffix from keys other than the list
+func queueNameFromKey(key string) string {
+	for _, suffix := range keySuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return strings.TrimSuffix(key, suffix)
+		}
+	}
+	return key
+}
+
+// escapeGlob escapes the characters that are special in a SCAN pattern
+func escapeGlob(s string) string {
+	var escaped strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+//Stats describes a queue
+func (q *Queue) Stats(ctx context.Context, queueName string) (*queue.QueueStats, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	err := q.requeueExpired(conn, queueName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed requeueing expired leases")
+	}
+	values, err := redis.Values(transaction(conn, func() error {
+		for _, args := range q.statsCommands(queueName) {
+			err := conn.Send(args[0].(string), args[1:]...)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return parseStats(queueName, values)
+}
+
+// statsBatchSize is how many queues StatsBatch describes per round trip
+const statsBatchSize = 100
+
+//StatsBatch describes several queues, pipelining the commands for up to statsBatchSize queues at a time
+func (q *Queue) StatsBatch(ctx context.Context, queueNames []string) ([]*queue.QueueStats, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	err := requeueScript.Load(conn)
+	if err != nil {
+		return nil, err
+	}
+	all := make([]*queue.QueueStats, 0, len(queueNames))
+	for start := 0; start < len(queueNames); start += statsBatchSize {
+		batch := queueNames[start:]
+		if len(batch) > statsBatchSize {
+			batch = batch[:statsBatchSize]
+		}
+		for _, queueName := range batch {
+			err := requeueScript.SendHash(conn, q.scriptArgs(queueName, unixMillis(time.Now()), q.MaxAttempts)...)
+			if err != nil {
+				return nil, err
+			}
+			for _, args := range q.statsCommands(queueName) {
+				err = conn.Send(args[0].(string), args[1:]...)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		err = conn.Flush()
+		if err != nil {
+			return nil, err
+		}
+		// every reply is read before returning an error so the connection goes back to the pool in sync
+		var firstErr error
+		for _, queueName := range batch {
+			_, err := conn.Receive()
+			if err != nil && firstErr == nil {
+				firstErr = errors.Wrap(err, "failed requeueing expired leases")
+			}
+			values := make([]interface{}, len(q.statsCommands(queueName)))
+			for i := range values {
+				values[i], err = conn.Receive()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}
+			if firstErr != nil {
+				continue
+			}
+			stats, err := parseStats(queueName, values)
+			if err != nil {
+				firstErr = err
+				continue
+			}
+			all = append(all, stats)
+		}
+		if firstErr != nil {
+			return nil, firstErr
+		}
+	}
+	return all, nil
+}
+
+// statsCommands are the commands whose replies parseStats reads
+func (q *Queue) statsCommands(queueName string) [][]interface{} {
+	key := q.key(queueName)
+	return [][]interface{}{
+		{"LLEN", key},
+		{"HLEN", q.inflightKey(queueName)},
+		{"LLEN", q.deadKey(queueName)},
+		{"LINDEX", key, 0},
+		{"LINDEX", key, -1},
+		{"GET", q.activityKey(queueName)},
+	}
+}
+
+// parseStats reads the replies to statsCommands
+func parseStats(queueName string, values []interface{}) (*queue.QueueStats, error) {
+	stats := &queue.QueueStats{QueueName: queueName}
+	var oldest, newest []byte
+	var lastActivity int64
+	_, err := redis.Scan(values, &stats.Depth, &stats.InFlight, &stats.Dead, &oldest, &newest, &lastActivity)
+	if err != nil {
+		return nil, err
+	}
+	stats.OldestReceivedAt, err = receivedAt(oldest)
+	if err != nil {
+		return nil, err
+	}
+	stats.NewestReceivedAt, err = receivedAt(newest)
+	if err != nil {
+		return nil, err
+	}
+	if lastActivity > 0 {
+		stats.LastActivity, err = ptypes.TimestampProto(time.Unix(0, lastActivity*int64(time.Millisecond)))
+	}
+	return stats, err
+}
+
+// receivedAt unmarshals a queued item and returns its ReceivedAt
+func receivedAt(value []byte) (*timestamp.Timestamp, error) {
+	if value == nil {
+		return nil, nil
+	}
+	webRequest := new(queue.WebRequest)
+	err := proto.Unmarshal(value, webRequest)
+	if err != nil {
+		return nil, err
+	}
+	return webRequest.GetReceivedAt(), nil
+}
+
+//Purge removes the waiting items and returns how many it removed
+func (q *Queue) Purge(ctx context.Context, queueName string) (int64, error) {
+	if err := q.validate(); err != nil {
+		return 0, err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	key := q.key(queueName)
+	values, err := redis.Values(transaction(conn, func() error {
+		err := conn.Send("LLEN", key)
+		if err != nil {
+			return err
+		}
+		return conn.Send("DEL", key, q.bytesKey(queueName))
+	}))
+	if err != nil {
+		return 0, err
+	}
+	return redis.Int64(values[0], nil)
+}
+
+//Delete removes everything in the queue
+func (q *Queue) Delete(ctx context.Context, queueName string) error {
+	if err := q.validate(); err != nil {
+		return err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	keys := []interface{}{q.key(queueName)}
+	for _, suffix := range keySuffixes {
+		keys = append(keys, q.key(queueName)+suffix)
+	}
+	_, err := conn.Do("DEL", keys...)
+	if err != nil {
+		return err
+	}
+	q.known.Delete(queueName)
+	_, err = conn.Do("SREM", q.namesKey(), queueName)
+	return err
+}
+
+//Expire discards waiting items and dead letters received before receivedBefore and returns how many it discarded.
+//Items popped by another server while it runs may be missed until the next time.
+func (q *Queue) Expire(ctx context.Context, queueName string, receivedBefore time.Time) (int64, error) {
+	if err := q.validate(); err != nil {
+		return 0, err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	count, err := expireList(conn, q.key(queueName), receivedBefore, func(value []byte) (int64, error) {
+		return redis.Int64(removeScript.Do(conn, q.scriptArgs(queueName, value)...))
+	})
+	if err != nil {
+		return count, err
+	}
+	dead, err := expireList(conn, q.deadKey(queueName), receivedBefore, func(value []byte) (int64, error) {
+		return redis.Int64(conn.Do("LREM", q.deadKey(queueName), 1, value))
+	})
+	return count + dead, err
+}
+
+// expireBatchSize is how many items expireList reads at a time
+const expireBatchSize = 1000
+
+// expireList removes the items in a list that were received before receivedBefore with remove
+func expireList(conn redis.Conn, key string, receivedBefore time.Time,
+	remove func(value []byte) (int64, error)) (int64, error) {
+	var count int64
+	for start := 0; ; start += expireBatchSize {
+		values, err := redis.ByteSlices(conn.Do("LRANGE", key, start, start+expireBatchSize-1))
+		if err != nil {
+			return count, err
+		}
+		var removed int64
+		for _, value := range values {
+			webRequest := new(queue.WebRequest)
+			if proto.Unmarshal(value, webRequest) != nil || !webRequest.ReceivedBefore(receivedBefore) {
+				continue
+			}
+			n, err := remove(value)
+			if err != nil {
+				return count, err
+			}
+			removed += n
+		}
+		count += removed
+		if len(values) < expireBatchSize {
+			return count, nil
+		}
+		// the items after the removed ones moved up
+		start -= int(removed)
+	}
+}
+
+// touch records activity on a queue
+func (q *Queue) touch(conn redis.Conn, queueName string) error {
+	_, err := conn.Do("SET", q.activityKey(queueName), unixMillis(time.Now()))
+	return errors.Wrap(err, "failed recording activity")
+}
+
 //New returns a new Queue
 func New(prefix string, pool *redis.Pool) *Queue {
 	return &Queue{
@@ -233,10 +977,142 @@ func New(prefix string, pool *redis.Pool) *Queue {
 	}
 }
 
+//DepthGauge reports how many items are waiting for each queue id that q has pushed to or popped from.
+//Sub-queues count toward their queue.
+func (q *Queue) DepthGauge() *metrics.GaugeFunc {
+	return metrics.NewGaugeFunc("xqsmee_queue_depth", "items waiting in a queue", "queue", q.depths)
+}
+
+func (q *Queue) depths() (map[string]float64, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	depths := map[string]float64{}
+	var err error
+	q.known.Range(func(key, _ interface{}) bool {
+		queueName := key.(string)
+		var depth int64
+		depth, err = redis.Int64(conn.Do("LLEN", q.key(queueName)))
+		depths[metrics.QueueLabel(queueName)] += float64(depth)
+		return err == nil
+	})
+	return depths, err
+}
+
+// conn gets a connection from the pool that counts errors
+func (q *Queue) conn() redis.Conn {
+	return CountErrors(q.Pool.Get())
+}
+
+//CountErrors wraps conn so the errors redis returns are counted in xqsmee_redis_errors_total
+func CountErrors(conn redis.Conn) redis.Conn {
+	return countingConn{Conn: conn}
+}
+
+// countingConn counts the errors redis returns
+type countingConn struct {
+	redis.Conn
+}
+
+func (c countingConn) Do(command string, args ...interface{}) (interface{}, error) {
+	reply, err := c.Conn.Do(command, args...)
+	countError(command, err)
+	return reply, err
+}
+
+func countError(command string, err error) {
+	if err == nil || err == redis.ErrNil || err == context.Canceled || err == context.DeadlineExceeded {
+		return
+	}
+	// scripts are loaded on demand, so NOSCRIPT is expected
+	if redisErr, ok := err.(redis.Error); ok && strings.HasPrefix(string(redisErr), "NOSCRIPT") {
+		return
+	}
+	redisErrors.WithLabelValues(strings.ToUpper(command)).Inc()
+}
+
 func (q *Queue) key(queueName string) string {
 	return q.Prefix + ":" + queueName
 }
 
+func (q *Queue) inflightKey(queueName string) string {
+	return q.key(queueName) + ":inflight"
+}
+
+func (q *Queue) leasesKey(queueName string) string {
+	return q.key(queueName) + ":leases"
+}
+
+func (q *Queue) deadKey(queueName string) string {
+	return q.key(queueName) + ":dead"
+}
+
+func (q *Queue) activityKey(queueName string) string {
+	return q.key(queueName) + ":activity"
+}
+
+func (q *Queue) bytesKey(queueName string) string {
+	return q.key(queueName) + ":bytes"
+}
+
+// namesKey is the set of queue names, shared with streamqueue. It can't be mistaken for a queue's key, because those
+// all start with Prefix and a colon.
+func (q *Queue) namesKey() string {
+	return q.Prefix + "#queues"
+}
+
+// scriptArgs builds the arguments for one of the lua scripts
+func (q *Queue) scriptArgs(queueName string, argv ...interface{}) []interface{} {
+	return append([]interface{}{
+		q.key(queueName),
+		q.inflightKey(queueName),
+		q.leasesKey(queueName),
+		q.activityKey(queueName),
+		q.deadKey(queueName),
+		q.bytesKey(queueName),
+		q.namesKey(),
+	}, argv...)
+}
+
+// transaction wraps the commands sent by fn in MULTI/EXEC
+func transaction(conn redis.Conn, fn func() error) (interface{}, error) {
+	err := conn.Send("MULTI")
+	if err != nil {
+		return nil, err
+	}
+	err = fn()
+	if err != nil {
+		_, discardErr := conn.Do("DISCARD")
+		if discardErr != nil {
+			log.Println("failed discarding transaction: ", discardErr)
+		}
+		return nil, err
+	}
+	return conn.Do("EXEC")
+}
+
+func (q *Queue) leaseDuration() time.Duration {
+	if q.LeaseDuration > 0 {
+		return q.LeaseDuration
+	}
+	return DefaultLeaseDuration
+}
+
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errors.Wrap(err, "failed generating id")
+	}
+	return hex.EncodeToString(b), nil
+}
+
 func (q *Queue) validate() error {
 	if q.Prefix == "" {
 		return errEmptyPrefix
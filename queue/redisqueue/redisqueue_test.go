@@ -6,11 +6,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/WillAbides/xqsmee/metrics"
 	"github.com/WillAbides/xqsmee/queue"
+	"github.com/WillAbides/xqsmee/queue/queuetest"
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -70,7 +73,7 @@ func testSetup(t *testing.T) *testObjects {
 func newWebRequestAndBytes(t *testing.T, body string, receivedAt *timestamp.Timestamp) (*queue.WebRequest, []byte) {
 	t.Helper()
 	wr := &queue.WebRequest{
-		Body: body,
+		Body: []byte(body),
 		Header: []*queue.Header{
 			{Name: "fakeheader", Value: []string{"hi"}},
 			{Name: "fakeheader2", Value: []string{"hi", "bye"}},
@@ -115,6 +118,18 @@ func TestQueue_Push(t *testing.T) {
 	})
 }
 
+// waitFor polls cond until it is true or a second has passed
+func waitFor(cond func() bool) error {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return nil
+}
+
 func TestQueue_Pop(t *testing.T) {
 	t.Run("works", func(t *testing.T) {
 		tt := testSetup(t)
@@ -124,9 +139,96 @@ func TestQueue_Pop(t *testing.T) {
 		tt.assert.Nil(err)
 		got, err := tt.queue.Pop(context.Background(), "bar", 100*time.Millisecond)
 		tt.assert.Nil(err)
+		tt.assert.NotEmpty(got.GetID())
+		tt.assert.Equal(int64(1), got.GetAttempts())
+		got.ID = ""
+		got.Attempts = 0
 		tt.assert.True(proto.Equal(tt.webRequest, got))
 	})
 
+	t.Run("reserves item", func(t *testing.T) {
+		tt := testSetup(t)
+		conn := redisPool.Get()
+		defer closeOrLog(conn)
+		_, err := conn.Do("RPUSH", "foo:bar", tt.webRequestBytes)
+		tt.require.Nil(err)
+		got, err := tt.queue.Pop(context.Background(), "bar", 100*time.Millisecond)
+		tt.require.Nil(err)
+		inflight, err := redis.Bytes(conn.Do("HGET", "foo:bar:inflight", got.GetID()))
+		tt.assert.Nil(err)
+		reserved := new(queue.WebRequest)
+		tt.require.Nil(proto.Unmarshal(inflight, reserved))
+		tt.assert.Equal(int64(1), reserved.GetAttempts())
+		score, err := redis.Int64(conn.Do("ZSCORE", "foo:bar:leases", got.GetID()))
+		tt.assert.Nil(err)
+		tt.assert.True(score > unixMillis(time.Now()))
+	})
+
+	t.Run("counts attempts in the item", func(t *testing.T) {
+		tt := testSetup(t)
+		conn := redisPool.Get()
+		defer closeOrLog(conn)
+		tt.webRequest.Attempts = 200
+		value, err := proto.Marshal(tt.webRequest)
+		tt.require.Nil(err)
+		_, err = conn.Do("RPUSH", "foo:bar", value)
+		tt.require.Nil(err)
+		got, err := tt.queue.Pop(context.Background(), "bar", 100*time.Millisecond)
+		tt.require.Nil(err)
+		tt.assert.Equal(int64(201), got.GetAttempts())
+		got.ID = ""
+		got.Attempts = 200
+		tt.assert.True(proto.Equal(tt.webRequest, got))
+	})
+
+	t.Run("counts the attempt when the connection dies after reserving", func(t *testing.T) {
+		tt := testSetup(t)
+		tt.queue.MaxAttempts = 1
+		tt.queue.LeaseDuration = time.Millisecond
+		conn := redisPool.Get()
+		defer closeOrLog(conn)
+		_, err := conn.Do("RPUSH", "foo:bar", tt.webRequestBytes)
+		tt.require.Nil(err)
+
+		dying, err := redisPool.Dial()
+		tt.require.Nil(err)
+		now := time.Now()
+		tt.require.Nil(reserveScript.Send(dying, tt.queue.scriptArgs("bar", "dying",
+			unixMillis(now.Add(time.Millisecond)), unixMillis(now))...))
+		tt.require.Nil(dying.Flush())
+		tt.require.Nil(dying.Close())
+		tt.require.Nil(waitFor(func() bool {
+			leases, err := redis.Int64(conn.Do("ZCARD", "foo:bar:leases"))
+			return err == nil && leases == 1
+		}))
+
+		time.Sleep(5 * time.Millisecond)
+		tt.require.Nil(tt.queue.requeueExpired(conn, "bar"))
+		dead, err := tt.queue.PeekDead(context.Background(), "bar", 0)
+		tt.require.Nil(err)
+		tt.require.Len(dead, 1, "the attempt was counted, so the item used up MaxAttempts")
+		tt.assert.Equal(int64(1), dead[0].GetAttempts())
+	})
+
+	t.Run("requeues expired leases", func(t *testing.T) {
+		tt := testSetup(t)
+		tt.queue.LeaseDuration = time.Millisecond
+		conn := redisPool.Get()
+		defer closeOrLog(conn)
+		_, err := conn.Do("RPUSH", "foo:bar", tt.webRequestBytes)
+		tt.require.Nil(err)
+		first, err := tt.queue.Pop(context.Background(), "bar", 100*time.Millisecond)
+		tt.require.Nil(err)
+		tt.require.NotNil(first)
+		time.Sleep(5 * time.Millisecond)
+		second, err := tt.queue.Pop(context.Background(), "bar", 100*time.Millisecond)
+		tt.assert.Nil(err)
+		tt.require.NotNil(second)
+		tt.assert.NotEqual(first.GetID(), second.GetID())
+		tt.assert.Equal(int64(2), second.GetAttempts())
+		tt.assert.Equal(queue.ErrNotInFlight, tt.queue.Ack(context.Background(), "bar", first.GetID()))
+	})
+
 	t.Run("blocks", func(t *testing.T) {
 		tt := testSetup(t)
 		gotChan := make(chan *queue.WebRequest, 1)
@@ -145,6 +247,8 @@ func TestQueue_Pop(t *testing.T) {
 		tt.assert.Nil(err)
 		tt.assert.Nil(<-errChan)
 		got := <-gotChan
+		got.ID = ""
+		got.Attempts = 0
 		tt.assert.True(proto.Equal(tt.webRequest, got))
 	})
 
@@ -156,6 +260,81 @@ func TestQueue_Pop(t *testing.T) {
 	})
 }
 
+func TestQueue_Ack(t *testing.T) {
+	t.Run("works", func(t *testing.T) {
+		tt := testSetup(t)
+		conn := redisPool.Get()
+		defer closeOrLog(conn)
+		_, err := conn.Do("RPUSH", "foo:bar", tt.webRequestBytes)
+		tt.require.Nil(err)
+		got, err := tt.queue.Pop(context.Background(), "bar", 100*time.Millisecond)
+		tt.require.Nil(err)
+		err = tt.queue.Ack(context.Background(), "bar", got.GetID())
+		tt.assert.Nil(err)
+		for _, key := range []string{"foo:bar", "foo:bar:inflight", "foo:bar:leases"} {
+			exists, err := redis.Bool(conn.Do("EXISTS", key))
+			tt.assert.Nil(err)
+			tt.assert.False(exists, key)
+		}
+	})
+
+	t.Run("errors on unknown id", func(t *testing.T) {
+		tt := testSetup(t)
+		err := tt.queue.Ack(context.Background(), "bar", "nope")
+		tt.assert.Equal(queue.ErrNotInFlight, err)
+	})
+}
+
+func TestQueue_Nack(t *testing.T) {
+	t.Run("works", func(t *testing.T) {
+		tt := testSetup(t)
+		conn := redisPool.Get()
+		defer closeOrLog(conn)
+		_, wrb := newWebRequestAndBytes(t, "second", tt.timestamp)
+		_, err := conn.Do("RPUSH", "foo:bar", tt.webRequestBytes, wrb)
+		tt.require.Nil(err)
+		got, err := tt.queue.Pop(context.Background(), "bar", 100*time.Millisecond)
+		tt.require.Nil(err)
+		err = tt.queue.Nack(context.Background(), "bar", got.GetID())
+		tt.assert.Nil(err)
+		peeked, err := tt.queue.Peek(context.Background(), "bar", 0)
+		tt.assert.Nil(err)
+		tt.require.Len(peeked, 2)
+		tt.assert.Equal("foo", string(peeked[0].GetBody()))
+		tt.assert.Equal(int64(1), peeked[0].GetAttempts())
+		tt.assert.Equal("second", string(peeked[1].GetBody()))
+		tt.assert.Equal(queue.ErrNotInFlight, tt.queue.Ack(context.Background(), "bar", got.GetID()))
+	})
+
+	t.Run("dead-letters after max attempts", func(t *testing.T) {
+		tt := testSetup(t)
+		tt.queue.MaxAttempts = 2
+		conn := redisPool.Get()
+		defer closeOrLog(conn)
+		_, err := conn.Do("RPUSH", "foo:bar", tt.webRequestBytes)
+		tt.require.Nil(err)
+		for i := 0; i < 2; i++ {
+			got, err := tt.queue.Pop(context.Background(), "bar", 100*time.Millisecond)
+			tt.require.Nil(err)
+			tt.require.NotNil(got)
+			tt.require.Nil(tt.queue.Nack(context.Background(), "bar", got.GetID()))
+		}
+		got, err := tt.queue.Pop(context.Background(), "bar", 10*time.Millisecond)
+		tt.assert.Nil(err)
+		tt.assert.Nil(got)
+		dead, err := tt.queue.PeekDead(context.Background(), "bar", 0)
+		tt.assert.Nil(err)
+		tt.require.Len(dead, 1)
+		tt.assert.Equal(int64(2), dead[0].GetAttempts())
+	})
+
+	t.Run("errors on unknown id", func(t *testing.T) {
+		tt := testSetup(t)
+		err := tt.queue.Nack(context.Background(), "bar", "nope")
+		tt.assert.Equal(queue.ErrNotInFlight, err)
+	})
+}
+
 func TestQueue_Peek(t *testing.T) {
 	t.Run("works", func(t *testing.T) {
 		tt := testSetup(t)
@@ -171,7 +350,7 @@ func TestQueue_Peek(t *testing.T) {
 		assert.Nil(t, err)
 		for i := 0; i < 15; i++ {
 			exbody := strconv.Itoa(i)
-			body := response[i].GetBody()
+			body := string(response[i].GetBody())
 			assert.Equal(t, exbody, body)
 		}
 	})
@@ -184,6 +363,170 @@ func TestQueue_Peek(t *testing.T) {
 	})
 }
 
+func TestQueue_RequeueDead(t *testing.T) {
+	t.Run("works", func(t *testing.T) {
+		tt := testSetup(t)
+		conn := redisPool.Get()
+		defer closeOrLog(conn)
+		_, wrb := newWebRequestAndBytes(t, "second", tt.timestamp)
+		_, err := conn.Do("RPUSH", "foo:bar:dead", tt.webRequestBytes, wrb)
+		tt.require.Nil(err)
+		count, err := tt.queue.RequeueDead(context.Background(), "bar")
+		tt.assert.Nil(err)
+		tt.assert.Equal(int64(2), count)
+		reply, err := redis.ByteSlices(conn.Do("LRANGE", "foo:bar", 0, -1))
+		tt.assert.Nil(err)
+		tt.assert.Equal([][]byte{tt.webRequestBytes, wrb}, reply)
+		dead, err := tt.queue.PeekDead(context.Background(), "bar", 0)
+		tt.assert.Nil(err)
+		tt.assert.Empty(dead)
+	})
+}
+
+func TestQueue_depths(t *testing.T) {
+	tt := testSetup(t)
+	ctx := context.Background()
+	tt.require.Nil(tt.queue.Push(ctx, "bar", []*queue.WebRequest{tt.webRequest, tt.webRequest}))
+	_, err := tt.queue.Pop(ctx, "baz", time.Millisecond)
+	tt.require.Nil(err)
+	depths, err := tt.queue.depths()
+	tt.assert.Nil(err)
+	tt.assert.Equal(map[string]float64{"bar": 2, "baz": 0}, depths)
+}
+
+func TestQueue_HealthCheck(t *testing.T) {
+	t.Run("healthy", func(t *testing.T) {
+		tt := testSetup(t)
+		tt.assert.Nil(tt.queue.HealthCheck(context.Background()))
+	})
+
+	t.Run("redis is unreachable", func(t *testing.T) {
+		tt := testSetup(t)
+		tt.queue.Pool = &redis.Pool{
+			Dial: func() (redis.Conn, error) {
+				return redis.DialURL("redis://127.0.0.1:1")
+			},
+		}
+		tt.assert.NotNil(tt.queue.HealthCheck(context.Background()))
+	})
+}
+
+func TestQueue_ListQueues(t *testing.T) {
+	tt := testSetup(t)
+	ctx := context.Background()
+	tt.require.Nil(tt.queue.Push(ctx, "bar", []*queue.WebRequest{tt.webRequest}))
+	tt.require.Nil(tt.queue.Push(ctx, "bar:quarantine", []*queue.WebRequest{tt.webRequest}))
+	globbed := New("fo?", redisPool)
+	tt.require.Nil(globbed.Push(ctx, "baz", []*queue.WebRequest{tt.webRequest}))
+
+	queueNames, err := tt.queue.ListQueues(ctx)
+	tt.assert.Nil(err)
+	tt.assert.Equal([]string{"bar", "bar:quarantine"}, queueNames)
+	queueNames, err = globbed.ListQueues(ctx)
+	tt.assert.Nil(err)
+	tt.assert.Equal([]string{"baz"}, queueNames)
+
+	t.Run("finds queues from before the names set", func(t *testing.T) {
+		tt := testSetup(t)
+		tt.require.Nil(tt.queue.Push(ctx, "bar", []*queue.WebRequest{tt.webRequest}))
+		tt.require.Nil(tt.queue.Push(ctx, "bar:quarantine", []*queue.WebRequest{tt.webRequest}))
+		conn := redisPool.Get()
+		defer conn.Close()
+		_, err := conn.Do("DEL", tt.queue.namesKey())
+		tt.require.Nil(err)
+		queueNames, err := tt.queue.ListQueues(ctx)
+		tt.assert.Nil(err)
+		tt.assert.Equal([]string{"bar", "bar:quarantine"}, queueNames)
+		members, err := redis.Strings(conn.Do("SMEMBERS", tt.queue.namesKey()))
+		tt.assert.Nil(err)
+		tt.assert.Len(members, 2)
+	})
+}
+
+func TestQueue_Expire(t *testing.T) {
+	tt := testSetup(t)
+	ctx := context.Background()
+	old, _ := newWebRequestAndBytes(t, "old", &timestamp.Timestamp{Seconds: tt.timestamp.Seconds - 7200})
+	var webRequests []*queue.WebRequest
+	for i := 0; i < 2*expireBatchSize+100; i++ {
+		if i%3 == 0 {
+			webRequests = append(webRequests, tt.webRequest)
+			continue
+		}
+		webRequests = append(webRequests, old)
+	}
+	tt.require.Nil(tt.queue.Push(ctx, "bar", webRequests))
+	count, err := tt.queue.Expire(ctx, "bar", time.Now().Add(-time.Hour))
+	tt.assert.Nil(err)
+	tt.assert.Equal(int64(1400), count)
+	stats, err := tt.queue.Stats(ctx, "bar")
+	tt.require.Nil(err)
+	tt.assert.Equal(int64(700), stats.GetDepth())
+}
+
+func TestQueue_PushLimited(t *testing.T) {
+	t.Run("counts lists that were pushed before bytes were kept", func(t *testing.T) {
+		tt := testSetup(t)
+		ctx := context.Background()
+		conn := redisPool.Get()
+		defer closeOrLog(conn)
+		_, err := conn.Do("RPUSH", "foo:bar", tt.webRequestBytes, tt.webRequestBytes)
+		tt.require.Nil(err)
+		limits := queue.Limits{MaxBytes: int64(3 * len(tt.webRequestBytes))}
+		_, err = tt.queue.PushLimited(ctx, "bar", []*queue.WebRequest{tt.webRequest}, limits)
+		tt.assert.Nil(err)
+		size, err := redis.Int64(conn.Do("GET", "foo:bar:bytes"))
+		tt.assert.Nil(err)
+		tt.assert.Equal(limits.MaxBytes, size)
+		_, err = tt.queue.PushLimited(ctx, "bar", []*queue.WebRequest{tt.webRequest}, limits)
+		tt.assert.Equal(queue.ErrMaxBytes, err)
+	})
+
+	t.Run("forgets bytes once the list is empty", func(t *testing.T) {
+		tt := testSetup(t)
+		ctx := context.Background()
+		old, oldBytes := newWebRequestAndBytes(t, "old", &timestamp.Timestamp{Seconds: tt.timestamp.Seconds - 7200})
+		limits := queue.Limits{MaxBytes: int64(len(oldBytes))}
+		_, err := tt.queue.PushLimited(ctx, "bar", []*queue.WebRequest{old}, limits)
+		tt.require.Nil(err)
+		count, err := tt.queue.Expire(ctx, "bar", time.Now().Add(-time.Hour))
+		tt.require.Nil(err)
+		tt.require.Equal(int64(1), count)
+		conn := redisPool.Get()
+		defer closeOrLog(conn)
+		exists, err := redis.Bool(conn.Do("EXISTS", "foo:bar:bytes"))
+		tt.assert.Nil(err)
+		tt.assert.False(exists)
+		_, err = tt.queue.PushLimited(ctx, "bar", []*queue.WebRequest{old}, limits)
+		tt.assert.Nil(err)
+	})
+}
+
+func TestCountingConn(t *testing.T) {
+	conn := countingConn{Conn: redisPool.Get()}
+	defer closeOrLog(conn)
+	before := metrics.CounterValue(redisErrors, "INCR")
+	_, err := conn.Do("SET", "counted", "not a number")
+	require.Nil(t, err)
+	_, err = conn.Do("incr", "counted")
+	assert.NotNil(t, err)
+	assert.Equal(t, before+1, metrics.CounterValue(redisErrors, "INCR"))
+
+	before = metrics.CounterValue(redisErrors, "EVALSHA")
+	_, err = conn.Do("EVALSHA", "0000000000000000000000000000000000000000", 0)
+	assert.NotNil(t, err)
+	assert.Equal(t, before, metrics.CounterValue(redisErrors, "EVALSHA"), "NOSCRIPT isn't counted")
+}
+
+func TestQueue(t *testing.T) {
+	queuetest.Run(t, func(t *testing.T, opts queuetest.Options) queue.Queue {
+		tt := testSetup(t)
+		tt.queue.LeaseDuration = opts.LeaseDuration
+		tt.queue.MaxAttempts = opts.MaxAttempts
+		return tt.queue
+	})
+}
+
 func TestQueue_validate(t *testing.T) {
 	t.Run("no error on valid", func(t *testing.T) {
 		tt := testSetup(t)
@@ -0,0 +1,1266 @@
+//Package streamqueue is a queue.Queue backed by redis streams and consumer groups. It needs redis 6.2 or later.
+//
+//Each queue is a stream read by a single consumer group. Pending entries stand in for leases: an entry that has been
+//idle longer than the lease duration is claimed again by the next Pop, and acking removes it from the stream.
+//
+//Items whose leases have expired count as waiting, so they count toward Limits and a Stats depth the way requeued items
+//do in redisqueue.
+//
+//Queues written by redisqueue are migrated the first time this package touches them. Queued and in-flight items are
+//appended to the stream and the old keys are removed. Dead letters stay in the same list, so PeekDead and RequeueDead
+//see them without migrating. Stop servers using redisqueue before switching so nothing is pushed to the old keys.
+package streamqueue
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/WillAbides/xqsmee/queue/redisqueue"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	//DefaultGroup is the consumer group used when Queue.Group is empty
+	DefaultGroup = "xqsmee"
+
+	// entryField is the stream field that holds the marshaled WebRequest
+	entryField = "item"
+
+	// pollInterval is the longest Pop blocks on XREADGROUP before checking for expired leases again
+	pollInterval = time.Second
+
+	// expireBatchSize is how many items Expire reads at a time
+	expireBatchSize = 1000
+)
+
+var (
+	errEmptyPrefix = errors.New("prefix is empty")
+	errNilPool     = errors.New("pool is nil")
+)
+
+// migrateScript moves a redisqueue queue into the stream. In-flight items go first in lease order, then the list.
+// KEYS: list, inflight, leases, attempts, list bytes, stream, stream bytes, names
+// ARGV: queue name
+var migrateScript = redis.NewScript(8, `
+redis.replicate_commands()
+local count, size = 0, 0
+local function add(value)
+  redis.call("XADD", KEYS[6], "*", "`+entryField+`", value)
+  count = count + 1
+  size = size + #value
+end
+for _, id in ipairs(redis.call("ZRANGE", KEYS[3], 0, -1)) do
+  local value = redis.call("HGET", KEYS[2], id)
+  if value then
+    add(value)
+  end
+end
+redis.call("DEL", KEYS[2], KEYS[3], KEYS[4], KEYS[5])
+local value = redis.call("LPOP", KEYS[1])
+while value do
+  add(value)
+  value = redis.call("LPOP", KEYS[1])
+end
+if count > 0 then
+  if redis.call("EXISTS", KEYS[7]) == 1 then
+    redis.call("INCRBY", KEYS[7], size)
+  end
+  redis.call("SADD", KEYS[8], ARGV[1])
+end
+return count
+`)
+
+// streamLua has helpers for the scripts that get their keys from scriptArgs. The bytes key holds the total length of
+// the values in the stream. Streams written before it was kept don't have one until streamBytes counts them.
+// KEYS: stream, bytes, dead, names
+const streamLua = `
+local function entryValue(entry)
+  if type(entry[2]) ~= "table" then
+    return nil
+  end
+  for i = 1, #entry[2], 2 do
+    if entry[2][i] == "` + entryField + `" then
+      return entry[2][i + 1]
+    end
+  end
+  return nil
+end
+
+-- entrySize returns the length of an entry's value, or nil when the entry isn't in the stream
+local function entrySize(id)
+  local entry = redis.call("XRANGE", KEYS[1], id, id)[1]
+  if not entry then
+    return nil
+  end
+  return #(entryValue(entry) or "")
+end
+
+local function streamBytes()
+  local size = redis.call("GET", KEYS[2])
+  if size then
+    return tonumber(size)
+  end
+  size = 0
+  for _, entry in ipairs(redis.call("XRANGE", KEYS[1], "-", "+")) do
+    size = size + #(entryValue(entry) or "")
+  end
+  return size
+end
+
+local function addBytes(n)
+  if redis.call("XLEN", KEYS[1]) == 0 then
+    redis.call("DEL", KEYS[2])
+  elseif redis.call("EXISTS", KEYS[2]) == 1 then
+    redis.call("INCRBY", KEYS[2], n)
+  end
+end
+
+-- removeEntry acks and deletes an entry and returns its length
+local function removeEntry(group, id)
+  local size = entrySize(id) or 0
+  redis.call("XACK", KEYS[1], group, id)
+  redis.call("XDEL", KEYS[1], id)
+  return size
+end
+
+-- undelivered is the start of an XRANGE over the entries the group hasn't read yet
+local function undelivered(group)
+  for _, info in ipairs(redis.call("XINFO", "GROUPS", KEYS[1])) do
+    local name, id
+    for i = 1, #info, 2 do
+      if info[i] == "name" then
+        name = info[i + 1]
+      elseif info[i] == "last-delivered-id" then
+        id = info[i + 1]
+      end
+    end
+    if name == group and id ~= "0-0" then
+      return "(" .. id
+    end
+  end
+  return "-"
+end
+
+-- leases splits the pending entries that are still in the stream into the ones whose leases are running and the
+-- ones whose leases have expired, oldest first
+local function leases(group, lease)
+  local running, expired = {}, {}
+  local count = redis.call("XPENDING", KEYS[1], group)[1]
+  if count == 0 then
+    return running, expired
+  end
+  for _, pending in ipairs(redis.call("XPENDING", KEYS[1], group, "-", "+", count)) do
+    if entrySize(pending[1]) then
+      if pending[3] < tonumber(lease) then
+        table.insert(running, pending[1])
+      else
+        table.insert(expired, pending[1])
+      end
+    end
+  end
+  return running, expired
+end
+`
+
+// pendingLua checks that an entry is still pending with the delivery count it was popped with.
+const pendingLua = `
+local function pending(group, id, deliveries)
+  if redis.call("EXISTS", KEYS[1]) == 0 then
+    return false
+  end
+  local entries = redis.call("XPENDING", KEYS[1], group, id, id, 1)
+  return #entries == 1 and entries[1][4] == tonumber(deliveries)
+end
+`
+
+// pushScript appends values to the stream while keeping the waiting entries within limits the way
+// queue.Limits.Check does. It returns how many values it dropped and which limit rejected the push, if any.
+// ARGV: group, lease in milliseconds, queue name, max items, max bytes, overflow, values...
+var pushScript = redis.NewScript(4, streamLua+`
+redis.replicate_commands()
+local group, lease = ARGV[1], ARGV[2]
+local maxItems, maxBytes, overflow = tonumber(ARGV[4]), tonumber(ARGV[5]), ARGV[6]
+if redis.call("EXISTS", KEYS[1]) == 0 then
+  redis.call("XGROUP", "CREATE", KEYS[1], group, "0", "MKSTREAM")
+end
+redis.call("SADD", KEYS[4], ARGV[3])
+if maxItems == 0 and maxBytes == 0 then
+  local size = 0
+  for i = 7, #ARGV do
+    redis.call("XADD", KEYS[1], "*", "`+entryField+`", ARGV[i])
+    size = size + #ARGV[i]
+  end
+  addBytes(size)
+  return {0, ""}
+end
+local function over(count, size)
+  if maxItems > 0 and count > maxItems then
+    return "items"
+  end
+  if maxBytes > 0 and size > maxBytes then
+    return "bytes"
+  end
+  return ""
+end
+local running, expired = leases(group, lease)
+local count, size = redis.call("XLEN", KEYS[1]), streamBytes()
+local leased = size
+for _, id in ipairs(running) do
+  count = count - 1
+  size = size - entrySize(id)
+end
+leased = leased - size
+if overflow == "" or overflow == "reject" then
+  local total = size
+  for i = 7, #ARGV do
+    total = total + #ARGV[i]
+  end
+  local limit = over(count + #ARGV - 6, total)
+  if limit ~= "" then
+    return {0, limit}
+  end
+end
+local start = undelivered(group)
+local function dropOldest()
+  local id = table.remove(expired, 1)
+  if not id then
+    id = redis.call("XRANGE", KEYS[1], start, "+", "COUNT", 1)[1][1]
+  end
+  return removeEntry(group, id)
+end
+local dropped = 0
+for i = 7, #ARGV do
+  local value = ARGV[i]
+  if over(1, #value) ~= "" or (overflow == "dropNewest" and over(count + 1, size + #value) ~= "") then
+    dropped = dropped + 1
+  else
+    while count > 0 and over(count + 1, size + #value) ~= "" do
+      size = size - dropOldest()
+      count = count - 1
+      dropped = dropped + 1
+    end
+    redis.call("XADD", KEYS[1], "*", "`+entryField+`", value)
+    count = count + 1
+    size = size + #value
+  end
+end
+if redis.call("XLEN", KEYS[1]) > 0 then
+  redis.call("SET", KEYS[2], size + leased)
+end
+return {dropped, ""}
+`)
+
+// statsScript returns the number of waiting entries, in-flight entries and dead letters, and the values of the
+// oldest and newest waiting entries.
+// ARGV: group, lease in milliseconds
+var statsScript = redis.NewScript(4, streamLua+`
+local dead = redis.call("LLEN", KEYS[3])
+if redis.call("EXISTS", KEYS[1]) == 0 then
+  return {0, 0, dead, false, false}
+end
+local running, expired = leases(ARGV[1], ARGV[2])
+local oldest, newest = expired[1], expired[#expired]
+local first = redis.call("XRANGE", KEYS[1], undelivered(ARGV[1]), "+", "COUNT", 1)[1]
+if first then
+  oldest = oldest or first[1]
+  newest = redis.call("XREVRANGE", KEYS[1], "+", "-", "COUNT", 1)[1][1]
+end
+local function value(id)
+  if not id then
+    return false
+  end
+  return entryValue(redis.call("XRANGE", KEYS[1], id, id)[1]) or false
+end
+return {redis.call("XLEN", KEYS[1]) - #running, #running, dead, value(oldest), value(newest)}
+`)
+
+// purgeScript removes the waiting entries and returns how many it removed.
+// ARGV: group, lease in milliseconds
+var purgeScript = redis.NewScript(4, streamLua+`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+  return 0
+end
+local group = ARGV[1]
+local _, expired = leases(group, ARGV[2])
+local count, size = 0, 0
+for _, id in ipairs(expired) do
+  size = size + removeEntry(group, id)
+  count = count + 1
+end
+local start = undelivered(group)
+local entries = redis.call("XRANGE", KEYS[1], start, "+", "COUNT", 100)
+while #entries > 0 do
+  for _, entry in ipairs(entries) do
+    size = size + removeEntry(group, entry[1])
+    count = count + 1
+  end
+  entries = redis.call("XRANGE", KEYS[1], start, "+", "COUNT", 100)
+end
+addBytes(-size)
+return count
+`)
+
+// removeScript removes an entry unless its lease is running. It returns how many entries it removed.
+// ARGV: group, lease in milliseconds, entry id
+var removeScript = redis.NewScript(4, streamLua+`
+if redis.call("EXISTS", KEYS[1]) == 0 or not entrySize(ARGV[3]) then
+  return 0
+end
+local pending = redis.call("XPENDING", KEYS[1], ARGV[1], ARGV[3], ARGV[3], 1)[1]
+if pending and pending[3] < tonumber(ARGV[2]) then
+  return 0
+end
+addBytes(-removeEntry(ARGV[1], ARGV[3]))
+return 1
+`)
+
+// ackScript acknowledges and deletes a pending entry.
+// ARGV: group, entry id, deliveries
+var ackScript = redis.NewScript(4, streamLua+pendingLua+`
+if not pending(ARGV[1], ARGV[2], ARGV[3]) then
+  return 0
+end
+addBytes(-removeEntry(ARGV[1], ARGV[2]))
+return 1
+`)
+
+// nackScript makes a pending entry look idle for a whole lease so the next Pop claims it. RETRYCOUNT keeps the
+// delivery count where it was.
+// ARGV: group, consumer, entry id, deliveries, lease in milliseconds
+var nackScript = redis.NewScript(4, pendingLua+`
+if not pending(ARGV[1], ARGV[3], ARGV[4]) then
+  return 0
+end
+redis.call("XCLAIM", KEYS[1], ARGV[1], ARGV[2], 0, ARGV[3], "IDLE", ARGV[5], "RETRYCOUNT", ARGV[4], "JUSTID")
+return 1
+`)
+
+// deadScript moves a pending entry to the dead-letter list.
+// ARGV: group, entry id, deliveries, value for the dead-letter list
+var deadScript = redis.NewScript(4, streamLua+pendingLua+`
+if not pending(ARGV[1], ARGV[2], ARGV[3]) then
+  return 0
+end
+addBytes(-removeEntry(ARGV[1], ARGV[2]))
+redis.call("RPUSH", KEYS[3], ARGV[4])
+return 1
+`)
+
+// requeueDeadScript appends the dead-letter list to the stream, keeping its order.
+var requeueDeadScript = redis.NewScript(4, streamLua+`
+redis.replicate_commands()
+local count, size = 0, 0
+local value = redis.call("LPOP", KEYS[3])
+while value do
+  redis.call("XADD", KEYS[1], "*", "`+entryField+`", value)
+  count = count + 1
+  size = size + #value
+  value = redis.call("LPOP", KEYS[3])
+end
+addBytes(size)
+return count
+`)
+
+//Queue is a queue
+type Queue struct {
+	Prefix string
+	Pool   *redis.Pool
+	// Group is the consumer group that reads every queue. Defaults to DefaultGroup.
+	Group string
+	// Consumer is this server's name in the consumer group. Defaults to the hostname.
+	Consumer string
+	// LeaseDuration is how long a popped item stays reserved before it is requeued. Defaults to queue.DefaultLeaseDuration.
+	LeaseDuration time.Duration
+	// MaxAttempts is how many times an item is delivered before it goes to the dead-letter list. Zero means no limit.
+	MaxAttempts int64
+
+	// prepared holds the names of queues that have been migrated and have a consumer group
+	prepared sync.Map
+}
+
+//New returns a new Queue
+func New(prefix string, pool *redis.Pool) *Queue {
+	consumer, err := os.Hostname()
+	if err != nil {
+		log.Println("failed getting hostname: ", err)
+	}
+	return &Queue{
+		Prefix:   prefix,
+		Pool:     pool,
+		Consumer: consumer,
+	}
+}
+
+// entry is one stream entry
+type entry struct {
+	id    string
+	value []byte
+}
+
+//Migrate moves a queue written by redisqueue into its stream and returns how many items it moved
+func (q *Queue) Migrate(ctx context.Context, queueName string) (int64, error) {
+	if err := q.validate(); err != nil {
+		return 0, err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	return q.migrate(conn, queueName)
+}
+
+func (q *Queue) migrate(conn redis.Conn, queueName string) (int64, error) {
+	count, err := redis.Int64(migrateScript.Do(conn,
+		q.listKey(queueName),
+		q.listKey(queueName)+":inflight",
+		q.listKey(queueName)+":leases",
+		q.listKey(queueName)+":attempts",
+		q.listKey(queueName)+":bytes",
+		q.streamKey(queueName),
+		q.bytesKey(queueName),
+		q.namesKey(),
+		queueName,
+	))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed migrating list")
+	}
+	if count > 0 {
+		log.Printf("migrated %d items from %s to %s", count, q.listKey(queueName), q.streamKey(queueName))
+	}
+	return count, nil
+}
+
+// prepare migrates the queue and creates its consumer group the first time the queue is used
+func (q *Queue) prepare(conn redis.Conn, queueName string) error {
+	if _, ok := q.prepared.Load(queueName); ok {
+		return nil
+	}
+	_, err := q.migrate(conn, queueName)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Do("XGROUP", "CREATE", q.streamKey(queueName), q.group(), "0", "MKSTREAM")
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return errors.Wrap(err, "failed creating consumer group")
+	}
+	q.prepared.Store(queueName, struct{}{})
+	return nil
+}
+
+// forget makes the next call prepare the queue again when the stream or group has gone away
+func (q *Queue) forget(queueName string, err error) error {
+	if gone(err) {
+		q.prepared.Delete(queueName)
+	}
+	return err
+}
+
+// gone reports whether err is redis saying the stream or group doesn't exist anymore
+func gone(err error) bool {
+	return err != nil && (strings.HasPrefix(err.Error(), "NOGROUP") || strings.HasPrefix(err.Error(), "UNBLOCKED"))
+}
+
+//Push adds to the queue
+func (q *Queue) Push(ctx context.Context, queueName string, webRequests []*queue.WebRequest) error {
+	_, err := q.PushLimited(ctx, queueName, webRequests, queue.Limits{})
+	return err
+}
+
+//PushLimited adds to the queue while keeping its waiting items within limits and returns how many items it dropped
+func (q *Queue) PushLimited(ctx context.Context, queueName string, webRequests []*queue.WebRequest,
+	limits queue.Limits) (int64, error) {
+	if err := q.validate(); err != nil {
+		return 0, err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	err := q.prepare(conn, queueName)
+	if err != nil {
+		return 0, err
+	}
+	args := q.scriptArgs(queueName, q.group(), millis(q.leaseDuration()), queueName,
+		limits.MaxItems, limits.MaxBytes, string(limits.Overflow))
+	for _, webRequest := range webRequests {
+		protoBytes, err := proto.Marshal(webRequest)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed marshaling protobuf")
+		}
+		args = append(args, protoBytes)
+	}
+	values, err := redis.Values(pushScript.Do(conn, args...))
+	if err != nil {
+		return 0, q.forget(queueName, err)
+	}
+	var dropped int64
+	var limit string
+	_, err = redis.Scan(values, &dropped, &limit)
+	if err != nil {
+		return 0, err
+	}
+	switch limit {
+	case "items":
+		return 0, queue.ErrMaxItems
+	case "bytes":
+		return 0, queue.ErrMaxBytes
+	}
+	return dropped, q.touch(conn, queueName)
+}
+
+//Pop pops the next item off the queue
+func (q *Queue) Pop(ctx context.Context, queueName string, timeout time.Duration) (*queue.WebRequest, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	err := q.prepare(conn, queueName)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		webRequest, err := q.next(ctx, conn, queueName)
+		if gone(err) {
+			// the queue was deleted while this waited, so wait on the new one
+			q.prepared.Delete(queueName)
+			err = q.prepare(conn, queueName)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if webRequest != nil {
+			return webRequest, q.touch(conn, queueName)
+		}
+		if ctx.Err() != nil {
+			return nil, nil
+		}
+	}
+}
+
+// next claims an expired entry or waits up to pollInterval for a new one
+func (q *Queue) next(ctx context.Context, conn redis.Conn, queueName string) (*queue.WebRequest, error) {
+	webRequest, err := q.claimExpired(conn, queueName)
+	if err != nil || webRequest != nil {
+		return webRequest, err
+	}
+	block := pollInterval
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < block {
+		block = time.Until(deadline)
+	}
+	if block < time.Millisecond {
+		return nil, nil
+	}
+	return q.read(conn, queueName, block)
+}
+
+// claimExpired claims the oldest entry whose lease has expired. Entries that have used up their attempts are
+// dead-lettered on the way.
+func (q *Queue) claimExpired(conn redis.Conn, queueName string) (*queue.WebRequest, error) {
+	for {
+		reply, err := redis.Values(conn.Do("XAUTOCLAIM", q.streamKey(queueName), q.group(), q.consumer(),
+			millis(q.leaseDuration()), "0-0", "COUNT", 1))
+		if err != nil {
+			return nil, err
+		}
+		if len(reply) < 2 {
+			return nil, errors.New("unexpected XAUTOCLAIM reply")
+		}
+		entries, err := parseEntries(reply[1])
+		if err != nil || len(entries) == 0 {
+			return nil, err
+		}
+		claimed := entries[0]
+		deliveries, err := q.deliveries(conn, queueName, claimed.id)
+		if err != nil {
+			return nil, err
+		}
+		webRequest, err := newWebRequest(claimed, deliveries)
+		if err != nil {
+			return nil, err
+		}
+		// the claim counted as a delivery, but nobody has seen it yet
+		previous := webRequest.Attempts - 1
+		if q.MaxAttempts == 0 || previous < q.MaxAttempts {
+			return webRequest, nil
+		}
+		webRequest.Attempts = previous
+		_, err = q.deadLetter(conn, queueName, claimed.id, deliveries, webRequest)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// read waits up to block for a new entry
+func (q *Queue) read(conn redis.Conn, queueName string, block time.Duration) (*queue.WebRequest, error) {
+	reply, err := redis.Values(conn.Do("XREADGROUP", "GROUP", q.group(), q.consumer(), "COUNT", 1,
+		"BLOCK", millis(block), "STREAMS", q.streamKey(queueName), ">"))
+	switch err {
+	case nil:
+	case redis.ErrNil:
+		return nil, nil
+	default:
+		return nil, err
+	}
+	for _, stream := range reply {
+		streamReply, err := redis.Values(stream, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(streamReply) < 2 {
+			return nil, errors.New("unexpected XREADGROUP reply")
+		}
+		entries, err := parseEntries(streamReply[1])
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) > 0 {
+			return newWebRequest(entries[0], 1)
+		}
+	}
+	return nil, nil
+}
+
+// deliveries returns how many times a pending entry has been delivered, or zero when it isn't pending
+func (q *Queue) deliveries(conn redis.Conn, queueName, entryID string) (int64, error) {
+	reply, err := redis.Values(conn.Do("XPENDING", q.streamKey(queueName), q.group(), entryID, entryID, 1))
+	if err != nil || len(reply) == 0 {
+		return 0, err
+	}
+	pending, err := redis.Values(reply[0], nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(pending) < 4 {
+		return 0, errors.New("unexpected XPENDING reply")
+	}
+	return redis.Int64(pending[3], nil)
+}
+
+// deadLetter moves a pending entry to the dead-letter list. It returns false when the entry was no longer pending.
+func (q *Queue) deadLetter(conn redis.Conn, queueName, entryID string, deliveries int64,
+	webRequest *queue.WebRequest) (bool, error) {
+	webRequest.ID = ""
+	value, err := proto.Marshal(webRequest)
+	if err != nil {
+		return false, errors.Wrap(err, "failed marshaling protobuf")
+	}
+	return redis.Bool(deadScript.Do(conn, q.scriptArgs(queueName, q.group(), entryID, deliveries, value)...))
+}
+
+//Ack removes a popped item from in-flight
+func (q *Queue) Ack(ctx context.Context, queueName, id string) error {
+	if err := q.validate(); err != nil {
+		return err
+	}
+	entryID, deliveries, ok := parseID(id)
+	if !ok {
+		return queue.ErrNotInFlight
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	acked, err := redis.Bool(ackScript.Do(conn, q.scriptArgs(queueName, q.group(), entryID, deliveries)...))
+	if err != nil {
+		return q.forget(queueName, err)
+	}
+	if !acked {
+		return queue.ErrNotInFlight
+	}
+	return q.touch(conn, queueName)
+}
+
+//Nack returns a popped item to the head of the queue, or to the dead-letter list once it reaches MaxAttempts
+func (q *Queue) Nack(ctx context.Context, queueName, id string) error {
+	if err := q.validate(); err != nil {
+		return err
+	}
+	entryID, deliveries, ok := parseID(id)
+	if !ok {
+		return queue.ErrNotInFlight
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	values, err := redis.Values(conn.Do("XRANGE", q.streamKey(queueName), entryID, entryID))
+	if err != nil {
+		return err
+	}
+	entries, err := parseEntries(values)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return queue.ErrNotInFlight
+	}
+	webRequest, err := newWebRequest(entries[0], deliveries)
+	if err != nil {
+		return err
+	}
+	var nacked bool
+	if q.MaxAttempts > 0 && webRequest.Attempts >= q.MaxAttempts {
+		nacked, err = q.deadLetter(conn, queueName, entryID, deliveries, webRequest)
+	} else {
+		nacked, err = redis.Bool(nackScript.Do(conn, q.scriptArgs(queueName, q.group(), q.consumer(),
+			entryID, deliveries, millis(q.leaseDuration()))...))
+	}
+	if err != nil {
+		return q.forget(queueName, err)
+	}
+	if !nacked {
+		return queue.ErrNotInFlight
+	}
+	return q.touch(conn, queueName)
+}
+
+//Peek show the next few items in the queue that have not been delivered yet
+func (q *Queue) Peek(ctx context.Context, queueName string, count int64) ([]*queue.WebRequest, error) {
+	response := make([]*queue.WebRequest, 0)
+	if err := q.validate(); err != nil {
+		return response, err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	err := q.prepare(conn, queueName)
+	if err != nil {
+		return response, err
+	}
+	if count <= 0 {
+		count = 10
+	}
+	start, err := q.lastDeliveredID(conn, queueName)
+	if err != nil {
+		return response, err
+	}
+	if start == "" {
+		start = "-"
+	} else {
+		start = "(" + start
+	}
+	values, err := redis.Values(conn.Do("XRANGE", q.streamKey(queueName), start, "+", "COUNT", count))
+	if err != nil {
+		return response, err
+	}
+	entries, err := parseEntries(values)
+	if err != nil {
+		return response, err
+	}
+	for _, e := range entries {
+		webRequest := new(queue.WebRequest)
+		err = proto.Unmarshal(e.value, webRequest)
+		if err != nil {
+			return response, err
+		}
+		response = append(response, webRequest)
+	}
+	return response, nil
+}
+
+// lastDeliveredID returns the id of the last entry the group has read, or "" when it hasn't read anything
+func (q *Queue) lastDeliveredID(conn redis.Conn, queueName string) (string, error) {
+	groups, err := redis.Values(conn.Do("XINFO", "GROUPS", q.streamKey(queueName)))
+	if err != nil {
+		return "", q.forget(queueName, err)
+	}
+	for _, group := range groups {
+		fields, err := redis.Values(group, nil)
+		if err != nil {
+			return "", err
+		}
+		var name, lastDeliveredID string
+		for i := 0; i+1 < len(fields); i += 2 {
+			switch key, _ := redis.String(fields[i], nil); key {
+			case "name":
+				name, _ = redis.String(fields[i+1], nil)
+			case "last-delivered-id":
+				lastDeliveredID, _ = redis.String(fields[i+1], nil)
+			}
+		}
+		if name != q.group() {
+			continue
+		}
+		if lastDeliveredID == "0-0" {
+			lastDeliveredID = ""
+		}
+		return lastDeliveredID, nil
+	}
+	return "", nil
+}
+
+//PeekDead shows the next few items in the queue's dead-letter list
+func (q *Queue) PeekDead(ctx context.Context, queueName string, count int64) ([]*queue.WebRequest, error) {
+	response := make([]*queue.WebRequest, 0)
+	if err := q.validate(); err != nil {
+		return response, err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	if count <= 0 {
+		count = 10
+	}
+	values, err := redis.ByteSlices(conn.Do("LRANGE", q.deadKey(queueName), 0, count-1))
+	switch err {
+	case nil:
+	case redis.ErrNil:
+		return response, nil
+	default:
+		return response, err
+	}
+	for _, webRequestBytes := range values {
+		webRequest := new(queue.WebRequest)
+		err = proto.Unmarshal(webRequestBytes, webRequest)
+		if err != nil {
+			return response, err
+		}
+		response = append(response, webRequest)
+	}
+	return response, nil
+}
+
+//RequeueDead moves everything in the dead-letter list to the end of the stream and returns how many items it moved
+func (q *Queue) RequeueDead(ctx context.Context, queueName string) (int64, error) {
+	if err := q.validate(); err != nil {
+		return 0, err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	err := q.prepare(conn, queueName)
+	if err != nil {
+		return 0, err
+	}
+	return redis.Int64(requeueDeadScript.Do(conn, q.scriptArgs(queueName)...))
+}
+
+//HealthCheck pings redis
+func (q *Queue) HealthCheck(ctx context.Context) error {
+	if err := q.validate(); err != nil {
+		return err
+	}
+	errs := make(chan error, 1)
+	go func() {
+		conn := q.conn()
+		defer closeOrLog(conn)
+		_, err := conn.Do("PING")
+		errs <- err
+	}()
+	select {
+	case err := <-errs:
+		return errors.Wrap(err, "failed pinging redis")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//ListQueues returns the names of the queues that have been pushed to
+func (q *Queue) ListQueues(ctx context.Context) ([]string, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	queueNames, err := redis.Strings(conn.Do("SMEMBERS", q.namesKey()))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(queueNames)
+	return queueNames, nil
+}
+
+//Stats describes a queue
+func (q *Queue) Stats(ctx context.Context, queueName string) (*queue.QueueStats, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	values, err := statsScript.Do(conn, q.scriptArgs(queueName, q.group(), millis(q.leaseDuration()))...)
+	if err != nil {
+		return nil, q.forget(queueName, err)
+	}
+	lastActivity, err := conn.Do("GET", q.activityKey(queueName))
+	if err != nil {
+		return nil, err
+	}
+	return parseStats(queueName, values, lastActivity)
+}
+
+// statsBatchSize is how many queues StatsBatch describes per round trip
+const statsBatchSize = 100
+
+//StatsBatch describes several queues, pipelining the commands for up to statsBatchSize queues at a time
+func (q *Queue) StatsBatch(ctx context.Context, queueNames []string) ([]*queue.QueueStats, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	err := statsScript.Load(conn)
+	if err != nil {
+		return nil, err
+	}
+	all := make([]*queue.QueueStats, 0, len(queueNames))
+	for start := 0; start < len(queueNames); start += statsBatchSize {
+		batch := queueNames[start:]
+		if len(batch) > statsBatchSize {
+			batch = batch[:statsBatchSize]
+		}
+		for _, queueName := range batch {
+			err = statsScript.SendHash(conn, q.scriptArgs(queueName, q.group(), millis(q.leaseDuration()))...)
+			if err != nil {
+				return nil, err
+			}
+			err = conn.Send("GET", q.activityKey(queueName))
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = conn.Flush()
+		if err != nil {
+			return nil, err
+		}
+		// every reply is read before returning an error so the connection goes back to the pool in sync
+		var firstErr error
+		for _, queueName := range batch {
+			values, err := conn.Receive()
+			if err != nil && firstErr == nil {
+				firstErr = q.forget(queueName, err)
+			}
+			lastActivity, err := conn.Receive()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if firstErr != nil {
+				continue
+			}
+			stats, err := parseStats(queueName, values, lastActivity)
+			if err != nil {
+				firstErr = err
+				continue
+			}
+			all = append(all, stats)
+		}
+		if firstErr != nil {
+			return nil, firstErr
+		}
+	}
+	return all, nil
+}
+
+// parseStats reads the replies to statsScript and a GET of the activity key
+func parseStats(queueName string, reply, lastActivity interface{}) (*queue.QueueStats, error) {
+	values, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	stats := &queue.QueueStats{QueueName: queueName}
+	var oldest, newest []byte
+	_, err = redis.Scan(values, &stats.Depth, &stats.InFlight, &stats.Dead, &oldest, &newest)
+	if err != nil {
+		return nil, err
+	}
+	stats.OldestReceivedAt, err = receivedAt(oldest)
+	if err != nil {
+		return nil, err
+	}
+	stats.NewestReceivedAt, err = receivedAt(newest)
+	if err != nil || lastActivity == nil {
+		return stats, err
+	}
+	millis, err := redis.Int64(lastActivity, nil)
+	if err != nil {
+		return nil, err
+	}
+	stats.LastActivity, err = ptypes.TimestampProto(time.Unix(0, millis*int64(time.Millisecond)))
+	return stats, err
+}
+
+// receivedAt unmarshals an entry's value and returns its ReceivedAt
+func receivedAt(value []byte) (*timestamp.Timestamp, error) {
+	if value == nil {
+		return nil, nil
+	}
+	webRequest := new(queue.WebRequest)
+	err := proto.Unmarshal(value, webRequest)
+	if err != nil {
+		return nil, err
+	}
+	return webRequest.GetReceivedAt(), nil
+}
+
+//Purge removes the waiting items and returns how many it removed
+func (q *Queue) Purge(ctx context.Context, queueName string) (int64, error) {
+	if err := q.validate(); err != nil {
+		return 0, err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	count, err := redis.Int64(purgeScript.Do(conn, q.scriptArgs(queueName, q.group(), millis(q.leaseDuration()))...))
+	return count, q.forget(queueName, err)
+}
+
+//Delete removes everything in the queue, including anything redisqueue left behind
+func (q *Queue) Delete(ctx context.Context, queueName string) error {
+	if err := q.validate(); err != nil {
+		return err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	keys := []interface{}{q.streamKey(queueName), q.bytesKey(queueName), q.deadKey(queueName), q.activityKey(queueName)}
+	for _, suffix := range []string{"", ":inflight", ":leases", ":attempts", ":bytes"} {
+		keys = append(keys, q.listKey(queueName)+suffix)
+	}
+	_, err := conn.Do("DEL", keys...)
+	if err != nil {
+		return err
+	}
+	q.prepared.Delete(queueName)
+	_, err = conn.Do("SREM", q.namesKey(), queueName)
+	return err
+}
+
+//Expire discards waiting items and dead letters received before receivedBefore and returns how many it discarded
+func (q *Queue) Expire(ctx context.Context, queueName string, receivedBefore time.Time) (int64, error) {
+	if err := q.validate(); err != nil {
+		return 0, err
+	}
+	conn := q.conn()
+	defer closeOrLog(conn)
+	var count int64
+	start := "-"
+	for {
+		values, err := redis.Values(conn.Do("XRANGE", q.streamKey(queueName), start, "+", "COUNT", expireBatchSize))
+		if err != nil {
+			return count, err
+		}
+		entries, err := parseEntries(values)
+		if err != nil {
+			return count, err
+		}
+		for _, e := range entries {
+			webRequest := new(queue.WebRequest)
+			if proto.Unmarshal(e.value, webRequest) != nil || !webRequest.ReceivedBefore(receivedBefore) {
+				continue
+			}
+			removed, err := redis.Int64(removeScript.Do(conn,
+				q.scriptArgs(queueName, q.group(), millis(q.leaseDuration()), e.id)...))
+			if err != nil {
+				return count, q.forget(queueName, err)
+			}
+			count += removed
+		}
+		if len(values) < expireBatchSize || len(entries) == 0 {
+			break
+		}
+		start = "(" + entries[len(entries)-1].id
+	}
+	dead, err := q.expireDead(conn, queueName, receivedBefore)
+	return count + dead, err
+}
+
+// expireDead removes the dead letters received before receivedBefore
+func (q *Queue) expireDead(conn redis.Conn, queueName string, receivedBefore time.Time) (int64, error) {
+	var count int64
+	for start := 0; ; start += expireBatchSize {
+		values, err := redis.ByteSlices(conn.Do("LRANGE", q.deadKey(queueName), start, start+expireBatchSize-1))
+		if err != nil {
+			return count, err
+		}
+		var removed int64
+		for _, value := range values {
+			webRequest := new(queue.WebRequest)
+			if proto.Unmarshal(value, webRequest) != nil || !webRequest.ReceivedBefore(receivedBefore) {
+				continue
+			}
+			n, err := redis.Int64(conn.Do("LREM", q.deadKey(queueName), 1, value))
+			if err != nil {
+				return count, err
+			}
+			removed += n
+		}
+		count += removed
+		if len(values) < expireBatchSize {
+			return count, nil
+		}
+		// the items after the removed ones moved up
+		start -= int(removed)
+	}
+}
+
+// touch records activity on a queue
+func (q *Queue) touch(conn redis.Conn, queueName string) error {
+	_, err := conn.Do("SET", q.activityKey(queueName), time.Now().UnixNano()/int64(time.Millisecond))
+	return errors.Wrap(err, "failed recording activity")
+}
+
+// newWebRequest unmarshals a stream entry that has been delivered deliveries times
+func newWebRequest(e entry, deliveries int64) (*queue.WebRequest, error) {
+	webRequest := new(queue.WebRequest)
+	err := proto.Unmarshal(e.value, webRequest)
+	if err != nil {
+		return nil, err
+	}
+	webRequest.Attempts += deliveries
+	webRequest.ID = e.id + ":" + strconv.FormatInt(deliveries, 10)
+	return webRequest, nil
+}
+
+// parseID splits an id from newWebRequest into the stream entry id and delivery count
+func parseID(id string) (entryID string, deliveries int64, ok bool) {
+	i := strings.LastIndex(id, ":")
+	if i < 0 {
+		return "", 0, false
+	}
+	entryID = id[:i]
+	deliveries, err := strconv.ParseInt(id[i+1:], 10, 64)
+	if err != nil || deliveries < 1 {
+		return "", 0, false
+	}
+	parts := strings.Split(entryID, "-")
+	if len(parts) != 2 {
+		return "", 0, false
+	}
+	for _, part := range parts {
+		if _, err := strconv.ParseUint(part, 10, 64); err != nil {
+			return "", 0, false
+		}
+	}
+	return entryID, deliveries, true
+}
+
+// parseEntries reads the entries in an XRANGE, XREADGROUP or XAUTOCLAIM reply. Deleted entries are skipped.
+func parseEntries(reply interface{}) ([]entry, error) {
+	values, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]entry, 0, len(values))
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+		parts, err := redis.Values(value, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(parts) < 2 || parts[1] == nil {
+			continue
+		}
+		id, err := redis.String(parts[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		fields, err := redis.Values(parts[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i+1 < len(fields); i += 2 {
+			if name, _ := redis.String(fields[i], nil); name != entryField {
+				continue
+			}
+			data, err := redis.Bytes(fields[i+1], nil)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry{id: id, value: data})
+		}
+	}
+	return entries, nil
+}
+
+// conn gets a connection from the pool that counts errors the way redisqueue does
+func (q *Queue) conn() redis.Conn {
+	return redisqueue.CountErrors(q.Pool.Get())
+}
+
+// listKey is the key redisqueue uses for the queue
+func (q *Queue) listKey(queueName string) string {
+	return q.Prefix + ":" + queueName
+}
+
+func (q *Queue) streamKey(queueName string) string {
+	return q.listKey(queueName) + ":stream"
+}
+
+func (q *Queue) bytesKey(queueName string) string {
+	return q.streamKey(queueName) + ":bytes"
+}
+
+func (q *Queue) deadKey(queueName string) string {
+	return q.listKey(queueName) + ":dead"
+}
+
+// activityKey is shared with redisqueue, so migrated queues keep their last activity
+func (q *Queue) activityKey(queueName string) string {
+	return q.listKey(queueName) + ":activity"
+}
+
+// namesKey is the set of queue names. It can't be mistaken for a queue's key, because those all start with Prefix
+// and a colon.
+func (q *Queue) namesKey() string {
+	return q.Prefix + "#queues"
+}
+
+// scriptArgs returns the keys scripts using streamLua expect, followed by argv
+func (q *Queue) scriptArgs(queueName string, argv ...interface{}) []interface{} {
+	return append([]interface{}{
+		q.streamKey(queueName),
+		q.bytesKey(queueName),
+		q.deadKey(queueName),
+		q.namesKey(),
+	}, argv...)
+}
+
+func (q *Queue) group() string {
+	if q.Group != "" {
+		return q.Group
+	}
+	return DefaultGroup
+}
+
+func (q *Queue) consumer() string {
+	if q.Consumer != "" {
+		return q.Consumer
+	}
+	return q.group()
+}
+
+func (q *Queue) leaseDuration() time.Duration {
+	if q.LeaseDuration > 0 {
+		return q.LeaseDuration
+	}
+	return queue.DefaultLeaseDuration
+}
+
+// millis converts a duration to the whole milliseconds redis expects, rounding up so it is never zero
+func millis(d time.Duration) int64 {
+	return int64((d + time.Millisecond - 1) / time.Millisecond)
+}
+
+func (q *Queue) validate() error {
+	if q.Prefix == "" {
+		return errEmptyPrefix
+	}
+	if q.Pool == nil {
+		return errNilPool
+	}
+	return nil
+}
+
+func closeOrLog(cl io.Closer) {
+	err := cl.Close()
+	if err != nil {
+		log.Println("failed to close: ", err)
+	}
+}
@@ -0,0 +1,301 @@
+package streamqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/WillAbides/xqsmee/metrics"
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/WillAbides/xqsmee/queue/queuetest"
+	"github.com/WillAbides/xqsmee/queue/redisqueue"
+	"github.com/golang/protobuf/proto"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var redisPool = &redis.Pool{
+	MaxActive: 100,
+	Wait:      true,
+	Dial: func() (redis.Conn, error) {
+		return redis.DialURL("redis://:6379/11")
+	},
+	TestOnBorrow: func(c redis.Conn, t time.Time) error {
+		_, err := c.Do("PING")
+		return err
+	},
+}
+
+type testObjects struct {
+	queue   *Queue
+	assert  *assert.Assertions
+	require *require.Assertions
+	*testing.T
+}
+
+func testSetup(t *testing.T) *testObjects {
+	t.Helper()
+
+	conn := redisPool.Get()
+	defer closeOrLog(conn)
+	_, err := conn.Do("FLUSHDB")
+	require.Nil(t, err)
+
+	return &testObjects{
+		queue:   New("foo", redisPool),
+		assert:  assert.New(t),
+		require: require.New(t),
+		T:       t,
+	}
+}
+
+func TestQueue(t *testing.T) {
+	queuetest.Run(t, func(t *testing.T, opts queuetest.Options) queue.Queue {
+		tt := testSetup(t)
+		tt.queue.LeaseDuration = opts.LeaseDuration
+		tt.queue.MaxAttempts = opts.MaxAttempts
+		return tt.queue
+	})
+}
+
+func TestQueue_Migrate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("moves queued and in-flight items", func(t *testing.T) {
+		tt := testSetup(t)
+		listQueue := redisqueue.New("foo", redisPool)
+		tt.require.Nil(listQueue.Push(ctx, "bar", []*queue.WebRequest{
+			{Body: []byte("1")},
+			{Body: []byte("2")},
+			{Body: []byte("3")},
+		}))
+		inFlight, err := listQueue.Pop(ctx, "bar", time.Second)
+		tt.require.Nil(err)
+		tt.require.NotNil(inFlight)
+
+		count, err := tt.queue.Migrate(ctx, "bar")
+		tt.assert.Nil(err)
+		tt.assert.Equal(int64(3), count)
+
+		leftovers, err := listQueue.Peek(ctx, "bar", 0)
+		tt.assert.Nil(err)
+		tt.assert.Empty(leftovers)
+		tt.assert.Equal(queue.ErrNotInFlight, listQueue.Ack(ctx, "bar", inFlight.GetID()))
+
+		got, err := tt.queue.Pop(ctx, "bar", 100*time.Millisecond)
+		tt.require.Nil(err)
+		tt.require.NotNil(got)
+		tt.assert.Equal("1", string(got.GetBody()))
+		tt.assert.Equal(int64(2), got.GetAttempts())
+		for _, body := range []string{"2", "3"} {
+			got, err := tt.queue.Pop(ctx, "bar", 100*time.Millisecond)
+			tt.require.Nil(err)
+			tt.require.NotNil(got)
+			tt.assert.Equal(body, string(got.GetBody()))
+			tt.assert.Equal(int64(1), got.GetAttempts())
+		}
+	})
+
+	t.Run("happens on first use", func(t *testing.T) {
+		tt := testSetup(t)
+		listQueue := redisqueue.New("foo", redisPool)
+		tt.require.Nil(listQueue.Push(ctx, "bar", []*queue.WebRequest{{Body: []byte("old")}}))
+		tt.require.Nil(tt.queue.Push(ctx, "bar", []*queue.WebRequest{{Body: []byte("new")}}))
+		peeked, err := tt.queue.Peek(ctx, "bar", 0)
+		tt.assert.Nil(err)
+		tt.require.Len(peeked, 2)
+		tt.assert.Equal("old", string(peeked[0].GetBody()))
+		tt.assert.Equal("new", string(peeked[1].GetBody()))
+	})
+
+	t.Run("shares dead letters", func(t *testing.T) {
+		tt := testSetup(t)
+		listQueue := redisqueue.New("foo", redisPool)
+		listQueue.MaxAttempts = 1
+		tt.require.Nil(listQueue.Push(ctx, "bar", []*queue.WebRequest{{Body: []byte("foo")}}))
+		got, err := listQueue.Pop(ctx, "bar", time.Second)
+		tt.require.Nil(err)
+		tt.require.NotNil(got)
+		tt.require.Nil(listQueue.Nack(ctx, "bar", got.GetID()))
+
+		dead, err := tt.queue.PeekDead(ctx, "bar", 0)
+		tt.assert.Nil(err)
+		tt.require.Len(dead, 1)
+		tt.assert.Equal("foo", string(dead[0].GetBody()))
+	})
+}
+
+func TestQueue_Peek(t *testing.T) {
+	t.Run("skips delivered entries", func(t *testing.T) {
+		tt := testSetup(t)
+		ctx := context.Background()
+		tt.require.Nil(tt.queue.Push(ctx, "bar", []*queue.WebRequest{{Body: []byte("1")}, {Body: []byte("2")}}))
+		got, err := tt.queue.Pop(ctx, "bar", 100*time.Millisecond)
+		tt.require.Nil(err)
+		tt.require.NotNil(got)
+		peeked, err := tt.queue.Peek(ctx, "bar", 0)
+		tt.assert.Nil(err)
+		tt.require.Len(peeked, 1)
+		tt.assert.Equal("2", string(peeked[0].GetBody()))
+	})
+}
+
+func TestQueue_claimExpired(t *testing.T) {
+	t.Run("dead-letters entries that expire on their last attempt", func(t *testing.T) {
+		tt := testSetup(t)
+		ctx := context.Background()
+		tt.queue.LeaseDuration = time.Millisecond
+		tt.queue.MaxAttempts = 1
+		tt.require.Nil(tt.queue.Push(ctx, "bar", []*queue.WebRequest{{Body: []byte("foo")}}))
+		got, err := tt.queue.Pop(ctx, "bar", 100*time.Millisecond)
+		tt.require.Nil(err)
+		tt.require.NotNil(got)
+		time.Sleep(5 * time.Millisecond)
+
+		got, err = tt.queue.Pop(ctx, "bar", 10*time.Millisecond)
+		tt.assert.Nil(err)
+		tt.assert.Nil(got)
+		dead, err := tt.queue.PeekDead(ctx, "bar", 0)
+		tt.assert.Nil(err)
+		tt.require.Len(dead, 1)
+		tt.assert.True(proto.Equal(&queue.WebRequest{Body: []byte("foo"), Attempts: 1}, dead[0]))
+	})
+}
+
+func TestQueue_bytes(t *testing.T) {
+	// streamBytes adds up the values in the stream the slow way
+	streamBytes := func(tt *testObjects) int64 {
+		tt.Helper()
+		conn := redisPool.Get()
+		defer closeOrLog(conn)
+		values, err := redis.Values(conn.Do("XRANGE", tt.queue.streamKey("bar"), "-", "+"))
+		tt.require.Nil(err)
+		entries, err := parseEntries(values)
+		tt.require.Nil(err)
+		var size int64
+		for _, e := range entries {
+			size += int64(len(e.value))
+		}
+		return size
+	}
+	bytesKey := func(tt *testObjects) int64 {
+		tt.Helper()
+		conn := redisPool.Get()
+		defer closeOrLog(conn)
+		size, err := redis.Int64(conn.Do("GET", tt.queue.bytesKey("bar")))
+		if err == redis.ErrNil {
+			return 0
+		}
+		tt.require.Nil(err)
+		return size
+	}
+
+	t.Run("keeps the bytes key at the size of the stream", func(t *testing.T) {
+		tt := testSetup(t)
+		ctx := context.Background()
+		tt.queue.MaxAttempts = 1
+		limits := queue.Limits{MaxItems: 4, Overflow: queue.OverflowDropOldest}
+		_, err := tt.queue.PushLimited(ctx, "bar", []*queue.WebRequest{
+			{Body: []byte("1")}, {Body: []byte("22")}, {Body: []byte("333")}, {Body: []byte("4444")},
+		}, limits)
+		tt.require.Nil(err)
+		tt.assert.Equal(streamBytes(tt), bytesKey(tt))
+
+		for _, done := range []func(string) error{
+			func(id string) error { return tt.queue.Ack(ctx, "bar", id) },
+			func(id string) error { return tt.queue.Nack(ctx, "bar", id) },
+		} {
+			got, err := tt.queue.Pop(ctx, "bar", 100*time.Millisecond)
+			tt.require.Nil(err)
+			tt.require.NotNil(got)
+			tt.require.Nil(done(got.GetID()))
+			tt.assert.Equal(streamBytes(tt), bytesKey(tt))
+		}
+
+		_, err = tt.queue.RequeueDead(ctx, "bar")
+		tt.require.Nil(err)
+		tt.assert.Equal(streamBytes(tt), bytesKey(tt))
+		dropped, err := tt.queue.PushLimited(ctx, "bar", []*queue.WebRequest{{Body: []byte("55555")}}, limits)
+		tt.require.Nil(err)
+		tt.assert.Equal(int64(0), dropped)
+		dropped, err = tt.queue.PushLimited(ctx, "bar", []*queue.WebRequest{{Body: []byte("666666")}}, limits)
+		tt.require.Nil(err)
+		tt.assert.Equal(int64(1), dropped)
+		tt.assert.Equal(streamBytes(tt), bytesKey(tt))
+
+		_, err = tt.queue.Purge(ctx, "bar")
+		tt.require.Nil(err)
+		tt.assert.Equal(int64(0), bytesKey(tt))
+	})
+
+	t.Run("counts streams written before the bytes key", func(t *testing.T) {
+		tt := testSetup(t)
+		ctx := context.Background()
+		tt.require.Nil(tt.queue.Push(ctx, "bar", []*queue.WebRequest{{Body: []byte("12345")}}))
+		conn := redisPool.Get()
+		defer closeOrLog(conn)
+		_, err := conn.Do("DEL", tt.queue.bytesKey("bar"))
+		tt.require.Nil(err)
+		_, err = tt.queue.PushLimited(ctx, "bar", []*queue.WebRequest{{Body: []byte("12345")}},
+			queue.Limits{MaxBytes: 10})
+		tt.assert.Equal(queue.ErrMaxBytes, err)
+		tt.assert.Equal(int64(0), bytesKey(tt))
+		_, err = tt.queue.PushLimited(ctx, "bar", []*queue.WebRequest{{Body: []byte("1")}}, queue.Limits{MaxBytes: 20})
+		tt.assert.Nil(err)
+		tt.assert.Equal(streamBytes(tt), bytesKey(tt))
+	})
+}
+
+func TestQueue_conn(t *testing.T) {
+	// redisErrors reads the redis error count for a command from the metrics registry
+	redisErrors := func(t *testing.T, command string) float64 {
+		t.Helper()
+		families, err := metrics.Default.Gather()
+		require.Nil(t, err)
+		for _, family := range families {
+			if family.GetName() != "xqsmee_redis_errors_total" {
+				continue
+			}
+			for _, m := range family.GetMetric() {
+				if m.GetLabel()[0].GetValue() == command {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+		return 0
+	}
+
+	tt := testSetup(t)
+	conn := tt.queue.conn()
+	defer closeOrLog(conn)
+	_, err := conn.Do("SET", tt.queue.streamKey("bar"), "not a stream")
+	tt.require.Nil(err)
+	before := redisErrors(t, "XADD")
+	_, err = conn.Do("XADD", tt.queue.streamKey("bar"), "*", entryField, "foo")
+	tt.assert.NotNil(err)
+	tt.assert.Equal(before+1, redisErrors(t, "XADD"))
+}
+
+func Test_parseID(t *testing.T) {
+	for _, id := range []string{"", "nope", "1-0", "1-0:", "1-0:0", "x-0:1", "1:1", "1-0-0:1"} {
+		_, _, ok := parseID(id)
+		assert.False(t, ok, id)
+	}
+	entryID, deliveries, ok := parseID("1526919030474-55:3")
+	assert.True(t, ok)
+	assert.Equal(t, "1526919030474-55", entryID)
+	assert.Equal(t, int64(3), deliveries)
+}
+
+func TestQueue_validate(t *testing.T) {
+	t.Run("checks for empty prefix", func(t *testing.T) {
+		q := &Queue{Pool: redisPool}
+		assert.Equal(t, errEmptyPrefix, q.validate())
+	})
+
+	t.Run("checks for nil pool", func(t *testing.T) {
+		q := &Queue{Prefix: "foo"}
+		assert.Equal(t, errNilPool, q.validate())
+	})
+}
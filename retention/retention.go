@@ -0,0 +1,145 @@
+//Package retention discards old items and deletes queues that are no longer used
+package retention
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/WillAbides/xqsmee/auth"
+	"github.com/WillAbides/xqsmee/metrics"
+	"github.com/WillAbides/xqsmee/policy"
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+)
+
+//DefaultInterval is how often a Sweeper runs when Interval is zero
+const DefaultInterval = time.Minute
+
+var (
+	expiredItems = metrics.NewCounterVec("xqsmee_expired_items_total",
+		"items discarded for being older than their queue's max age", "queue")
+	expiredQueues = metrics.NewCounterVec("xqsmee_expired_queues_total", "queues deleted for going unused")
+)
+
+//Backend is a queue that a Sweeper can clean up
+type Backend interface {
+	queue.Administrator
+	queue.Expirer
+}
+
+//Sweeper discards items that are older than their queue's max age and deletes idle queues
+type Sweeper struct {
+	// MaxAge is how long items are kept in queues whose policy doesn't set a max age. Zero keeps them forever.
+	MaxAge time.Duration
+	// IdleExpiry is how long a queue can go without pushes, pops, acks or nacks before it is deleted. Zero keeps
+	// queues forever.
+	IdleExpiry time.Duration
+	// Policies can set the max age for individual queues
+	Policies policy.Store
+	// Interval is how often Run sweeps. Defaults to DefaultInterval.
+	Interval time.Duration
+
+	backend Backend
+}
+
+//New returns a Sweeper for backend
+func New(backend Backend) *Sweeper {
+	return &Sweeper{backend: backend}
+}
+
+//Run sweeps every Interval until ctx is done
+func (s *Sweeper) Run(ctx context.Context) {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := s.Sweep(ctx, time.Now())
+			if err != nil && ctx.Err() == nil {
+				log.Println("failed sweeping queues: ", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+//Sweep deletes the queues that have been idle since before now-IdleExpiry and discards expired items from the
+//rest. It goes on to the other queues when one fails and returns the first error.
+func (s *Sweeper) Sweep(ctx context.Context, now time.Time) error {
+	queueNames, err := s.backend.ListQueues(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed listing queues")
+	}
+	var firstErr error
+	for _, queueName := range queueNames {
+		err = s.sweep(ctx, queueName, now)
+		if err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "failed sweeping %s", queueName)
+		}
+	}
+	return firstErr
+}
+
+func (s *Sweeper) sweep(ctx context.Context, queueName string, now time.Time) error {
+	if s.IdleExpiry > 0 {
+		idle, err := s.idle(ctx, queueName, now.Add(-s.IdleExpiry))
+		if err != nil {
+			return err
+		}
+		if idle {
+			err = s.backend.Delete(ctx, queueName)
+			if err != nil {
+				return err
+			}
+			expiredQueues.WithLabelValues().Inc()
+			return nil
+		}
+	}
+	maxAge := s.maxAge(queueName)
+	if maxAge <= 0 {
+		return nil
+	}
+	count, err := s.backend.Expire(ctx, queueName, now.Add(-maxAge))
+	if count > 0 {
+		expiredItems.WithLabelValues(metrics.QueueLabel(queueName)).Add(float64(count))
+	}
+	return err
+}
+
+// idle reports whether a queue was last used before cutoff. Queues that were last used before activity was recorded
+// go by their newest item.
+func (s *Sweeper) idle(ctx context.Context, queueName string, cutoff time.Time) (bool, error) {
+	stats, err := s.backend.Stats(ctx, queueName)
+	if err != nil {
+		return false, err
+	}
+	lastUsed := stats.GetLastActivity()
+	if lastUsed == nil {
+		lastUsed = stats.GetNewestReceivedAt()
+	}
+	if lastUsed == nil {
+		return false, nil
+	}
+	t, err := ptypes.Timestamp(lastUsed)
+	if err != nil {
+		return false, err
+	}
+	return t.Before(cutoff), nil
+}
+
+// maxAge is the max age for a queue, from its policy or the default
+func (s *Sweeper) maxAge(queueName string) time.Duration {
+	if s.Policies != nil {
+		if maxAge := s.Policies.Policy(auth.QueueID(queueName)).GetMaxAge(); maxAge > 0 {
+			return maxAge
+		}
+	}
+	return s.MaxAge
+}
@@ -0,0 +1,79 @@
+package retention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/WillAbides/xqsmee/metrics"
+	"github.com/WillAbides/xqsmee/policy"
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/WillAbides/xqsmee/queue/memqueue"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pushAt(t *testing.T, q queue.Queue, queueName string, receivedAt time.Time) {
+	t.Helper()
+	ts, err := ptypes.TimestampProto(receivedAt)
+	require.Nil(t, err)
+	require.Nil(t, q.Push(context.Background(), queueName, []*queue.WebRequest{{ReceivedAt: ts}}))
+}
+
+func depth(t *testing.T, q *memqueue.Queue, queueName string) int64 {
+	t.Helper()
+	stats, err := q.Stats(context.Background(), queueName)
+	require.Nil(t, err)
+	return stats.GetDepth()
+}
+
+func TestSweeper_Sweep(t *testing.T) {
+	now := time.Now()
+
+	t.Run("expires items by policy or default", func(t *testing.T) {
+		q := memqueue.New()
+		for _, queueName := range []string{"short", "short/sub", "long", "default"} {
+			pushAt(t, q, queueName, now.Add(-2*time.Hour))
+			pushAt(t, q, queueName, now.Add(-30*time.Minute))
+		}
+		sweeper := New(q)
+		sweeper.MaxAge = 90 * time.Minute
+		sweeper.Policies = policy.Static{
+			"short": {MaxAge: policy.Duration(time.Hour / 4)},
+			"long":  {MaxAge: policy.Duration(3 * time.Hour)},
+		}
+		before := metrics.CounterValue(expiredItems, "short")
+		require.Nil(t, sweeper.Sweep(context.Background(), now))
+		assert.Equal(t, int64(0), depth(t, q, "short"))
+		assert.Equal(t, int64(0), depth(t, q, "short/sub"))
+		assert.Equal(t, int64(2), depth(t, q, "long"))
+		assert.Equal(t, int64(1), depth(t, q, "default"))
+		assert.Equal(t, before+4, metrics.CounterValue(expiredItems, "short"), "sub-queues count toward their queue")
+	})
+
+	t.Run("keeps items without a max age", func(t *testing.T) {
+		q := memqueue.New()
+		pushAt(t, q, "bar", now.Add(-24*time.Hour))
+		require.Nil(t, New(q).Sweep(context.Background(), now))
+		assert.Equal(t, int64(1), depth(t, q, "bar"))
+	})
+
+	t.Run("deletes idle queues", func(t *testing.T) {
+		q := memqueue.New()
+		pushAt(t, q, "bar", now)
+		sweeper := New(q)
+		sweeper.IdleExpiry = time.Hour
+		before := metrics.CounterValue(expiredQueues)
+		require.Nil(t, sweeper.Sweep(context.Background(), now.Add(30*time.Minute)))
+		queueNames, err := q.ListQueues(context.Background())
+		require.Nil(t, err)
+		assert.Equal(t, []string{"bar"}, queueNames)
+
+		require.Nil(t, sweeper.Sweep(context.Background(), now.Add(2*time.Hour)))
+		queueNames, err = q.ListQueues(context.Background())
+		require.Nil(t, err)
+		assert.Empty(t, queueNames)
+		assert.Equal(t, before+1, metrics.CounterValue(expiredQueues))
+	})
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeKeyPair writes a new self-signed certificate for commonName and returns its der bytes
+func writeKeyPair(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	require.Nil(t, ioutil.WriteFile(certFile, certPEM, 0600))
+	require.Nil(t, ioutil.WriteFile(keyFile, keyPEM, 0600))
+	require.Nil(t, os.Chtimes(certFile, modTime, modTime))
+	require.Nil(t, os.Chtimes(keyFile, modTime, modTime))
+	return der
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir) //nolint: errcheck
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Minute)
+
+	first := writeKeyPair(t, certFile, keyFile, "first", start)
+	reloader, err := newCertReloader(certFile, keyFile)
+	require.Nil(t, err)
+	cert, err := reloader.GetCertificate(nil)
+	require.Nil(t, err)
+	assert.Equal(t, first, cert.Certificate[0])
+	assert.False(t, reloader.changed())
+
+	second := writeKeyPair(t, certFile, keyFile, "second", start.Add(time.Second))
+	assert.True(t, reloader.changed())
+	require.Nil(t, reloader.reload())
+	cert, err = reloader.GetCertificate(nil)
+	require.Nil(t, err)
+	assert.Equal(t, second, cert.Certificate[0])
+	assert.False(t, reloader.changed())
+
+	t.Run("keeps the old certificate when loading fails", func(t *testing.T) {
+		require.Nil(t, ioutil.WriteFile(keyFile, []byte("garbage"), 0600))
+		assert.NotNil(t, reloader.reload())
+		cert, err := reloader.GetCertificate(nil)
+		require.Nil(t, err)
+		assert.Equal(t, second, cert.Certificate[0])
+	})
+
+	t.Run("fails on missing files", func(t *testing.T) {
+		_, err := newCertReloader(filepath.Join(dir, "nope.pem"), keyFile)
+		assert.NotNil(t, err)
+	})
+}
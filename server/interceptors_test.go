@@ -0,0 +1,29 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+func TestChainUnary(t *testing.T) {
+	var calls []string
+	interceptor := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+			handler grpc.UnaryHandler) (interface{}, error) {
+			calls = append(calls, name)
+			return handler(ctx, req)
+		}
+	}
+	chain := chainUnary(interceptor("outer"), interceptor("inner"))
+	got, err := chain(context.Background(), "req", &grpc.UnaryServerInfo{}, func(ctx context.Context,
+		req interface{}) (interface{}, error) {
+		calls = append(calls, "handler")
+		return req, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "req", got)
+	assert.Equal(t, []string{"outer", "inner", "handler"}, calls)
+}
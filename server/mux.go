@@ -0,0 +1,182 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+)
+
+// grpcOrHTTP sends grpc requests to grpcServer and everything else to handler
+func grpcOrHTTP(grpcServer *grpc.Server, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcServer.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// h2cListener serves connections that start with the http/2 client preface as cleartext http/2, which is how grpc
+// clients connect without tls. Every other connection is returned from Accept.
+type h2cListener struct {
+	net.Listener
+	server *http.Server
+	h2     *http2.Server
+	conns  chan net.Conn
+	errs   chan error
+
+	closeOnce sync.Once
+	done      chan struct{}
+	// active counts the connections being served as http/2
+	active sync.WaitGroup
+}
+
+func newH2CListener(listener net.Listener, server *http.Server) (*h2cListener, error) {
+	l := &h2cListener{
+		Listener: listener,
+		server:   server,
+		h2:       &http2.Server{},
+		conns:    make(chan net.Conn),
+		errs:     make(chan error, 1),
+		done:     make(chan struct{}),
+	}
+	// lets server.Shutdown tell http/2 clients to go away
+	err := http2.ConfigureServer(server, l.h2)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed configuring http/2")
+	}
+	go l.acceptLoop()
+	return l, nil
+}
+
+func (l *h2cListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			l.errs <- err
+			return
+		}
+		l.active.Add(1)
+		go l.sniff(conn)
+	}
+}
+
+// sniff reads just enough of conn to tell whether it starts with the http/2 preface
+func (l *h2cListener) sniff(conn net.Conn) {
+	defer l.active.Done()
+	reader := bufio.NewReader(conn)
+	h2, err := l.peekPreface(conn, reader)
+	if err != nil {
+		_ = conn.Close() //nolint: gas
+		return
+	}
+	conn = &bufferedConn{Conn: conn, reader: reader}
+	if !h2 {
+		select {
+		case l.conns <- conn:
+		case <-l.done:
+			closeOrLog(conn)
+		}
+		return
+	}
+	l.h2.ServeConn(conn, &http2.ServeConnOpts{BaseConfig: l.server})
+}
+
+// peekPreface reports whether conn starts with the http/2 preface. The server's ReadHeaderTimeout doesn't apply until
+// it gets the connection, so peekPreface gives up on connections that are that slow to send the first bytes.
+func (l *h2cListener) peekPreface(conn net.Conn, reader *bufio.Reader) (bool, error) {
+	if l.server.ReadHeaderTimeout > 0 {
+		err := conn.SetReadDeadline(time.Now().Add(l.server.ReadHeaderTimeout))
+		if err != nil {
+			return false, err
+		}
+	}
+	// connections still being sniffed when the listener closes would keep wait waiting
+	sniffed := make(chan struct{})
+	defer close(sniffed)
+	go func() {
+		select {
+		case <-l.done:
+			_ = conn.Close() //nolint: gas
+		case <-sniffed:
+		}
+	}()
+	preface := []byte(http2.ClientPreface)
+	h2 := true
+	for n := 1; n <= len(preface); n++ {
+		peeked, err := reader.Peek(n)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.HasPrefix(preface, peeked) {
+			h2 = false
+			break
+		}
+	}
+	return h2, conn.SetReadDeadline(time.Time{})
+}
+
+// wait waits for every connection to be handed out from Accept or finish being served as http/2
+func (l *h2cListener) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		l.active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//Accept returns the next connection that isn't cleartext http/2
+func (l *h2cListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	}
+}
+
+//Close closes the listener
+func (l *h2cListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+	return l.Listener.Close()
+}
+
+// bufferedConn is a net.Conn that reads what was already buffered while sniffing first
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func closeOrLog(cl io.Closer) {
+	err := cl.Close()
+	if err != nil {
+		log.Println("failed to close: ", err)
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+func TestH2CListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto)) //nolint: errcheck
+		}),
+	}
+	h2cListener, err := newH2CListener(listener, server)
+	require.Nil(t, err)
+	go server.Serve(h2cListener) //nolint: errcheck
+	defer closeOrLog(server)
+	url := "http://" + listener.Addr().String() + "/"
+
+	get := func(t *testing.T, client *http.Client) string {
+		t.Helper()
+		resp, err := client.Get(url)
+		require.Nil(t, err)
+		defer closeOrLog(resp.Body)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.Nil(t, err)
+		return string(body)
+	}
+
+	t.Run("http/1.1", func(t *testing.T) {
+		assert.Equal(t, "HTTP/1.1", get(t, &http.Client{}))
+	})
+
+	t.Run("cleartext http/2", func(t *testing.T) {
+		client := &http.Client{Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		}}
+		assert.Equal(t, "HTTP/2.0", get(t, client))
+	})
+}
+
+func TestH2CListener_slowClients(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	server := &http.Server{
+		Handler:           http.NotFoundHandler(),
+		ReadHeaderTimeout: 50 * time.Millisecond,
+	}
+	h2cListener, err := newH2CListener(listener, server)
+	require.Nil(t, err)
+	go server.Serve(h2cListener) //nolint: errcheck
+	defer closeOrLog(server)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.Nil(t, err)
+	defer closeOrLog(conn)
+	_, err = conn.Write([]byte("PRI"))
+	require.Nil(t, err)
+	require.Nil(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestH2CListener_wait(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	h2cListener, err := newH2CListener(listener, &http.Server{})
+	require.Nil(t, err)
+
+	// an idle connection is never handed out from Accept
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.Nil(t, err)
+	defer closeOrLog(conn)
+	time.Sleep(10 * time.Millisecond)
+
+	require.Nil(t, h2cListener.Close())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, h2cListener.wait(ctx))
+}
@@ -1,66 +1,342 @@
 package server
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"log"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/WillAbides/idcheck"
+	"github.com/WillAbides/xqsmee/auth"
+	"github.com/WillAbides/xqsmee/health"
+	"github.com/WillAbides/xqsmee/metrics"
+	"github.com/WillAbides/xqsmee/policy"
 	"github.com/WillAbides/xqsmee/queue"
+	"github.com/WillAbides/xqsmee/retention"
 	"github.com/WillAbides/xqsmee/services/hooks"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
+//DefaultShutdownTimeout is how long a server waits for requests in flight when it is stopped
+const DefaultShutdownTimeout = 30 * time.Second
+
+//DefaultReadHeaderTimeout is how long the http server waits for a request's headers
+const DefaultReadHeaderTimeout = 10 * time.Second
+
+//DefaultReadTimeout is how long the http server waits for a whole request when grpc has a listener of its own
+const DefaultReadTimeout = time.Minute
+
 //Config is a server configuration
 type Config struct {
-	Queue           queue.Queue
-	Httpaddr        string
-	Grpcaddr        string
-	PublicURL       string
-	idcheckSalt     string
-	TLSCertPEMBlock []byte
-	TLSKeyPEMBlock  []byte
-	UseTLS          bool
+	Queue    queue.Queue
+	Httpaddr string
+	// Grpcaddr is where grpc is served. When it is empty or the same as Httpaddr, grpc shares the http listener.
+	Grpcaddr  string
+	PublicURL string
+	// TLSCertFile and TLSKeyFile are loaded again when they change or the server gets a SIGHUP
+	TLSCertFile string
+	TLSKeyFile  string
+	UseTLS      bool
+	// ClientCAPEMBlock holds the CAs for client certificates. When it is set, grpc clients must present a certificate
+	// signed by one of them, and its subject common name has to be in the clients of a queue's policy. It needs TLS
+	// and a Grpcaddr of its own.
+	ClientCAPEMBlock []byte
+	LeaseDuration    time.Duration
+	Policies         policy.Store
+	// TokenSecret signs consumer tokens. When it is empty, the grpc service doesn't check tokens.
+	TokenSecret string
+	// AdminToken is the token for the Admin grpc service. When it is empty, admin rpcs are refused.
+	AdminToken string
+	// IDCheckSalt salts the checksum in queue ids when IDSecret is empty
+	IDCheckSalt string
+	// IDSecret signs new queue ids
+	IDSecret string
+	// PreviousIDSecrets are old values of IDSecret that are still accepted
+	PreviousIDSecrets []string
+	// AcceptLegacyIDs keeps accepting checksum ids from before IDSecret was set
+	AcceptLegacyIDs bool
+	// ServeMetrics serves prometheus metrics at /metrics on the http listener. Metrics are labeled with queue ids, so
+	// only serve them where the public can't see them.
+	ServeMetrics bool
+	// MetricsAddr serves /metrics on a plain http listener of its own instead
+	MetricsAddr string
+	// ShutdownTimeout is how long to wait for requests in flight after SIGTERM. It defaults to DefaultShutdownTimeout.
+	ShutdownTimeout time.Duration
+	// MaxAge is how long items are kept in queues whose policy doesn't set a max age. Zero keeps them forever.
+	MaxAge time.Duration
+	// IdleExpiry deletes queues that go this long without being used. Zero keeps them forever.
+	IdleExpiry time.Duration
+	// Limits cap the waiting items in queues whose policy doesn't set its own
+	Limits queue.Limits
+	// MaxBodySize is the largest webhook body in bytes for queues whose policy doesn't set one. It defaults to
+	// hooks.DefaultMaxBodySize.
+	MaxBodySize int64
+	// ReadHeaderTimeout is how long to wait for a request's headers. It defaults to DefaultReadHeaderTimeout.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout is how long to wait for a whole request. It defaults to DefaultReadTimeout. It only applies when grpc
+	// has a listener of its own, because grpc streams on a shared listener are requests that last as long as they're
+	// open.
+	ReadTimeout time.Duration
+}
+
+// sharedListener reports whether http and grpc are served together on Httpaddr
+func (config *Config) sharedListener() bool {
+	return config.Grpcaddr == "" || config.Grpcaddr == config.Httpaddr
+}
+
+func (config *Config) clientCAs() (*x509.CertPool, error) {
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(config.ClientCAPEMBlock) {
+		return nil, errors.New("no certificates found in client ca bundle")
+	}
+	return clientCAs, nil
 }
 
-func (config *Config) buildListeners() (httpListener, grpcListener net.Listener, err error) {
+// buildListeners starts the listeners. They use tls when certs isn't nil. grpcListener is nil when grpc shares the
+// http listener. TLS for a separate grpc listener is returned as grpc credentials instead of wrapping the listener, so
+// grpc can see client certificates.
+func (config *Config) buildListeners(certs *certReloader) (httpListener, grpcListener net.Listener,
+	grpcCreds credentials.TransportCredentials, err error) {
 	httpListener, err = net.Listen("tcp", config.Httpaddr)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "failed starting http listener")
+		return nil, nil, nil, errors.Wrap(err, "failed starting http listener")
 	}
 
-	grpcListener, err = net.Listen("tcp", config.Grpcaddr)
-	if err != nil {
-		return nil, nil, errors.Wrap(err, "failed starting grpc listener")
+	if !config.sharedListener() {
+		grpcListener, err = net.Listen("tcp", config.Grpcaddr)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed starting grpc listener")
+		}
 	}
 
-	if config.UseTLS {
-		var cert tls.Certificate
-		cert, err = tls.X509KeyPair(config.TLSCertPEMBlock, config.TLSKeyPEMBlock)
+	if certs == nil {
+		return httpListener, grpcListener, nil, nil
+	}
+	tlsConfig := &tls.Config{GetCertificate: certs.GetCertificate}
+	if grpcListener == nil {
+		tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+		return tls.NewListener(httpListener, tlsConfig), nil, nil, nil
+	}
+	httpListener = tls.NewListener(httpListener, tlsConfig)
+	grpcTLSConfig := tlsConfig.Clone()
+	if config.ClientCAPEMBlock != nil {
+		grpcTLSConfig.ClientCAs, err = config.clientCAs()
 		if err != nil {
-			return nil, nil, errors.Wrap(err, "failed creating tls certificate from key pair")
+			return nil, nil, nil, err
 		}
-		tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
-		grpcListener = tls.NewListener(grpcListener, tlsConfig)
-		httpListener = tls.NewListener(httpListener, tlsConfig)
+		grpcTLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return httpListener, grpcListener, credentials.NewTLS(grpcTLSConfig), nil
+}
+
+// validateClientCA checks that client certificates can be required and that some certificate could be allowed to
+// consume a queue. They can't be required on a listener shared with webhook senders, who don't have them.
+func (config *Config) validateClientCA() error {
+	if config.ClientCAPEMBlock == nil {
+		return nil
+	}
+	if !config.UseTLS {
+		return errors.New("a client ca needs tls")
 	}
-	return httpListener, grpcListener, err
+	if config.sharedListener() {
+		return errors.New("a client ca needs a grpc address of its own, because webhook senders on the http " +
+			"address don't have client certificates")
+	}
+	_, err := config.clientCAs()
+	if err != nil {
+		return err
+	}
+	static, ok := config.Policies.(policy.Static)
+	if config.Policies == nil || ok && !static.Any(func(p *policy.Policy) bool { return len(p.Clients) > 0 }) {
+		return errors.New("a client ca is set, but no queue policy has clients, so no certificate can consume a queue")
+	}
+	return nil
+}
+
+// sweeper returns a sweeper for the queue's retention settings, or nil when nothing expires
+func (config *Config) sweeper() (*retention.Sweeper, error) {
+	if config.MaxAge <= 0 && config.IdleExpiry <= 0 && config.Policies == nil {
+		return nil, nil
+	}
+	backend, ok := config.Queue.(retention.Backend)
+	if !ok {
+		if config.MaxAge > 0 || config.IdleExpiry > 0 {
+			return nil, errors.New("this backend can't expire items or queues")
+		}
+		if config.anyPolicy(func(p *policy.Policy) bool { return p.GetMaxAge() > 0 }) {
+			return nil, errors.New("a queue policy sets maxAge, but this backend can't expire items")
+		}
+		return nil, nil
+	}
+	sweeper := retention.New(backend)
+	sweeper.MaxAge = config.MaxAge
+	sweeper.IdleExpiry = config.IdleExpiry
+	sweeper.Policies = config.Policies
+	return sweeper, nil
+}
+
+// anyPolicy reports whether fn is true for any of the configured policies. Only static policies can be checked.
+func (config *Config) anyPolicy(fn func(*policy.Policy) bool) bool {
+	static, ok := config.Policies.(policy.Static)
+	return ok && static.Any(fn)
+}
+
+func (config *Config) idChecker() hooks.IDChecker {
+	checksumChecker := idcheck.NewIDChecker(idcheck.Salt(config.IDCheckSalt))
+	if config.IDSecret == "" {
+		log.Println("no id secret is set, so anyone can make up a valid queue id")
+		return hooks.ChecksumIDChecker{IDChecker: checksumChecker}
+	}
+	idChecker := auth.NewIDChecker(config.IDSecret, config.PreviousIDSecrets...)
+	if config.AcceptLegacyIDs {
+		idChecker.Legacy = checksumChecker
+	}
+	return idChecker
+}
+
+// validateLimits checks that the default limits make sense and that the backend can enforce them and the limits in
+// queue policies
+func (config *Config) validateLimits() error {
+	if config.Limits.MaxItems < 0 || config.Limits.MaxBytes < 0 {
+		return errors.New("max items and max bytes can't be negative")
+	}
+	if !config.Limits.Overflow.Valid() {
+		return errors.Errorf("unknown overflow %q", config.Limits.Overflow)
+	}
+	if _, ok := config.Queue.(queue.Limiter); ok {
+		return nil
+	}
+	if config.Limits.Limited() {
+		return queue.ErrNotLimiter
+	}
+	if config.anyPolicy(func(p *policy.Policy) bool { return p.Limits(queue.Limits{}).Limited() }) {
+		return errors.New("a queue policy sets maxItems or maxBytes, but this backend can't limit queues")
+	}
+	return nil
 }
 
 //Run runs a server
 func Run(config *Config) error {
-	httpListener, grpcListener, err := config.buildListeners()
+	err := config.validateLimits()
+	if err != nil {
+		return err
+	}
+	err = config.validateClientCA()
+	if err != nil {
+		return err
+	}
+	sweeper, err := config.sweeper()
+	if err != nil {
+		return err
+	}
+	if sweeper != nil {
+		ctx, stopSweeping := context.WithCancel(context.Background())
+		defer stopSweeping()
+		go sweeper.Run(ctx)
+	}
+	var certs *certReloader
+	if config.UseTLS {
+		certs, err = newCertReloader(config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			return err
+		}
+		done := make(chan struct{})
+		defer close(done)
+		go certs.watch(done)
+	}
+	httpListener, grpcListener, grpcCreds, err := config.buildListeners(certs)
 	if err != nil {
 		return errors.Wrap(err, "failed building listeners")
 	}
-	errs := make(chan error)
+	errs := make(chan error, 3)
 
-	idChecker := idcheck.NewIDChecker(idcheck.Salt(config.idcheckSalt))
+	idChecker := config.idChecker()
 
+	hooksService := hooks.New(config.Queue, idChecker, config.PublicURL)
+	hooksService.Policies = config.Policies
+	hooksService.Limits = config.Limits
+	hooksService.MaxBodySize = config.MaxBodySize
+	var grpcOpts []grpc.ServerOption
+	if grpcCreds != nil {
+		grpcOpts = append(grpcOpts, grpc.Creds(grpcCreds))
+	}
+	var authorizers []auth.Authorizer
+	if config.TokenSecret != "" {
+		tokens := auth.NewTokens(config.TokenSecret)
+		hooksService.Tokens = tokens
+		authorizers = append(authorizers, tokens)
+	}
+	if certs != nil && config.ClientCAPEMBlock != nil {
+		authorizers = append(authorizers, &auth.ClientCerts{Policies: config.Policies})
+	}
+	unaryInterceptors := []grpc.UnaryServerInterceptor{
+		metrics.UnaryServerInterceptor(),
+		auth.AdminUnaryServerInterceptor(config.AdminToken),
+	}
+	streamInterceptors := []grpc.StreamServerInterceptor{metrics.StreamServerInterceptor()}
+	if len(authorizers) > 0 {
+		unaryInterceptors = append(unaryInterceptors, auth.UnaryServerInterceptor(authorizers...))
+		streamInterceptors = append(streamInterceptors, auth.StreamServerInterceptor(authorizers...))
+	} else {
+		log.Println("no token secret or client ca is set, so anyone can consume any queue over grpc")
+	}
+	grpcOpts = append(grpcOpts,
+		grpc.UnaryInterceptor(chainUnary(unaryInterceptors...)),
+		grpc.StreamInterceptor(chainStream(streamInterceptors...)),
+	)
+	grpcServer := grpc.NewServer(grpcOpts...)
+	grpcHandler := queue.NewGRPCHandler(config.Queue)
+	if config.LeaseDuration > 0 {
+		grpcHandler.LeaseDuration = config.LeaseDuration
+	}
+	queue.RegisterQueueServer(grpcServer, grpcHandler)
+	if _, ok := config.Queue.(queue.Administrator); !ok && config.AdminToken != "" {
+		log.Println("an admin token is set, but this backend doesn't support admin rpcs")
+	}
+	queue.RegisterAdminServer(grpcServer, queue.NewAdminHandler(config.Queue))
+	healthServer := health.NewServer(config.Queue)
+	health.RegisterHealthServer(grpcServer, healthServer)
+	defer grpcServer.Stop()
+
+	router := hooksService.Router()
+	if config.ServeMetrics && config.MetricsAddr == "" {
+		router.Handle("/metrics", metrics.Handler())
+	}
 	httpServer := &http.Server{
-		Handler: hooks.New(config.Queue, idChecker, config.PublicURL).Router(),
+		Handler:           router,
+		ReadHeaderTimeout: durationOr(config.ReadHeaderTimeout, DefaultReadHeaderTimeout),
+	}
+	if !config.sharedListener() {
+		httpServer.ReadTimeout = durationOr(config.ReadTimeout, DefaultReadTimeout)
+	}
+	servers := &servers{
+		http:         httpServer,
+		grpc:         grpcServer,
+		grpcHandler:  grpcHandler,
+		health:       healthServer,
+		separateGRPC: grpcListener != nil,
+	}
+	if grpcListener == nil {
+		httpServer.Handler = grpcOrHTTP(grpcServer, httpServer.Handler)
+		if certs == nil {
+			servers.h2c, err = newH2CListener(httpListener, httpServer)
+			if err != nil {
+				return err
+			}
+			httpListener = servers.h2c
+		}
+	} else {
+		go func() {
+			errs <- grpcServer.Serve(grpcListener)
+		}()
 	}
 
 	go func() {
@@ -73,14 +349,91 @@ func Run(config *Config) error {
 		}
 	}()
 
-	grpcServer := grpc.NewServer()
-	grpcHandler := queue.NewGRPCHandler(config.Queue)
-	queue.RegisterQueueServer(grpcServer, grpcHandler)
+	if config.MetricsAddr != "" {
+		metricsServer, err := serveMetrics(config.MetricsAddr, errs)
+		if err != nil {
+			return err
+		}
+		defer closeOrLog(metricsServer)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-signals:
+		log.Printf("got %v, shutting down", sig)
+	}
+	return servers.shutdown(durationOr(config.ShutdownTimeout, DefaultShutdownTimeout))
+}
 
+// durationOr returns d, or def when d isn't positive
+func durationOr(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
+
+// serveMetrics serves /metrics on its own unencrypted listener, for scrapers on an internal network
+func serveMetrics(addr string, errs chan<- error) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed starting metrics listener")
+	}
+	router := http.NewServeMux()
+	router.Handle("/metrics", metrics.Handler())
+	metricsServer := &http.Server{
+		Handler:           router,
+		ReadHeaderTimeout: DefaultReadHeaderTimeout,
+		ReadTimeout:       DefaultReadTimeout,
+	}
 	go func() {
-		errs <- grpcServer.Serve(grpcListener)
+		errs <- metricsServer.Serve(listener)
 	}()
-	defer grpcServer.Stop()
+	return metricsServer, nil
+}
+
+// servers are the running parts of a server
+type servers struct {
+	http        *http.Server
+	grpc        *grpc.Server
+	grpcHandler *queue.GRPCHandler
+	health      *health.Server
+	// separateGRPC is set when grpc has a listener of its own instead of being served by http
+	separateGRPC bool
+	h2c          *h2cListener
+}
 
-	return <-errs
+// shutdown stops taking webhooks and consumers, then waits up to timeout for the requests that are in flight
+func (s *servers) shutdown(timeout time.Duration) error {
+	s.health.Shutdown()
+	// waiting pops and subscriptions would never finish on their own
+	s.grpcHandler.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	grpcStopped := make(chan struct{})
+	go func() {
+		defer close(grpcStopped)
+		if s.separateGRPC {
+			s.grpc.GracefulStop()
+		}
+	}()
+	err := s.http.Shutdown(ctx)
+	if err == nil && s.h2c != nil {
+		err = s.h2c.wait(ctx)
+	}
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		s.grpc.Stop()
+		<-grpcStopped
+		err = ctx.Err()
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed shutting down gracefully")
+	}
+	return nil
 }
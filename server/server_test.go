@@ -0,0 +1,128 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WillAbides/xqsmee/policy"
+	"github.com/WillAbides/xqsmee/queue"
+	"github.com/WillAbides/xqsmee/queue/memqueue"
+	"github.com/WillAbides/xqsmee/queue/mockqueue"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_sweeper(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	maxAge := policy.Static{"abc": {MaxAge: policy.Duration(time.Hour)}}
+
+	t.Run("sweeps backends that can expire", func(t *testing.T) {
+		sweeper, err := (&Config{Queue: memqueue.New(), Policies: maxAge}).sweeper()
+		require.Nil(t, err)
+		assert.NotNil(t, sweeper)
+	})
+
+	t.Run("needs a backend that can expire for policy max ages", func(t *testing.T) {
+		_, err := (&Config{Queue: mockqueue.NewMockQueue(ctrl), Policies: maxAge}).sweeper()
+		assert.NotNil(t, err)
+	})
+
+	t.Run("needs a backend that can expire for the default max age", func(t *testing.T) {
+		_, err := (&Config{Queue: mockqueue.NewMockQueue(ctrl), MaxAge: time.Hour}).sweeper()
+		assert.NotNil(t, err)
+	})
+
+	t.Run("other policies don't need a sweeper", func(t *testing.T) {
+		sweeper, err := (&Config{Queue: mockqueue.NewMockQueue(ctrl), Policies: policy.Static{"abc": {}}}).sweeper()
+		require.Nil(t, err)
+		assert.Nil(t, sweeper)
+	})
+}
+
+func TestConfig_validateLimits(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	maxItems := policy.Static{"abc": {MaxItems: 10}}
+
+	t.Run("backends that can limit take any limits", func(t *testing.T) {
+		config := &Config{Queue: memqueue.New(), Policies: maxItems, Limits: queue.Limits{MaxBytes: 100}}
+		assert.Nil(t, config.validateLimits())
+	})
+
+	t.Run("needs a backend that can limit for the default limits", func(t *testing.T) {
+		config := &Config{Queue: mockqueue.NewMockQueue(ctrl), Limits: queue.Limits{MaxBytes: 100}}
+		assert.Equal(t, queue.ErrNotLimiter, config.validateLimits())
+	})
+
+	t.Run("needs a backend that can limit for policy limits", func(t *testing.T) {
+		config := &Config{Queue: mockqueue.NewMockQueue(ctrl), Policies: maxItems}
+		assert.NotNil(t, config.validateLimits())
+	})
+
+	t.Run("an overflow alone doesn't limit anything", func(t *testing.T) {
+		config := &Config{Queue: mockqueue.NewMockQueue(ctrl),
+			Policies: policy.Static{"abc": {Overflow: queue.OverflowDropNewest}}}
+		assert.Nil(t, config.validateLimits())
+	})
+}
+
+func TestConfig_validateClientCA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clientca")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir) //nolint: errcheck
+	certFile := filepath.Join(dir, "ca.crt")
+	writeKeyPair(t, certFile, filepath.Join(dir, "ca.key"), "ca", time.Now())
+	caPEM, err := ioutil.ReadFile(certFile)
+	require.Nil(t, err)
+	clients := policy.Static{"abc": {Clients: []string{"worker"}}}
+	newConfig := func() *Config {
+		return &Config{
+			Httpaddr:         ":8000",
+			Grpcaddr:         ":9000",
+			UseTLS:           true,
+			ClientCAPEMBlock: caPEM,
+			Policies:         clients,
+		}
+	}
+
+	t.Run("works", func(t *testing.T) {
+		assert.Nil(t, newConfig().validateClientCA())
+	})
+
+	t.Run("no client ca is fine", func(t *testing.T) {
+		assert.Nil(t, (&Config{}).validateClientCA())
+	})
+
+	t.Run("needs tls", func(t *testing.T) {
+		config := newConfig()
+		config.UseTLS = false
+		assert.NotNil(t, config.validateClientCA())
+	})
+
+	t.Run("needs a grpc address of its own", func(t *testing.T) {
+		config := newConfig()
+		config.Grpcaddr = ""
+		assert.NotNil(t, config.validateClientCA())
+		config.Grpcaddr = config.Httpaddr
+		assert.NotNil(t, config.validateClientCA())
+	})
+
+	t.Run("needs certificates", func(t *testing.T) {
+		config := newConfig()
+		config.ClientCAPEMBlock = []byte("nope")
+		assert.NotNil(t, config.validateClientCA())
+	})
+
+	t.Run("needs a policy with clients", func(t *testing.T) {
+		config := newConfig()
+		config.Policies = nil
+		assert.NotNil(t, config.validateClientCA())
+		config.Policies = policy.Static{"abc": {MaxItems: 10}}
+		assert.NotNil(t, config.validateClientCA())
+	})
+}
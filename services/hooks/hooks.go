@@ -1,18 +1,24 @@
 package hooks
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"html/template"
 	"io"
+	"log"
 	"net/http"
 	"net/textproto"
 	"strings"
 	"time"
 
 	"github.com/WillAbides/idcheck"
+	"github.com/WillAbides/xqsmee/metrics"
+	"github.com/WillAbides/xqsmee/policy"
 	"github.com/WillAbides/xqsmee/queue"
 	"github.com/gobuffalo/packr"
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 )
 
 const (
@@ -20,11 +26,22 @@ const (
 	jsonHeader = "application/json"
 )
 
+//DefaultMaxBodySize is the largest webhook body in bytes when neither the Service nor the queue's policy sets one
+const DefaultMaxBodySize = queue.DefaultMaxBodySize
+
 var (
 	static        = packr.NewBox("./static")
 	tpl           = packr.NewBox("./tpl")
 	queueTemplate *template.Template
 	indexTemplate *template.Template
+
+	pushes     = metrics.NewCounterVec("xqsmee_pushes_total", "webhooks added to a queue", "queue")
+	httpPeek   = metrics.NewCounterVec("xqsmee_http_peeks_total", "views of a queue over http", "queue")
+	drops      = metrics.NewCounterVec("xqsmee_dropped_items_total", "items dropped because their queue was full", "queue")
+	handshakes = metrics.NewCounterVec("xqsmee_handshakes_total", "verification requests answered for a queue", "queue")
+	oversized  = metrics.NewCounterVec("xqsmee_oversized_requests_total", "webhooks refused for their body size", "queue")
+	rejects    = metrics.NewCounterVec("xqsmee_rejected_pushes_total", "webhooks refused because their queue was full",
+		"queue", "limit")
 )
 
 func init() {
@@ -34,18 +51,47 @@ func init() {
 
 type (
 	queueTemplateData struct {
-		QueueURL string
-		Items    []string
+		QueueURL  string
+		Token     string
+		Limits    string
+		Items     []string
+		DeadItems []string
+	}
+
+	newQueueResponse struct {
+		ID    string `json:"id"`
+		URL   string `json:"url"`
+		Token string `json:"token"`
 	}
 
-	//IDChecker checks queue IDs
+	//TokenIssuer issues consumer tokens for new queues
+	TokenIssuer interface {
+		Token(queueID string) string
+	}
+
+	//IDChecker issues and checks queue IDs
 	IDChecker interface {
-		NewID() (*idcheck.ID, error)
-		ValidID(*idcheck.ID) bool
+		NewID() (string, error)
+		ValidID(string) bool
+	}
+
+	//ChecksumIDChecker is an IDChecker for idcheck's ids, which only have a checksum
+	ChecksumIDChecker struct {
+		idcheck.IDChecker
 	}
 
 	//Service is a hooks service
 	Service struct {
+		//Policies has the verification settings for queues. Queues without a policy accept every request.
+		Policies policy.Store
+		//Tokens issues a consumer token when a queue is created. Without it, /q/new just redirects to the new queue.
+		Tokens TokenIssuer
+		//Limits cap the waiting items in queues whose policy doesn't set its own
+		Limits queue.Limits
+		//MaxBodySize is the largest body in bytes for queues whose policy doesn't set one. Defaults to
+		//DefaultMaxBodySize.
+		MaxBodySize int64
+
 		publicURL          string
 		queue              queue.Queue
 		receivedAtOverride *time.Time
@@ -53,6 +99,21 @@ type (
 	}
 )
 
+//NewID returns a new id
+func (c ChecksumIDChecker) NewID() (string, error) {
+	id, err := c.IDChecker.NewID()
+	if err != nil {
+		return "", err
+	}
+	return id.Base64(), nil
+}
+
+//ValidID reports whether id is an idcheck id with a valid checksum
+func (c ChecksumIDChecker) ValidID(id string) bool {
+	parsed, err := idcheck.FromBase64(id)
+	return err == nil && c.IDChecker.ValidID(parsed)
+}
+
 //New returns a new hooks service
 func New(queue queue.Queue, idChecker IDChecker, publicURL string) *Service {
 	return &Service{
@@ -71,8 +132,7 @@ func (s *Service) receivedAt() time.Time {
 
 func (s *Service) idCheckMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		id, err := idcheck.FromBase64(mux.Vars(r)["key"])
-		if err != nil || !s.idChecker.ValidID(id) {
+		if !s.idChecker.ValidID(mux.Vars(r)["key"]) {
 			http.NotFound(w, r)
 			return
 		}
@@ -92,6 +152,7 @@ func (s *Service) Router() *mux.Router {
 		}
 	})
 	r.HandleFunc("/_ping", s.pingHandler)
+	r.HandleFunc("/_health", s.healthHandler)
 
 	r.HandleFunc("/q/new", s.newQueueHandler).Methods(http.MethodGet)
 
@@ -118,13 +179,117 @@ func (s *Service) pingHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// healthHandler responds with a 503 when the queue backend can't be reached
+func (s *Service) healthHandler(w http.ResponseWriter, r *http.Request) {
+	err := queue.CheckHealth(r.Context(), s.queue)
+	if err != nil {
+		log.Println("health check failed: ", err)
+		http.Error(w, "unhealthy", http.StatusServiceUnavailable)
+		return
+	}
+	_, err = io.WriteString(w, "ok")
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+}
+
 func (s *Service) newQueueHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := s.idChecker.NewID()
 	if err != nil {
 		http.Error(w, "failed to create new queue id", http.StatusInternalServerError)
 		return
 	}
-	http.Redirect(w, r, "/q/"+id.Base64(), http.StatusFound)
+	if s.Tokens == nil {
+		http.Redirect(w, r, "/q/"+id, http.StatusFound)
+		return
+	}
+
+	// the token is only shown here, so respond with the new queue instead of redirecting to it
+	queueURL := s.queueURL(id)
+	token := s.Tokens.Token(id)
+	w.Header().Set("Location", "/q/"+id)
+	if probablyWantsHTML(r) {
+		w.Header().Set("Content-Type", htmlHeader)
+		w.WriteHeader(http.StatusCreated)
+		err = queueTemplate.Execute(w, queueTemplateData{
+			QueueURL: queueURL,
+			Token:    token,
+			Limits:   describeLimits(s.limits(id)),
+		})
+		if err != nil {
+			log.Println("failed serving html: ", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", jsonHeader)
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(newQueueResponse{
+		ID:    id,
+		URL:   queueURL,
+		Token: token,
+	})
+	if err != nil {
+		log.Println("failed encoding json: ", err)
+	}
+}
+
+func (s *Service) queueURL(queueName string) string {
+	return strings.TrimRight(s.publicURL, "/") + "/q/" + queueName
+}
+
+func (s *Service) verification(queueID string) *policy.Verification {
+	if s.Policies == nil {
+		return nil
+	}
+	return s.Policies.Policy(queueID).GetVerification()
+}
+
+func (s *Service) response(queueID string) *policy.Response {
+	if s.Policies == nil {
+		return nil
+	}
+	return s.Policies.Policy(queueID).GetResponse()
+}
+
+func (s *Service) limits(queueID string) queue.Limits {
+	if s.Policies == nil {
+		return s.Limits
+	}
+	return s.Policies.Policy(queueID).Limits(s.Limits)
+}
+
+func (s *Service) maxBodySize(queueID string) int64 {
+	if s.Policies != nil {
+		if maxBodySize := s.Policies.Policy(queueID).GetMaxBodySize(); maxBodySize > 0 {
+			return maxBodySize
+		}
+	}
+	if s.MaxBodySize > 0 {
+		return s.MaxBodySize
+	}
+	return DefaultMaxBodySize
+}
+
+// describeLimits explains limits to the people using a queue
+func describeLimits(limits queue.Limits) string {
+	var caps []string
+	if limits.MaxItems > 0 {
+		caps = append(caps, fmt.Sprintf("%d requests", limits.MaxItems))
+	}
+	if limits.MaxBytes > 0 {
+		caps = append(caps, fmt.Sprintf("%d bytes", limits.MaxBytes))
+	}
+	if len(caps) == 0 {
+		return ""
+	}
+	full := "new requests are refused"
+	switch limits.Overflow {
+	case queue.OverflowDropOldest:
+		full = "the oldest requests are dropped to make room"
+	case queue.OverflowDropNewest:
+		full = "new requests are dropped"
+	}
+	return fmt.Sprintf("This queue holds up to %s. When it is full, %s.", strings.Join(caps, " and "), full)
 }
 
 func (s *Service) postHandler(w http.ResponseWriter, r *http.Request) {
@@ -135,17 +300,81 @@ func (s *Service) postHandler(w http.ResponseWriter, r *http.Request) {
 		key = key + "/" + subkey
 	}
 
-	webRequest, err := queue.NewWebRequestFromHTTPRequest(r, s.receivedAt())
+	webRequest, err := queue.NewWebRequestFromHTTPRequest(r, "/q/"+vars["key"], s.receivedAt(),
+		s.maxBodySize(vars["key"]))
+	if errors.Cause(err) == queue.ErrBodyTooLarge {
+		refuseOversized(w, key)
+		return
+	}
 	if err != nil || key == "" {
 		http.Error(w, "", http.StatusBadRequest)
 		return
 	}
 
-	err = s.queue.Push(r.Context(), key, []*queue.WebRequest{webRequest})
-	if err != nil {
+	response := s.response(vars["key"])
+	quarantined := false
+	verification := s.verification(vars["key"])
+	if verification != nil {
+		err = verification.Verify(r.Header, webRequest.GetBody(), s.receivedAt())
+		if err != nil && !verification.Quarantine {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			log.Printf("quarantining request to %s: %v", key, err)
+			key = policy.QuarantineQueue(key)
+			quarantined = true
+		}
+	}
+
+	// handshakes are only answered for requests that passed verification
+	if answer := response.Handshake(r, webRequest.GetBody()); answer != nil && !quarantined {
+		handshakes.WithLabelValues(metrics.QueueLabel(key)).Inc()
+		writeResponse(w, answer)
+		return
+	}
+
+	dropped, err := queue.PushLimited(r.Context(), s.queue, key, []*queue.WebRequest{webRequest},
+		s.limits(vars["key"]))
+	switch err {
+	case nil:
+	case queue.ErrMaxItems:
+		rejects.WithLabelValues(metrics.QueueLabel(key), "items").Inc()
+		http.Error(w, "queue is full", http.StatusTooManyRequests)
+		return
+	case queue.ErrMaxBytes:
+		rejects.WithLabelValues(metrics.QueueLabel(key), "bytes").Inc()
+		http.Error(w, "queue is out of space", http.StatusInsufficientStorage)
+		return
+	default:
 		http.Error(w, "failed adding to queue", http.StatusInternalServerError)
 		return
 	}
+	if dropped > 0 {
+		drops.WithLabelValues(metrics.QueueLabel(key)).Add(float64(dropped))
+	}
+	pushes.WithLabelValues(metrics.QueueLabel(key)).Inc()
+	writeResponse(w, response)
+}
+
+// writeResponse answers a webhook sender. Without a response the sender gets an empty 200.
+func writeResponse(w http.ResponseWriter, response *policy.Response) {
+	if response == nil {
+		return
+	}
+	for name, value := range response.Headers {
+		w.Header().Set(name, value)
+	}
+	w.WriteHeader(response.GetStatus())
+	_, err := io.WriteString(w, response.Body)
+	if err != nil {
+		log.Println("failed writing response: ", err)
+	}
+}
+
+func refuseOversized(w http.ResponseWriter, key string) {
+	oversized.WithLabelValues(metrics.QueueLabel(key)).Inc()
+	http.Error(w, "request body is too large", http.StatusRequestEntityTooLarge)
 }
 
 func probablyWantsHTML(r *http.Request) bool {
@@ -158,6 +387,24 @@ func probablyWantsHTML(r *http.Request) bool {
 	return false
 }
 
+func indentedJSONItems(webRequests []*queue.WebRequest) ([]string, error) {
+	var items []string
+	for _, item := range webRequests {
+		// json.MarshalIndent would html escape the body again
+		jb, err := item.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		err = json.Indent(&buf, jb, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, buf.String())
+	}
+	return items, nil
+}
+
 func (s *Service) peekHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	key := vars["key"]
@@ -166,7 +413,24 @@ func (s *Service) peekHandler(w http.ResponseWriter, r *http.Request) {
 		key = key + "/" + subkey
 	}
 
-	webRequests, err := s.queue.Peek(r.Context(), key, 0)
+	if answer := s.response(vars["key"]).Handshake(r, nil); answer != nil {
+		handshakes.WithLabelValues(metrics.QueueLabel(key)).Inc()
+		writeResponse(w, answer)
+		return
+	}
+
+	if _, ok := r.URL.Query()["quarantine"]; ok {
+		key = policy.QuarantineQueue(key)
+	}
+
+	httpPeek.WithLabelValues(metrics.QueueLabel(key)).Inc()
+	peek := s.queue.Peek
+	_, dead := r.URL.Query()["dead"]
+	if dead {
+		peek = s.queue.PeekDead
+	}
+
+	webRequests, err := peek(r.Context(), key, 0)
 	if err != nil {
 		http.Error(w, "failed querying queue", http.StatusInternalServerError)
 		return
@@ -178,19 +442,31 @@ func (s *Service) peekHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if probablyWantsHTML(r) {
-		var items []string
-		for _, item := range webRequests {
-			jb, err := json.MarshalIndent(item, "", "  ")
+		// the dead letters are already the items when ?dead is set
+		var deadRequests []*queue.WebRequest
+		if !dead {
+			deadRequests, err = s.queue.PeekDead(r.Context(), key, 0)
 			if err != nil {
-				http.Error(w, "failed encoding json", http.StatusInternalServerError)
+				http.Error(w, "failed querying queue", http.StatusInternalServerError)
 				return
 			}
-			items = append(items, string(jb))
+		}
+		items, err := indentedJSONItems(webRequests)
+		if err != nil {
+			http.Error(w, "failed encoding json", http.StatusInternalServerError)
+			return
+		}
+		deadItems, err := indentedJSONItems(deadRequests)
+		if err != nil {
+			http.Error(w, "failed encoding json", http.StatusInternalServerError)
+			return
 		}
 		w.Header().Set("Content-Type", htmlHeader)
-		err := queueTemplate.Execute(w, queueTemplateData{
-			QueueURL: strings.TrimRight(s.publicURL, "/") + "/q/" + key,
-			Items:    items,
+		err = queueTemplate.Execute(w, queueTemplateData{
+			QueueURL:  s.queueURL(key),
+			Limits:    describeLimits(s.limits(vars["key"])),
+			Items:     items,
+			DeadItems: deadItems,
 		})
 		if err != nil {
 			http.Error(w, "failed serving html", http.StatusInternalServerError)
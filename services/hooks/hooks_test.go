@@ -1,6 +1,9 @@
 package hooks
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -9,11 +12,14 @@ import (
 	"time"
 
 	"github.com/WillAbides/idcheck"
+	"github.com/WillAbides/xqsmee/metrics"
+	"github.com/WillAbides/xqsmee/policy"
 	"github.com/WillAbides/xqsmee/queue"
 	"github.com/WillAbides/xqsmee/queue/mockqueue"
 	"github.com/golang/mock/gomock"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -39,7 +45,7 @@ func testSetup(t *testing.T) *testObjects {
 	ts, err := ptypes.TimestampProto(now)
 	require.Nil(t, err)
 	return &testObjects{
-		service: New(mockQueue, idcheck.NewIDChecker(), "https://foo.com"),
+		service: New(mockQueue, ChecksumIDChecker{idcheck.NewIDChecker()}, "https://foo.com"),
 		queue:   mockQueue,
 		teardown: func() {
 			ctrl.Finish()
@@ -71,6 +77,76 @@ func TestService_pingHandler(t *testing.T) {
 	})
 }
 
+type checkedQueue struct {
+	*mockqueue.MockQueue
+	*mockqueue.MockHealthChecker
+}
+
+func TestService_healthHandler(t *testing.T) {
+	t.Run("healthy", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		res := tt.doRequest(http.MethodGet, "", "/_health")
+		tt.assert.Equal(http.StatusOK, res.Code)
+		tt.assert.Equal("ok", res.Body.String())
+	})
+
+	t.Run("backend is down", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		checker := mockqueue.NewMockHealthChecker(ctrl)
+		checker.EXPECT().HealthCheck(gomock.Any()).Return(errors.New("connection refused"))
+		tt.service.queue = checkedQueue{MockQueue: tt.queue, MockHealthChecker: checker}
+		res := tt.doRequest(http.MethodGet, "", "/_health")
+		tt.assert.Equal(http.StatusServiceUnavailable, res.Code)
+	})
+}
+
+type fakeTokens struct{}
+
+func (fakeTokens) Token(queueID string) string {
+	return "token-for-" + queueID
+}
+
+func TestService_newQueueHandler(t *testing.T) {
+	t.Run("redirects without tokens", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		res := tt.doRequest(http.MethodGet, "", "/q/new")
+		tt.assert.Equal(http.StatusFound, res.Code)
+		tt.assert.True(strings.HasPrefix(res.Header().Get("Location"), "/q/"))
+	})
+
+	t.Run("returns a token", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		tt.service.Tokens = fakeTokens{}
+		res := tt.doRequest(http.MethodGet, "", "/q/new")
+		tt.assert.Equal(http.StatusCreated, res.Code)
+		var got newQueueResponse
+		tt.require.Nil(json.Unmarshal(res.Body.Bytes(), &got))
+		tt.assert.NotEmpty(got.ID)
+		tt.assert.Equal("token-for-"+got.ID, got.Token)
+		tt.assert.Equal("https://foo.com/q/"+got.ID, got.URL)
+		tt.assert.Equal("/q/"+got.ID, res.Header().Get("Location"))
+	})
+
+	t.Run("shows the token in html", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		tt.service.Tokens = fakeTokens{}
+		req, err := http.NewRequest(http.MethodGet, "/q/new", nil)
+		tt.require.Nil(err)
+		req.Header.Set("Accept", "text/html")
+		res := httptest.NewRecorder()
+		tt.service.Router().ServeHTTP(res, req)
+		tt.assert.Equal(http.StatusCreated, res.Code)
+		tt.assert.Contains(res.Body.String(), "token-for-")
+	})
+}
+
 func TestService_peekHandler(t *testing.T) {
 	t.Run("works", func(t *testing.T) {
 		tt := testSetup(t)
@@ -78,7 +154,7 @@ func TestService_peekHandler(t *testing.T) {
 		ret := []*queue.WebRequest{}
 		for i := 0; i < 10; i++ {
 			ret = append(ret, &queue.WebRequest{
-				Body:       "hi",
+				Body:       []byte("hi"),
 				ReceivedAt: tt.timestamp,
 				Header:     []*queue.Header{},
 			})
@@ -98,7 +174,7 @@ func TestService_peekHandler(t *testing.T) {
 		ret := []*queue.WebRequest{}
 		for i := 0; i < 10; i++ {
 			ret = append(ret, &queue.WebRequest{
-				Body:       "hi",
+				Body:       []byte("hi"),
 				ReceivedAt: tt.timestamp,
 				Header:     []*queue.Header{},
 			})
@@ -111,6 +187,72 @@ func TestService_peekHandler(t *testing.T) {
 		body := strings.TrimSpace(res.Body.String())
 		tt.assert.Equal(string(exJSON), body)
 	})
+
+	t.Run("dead letters", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		ret := []*queue.WebRequest{{
+			Body:       []byte("hi"),
+			ReceivedAt: tt.timestamp,
+			Header:     []*queue.Header{},
+			Attempts:   3,
+		}}
+		exJSON, err := json.Marshal(ret)
+		tt.require.Nil(err)
+		tt.queue.EXPECT().PeekDead(gomock.Any(), testQueue, int64(0)).Return(ret, nil)
+		res := tt.doRequest(http.MethodGet, "", "/q/"+testQueue+"?dead")
+		tt.assert.Equal(http.StatusOK, res.Code)
+		body := strings.TrimSpace(res.Body.String())
+		tt.assert.Equal(string(exJSON), body)
+	})
+
+	t.Run("quarantine", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		ret := []*queue.WebRequest{{
+			Body:       []byte("hi"),
+			ReceivedAt: tt.timestamp,
+			Header:     []*queue.Header{},
+		}}
+		exJSON, err := json.Marshal(ret)
+		tt.require.Nil(err)
+		tt.queue.EXPECT().Peek(gomock.Any(), policy.QuarantineQueue(testQueue), int64(0)).Return(ret, nil)
+		res := tt.doRequest(http.MethodGet, "", "/q/"+testQueue+"?quarantine")
+		tt.assert.Equal(http.StatusOK, res.Code)
+		body := strings.TrimSpace(res.Body.String())
+		tt.assert.Equal(string(exJSON), body)
+	})
+
+	t.Run("html shows dead letters", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		dead := []*queue.WebRequest{{Body: []byte("deadbody"), Attempts: 3}}
+		tt.queue.EXPECT().Peek(gomock.Any(), testQueue, int64(0)).Return([]*queue.WebRequest{}, nil)
+		tt.queue.EXPECT().PeekDead(gomock.Any(), testQueue, int64(0)).Return(dead, nil)
+		req, err := http.NewRequest(http.MethodGet, "/q/"+testQueue, nil)
+		tt.require.Nil(err)
+		req.Header.Set("Accept", "text/html")
+		res := httptest.NewRecorder()
+		tt.service.Router().ServeHTTP(res, req)
+		tt.assert.Equal(http.StatusOK, res.Code)
+		tt.assert.Contains(res.Body.String(), "Dead Letters")
+		tt.assert.Contains(res.Body.String(), "deadbody")
+	})
+
+	t.Run("html shows dead letters once with dead", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		dead := []*queue.WebRequest{{Body: []byte("deadbody"), Attempts: 3}}
+		tt.queue.EXPECT().PeekDead(gomock.Any(), testQueue, int64(0)).Return(dead, nil)
+		req, err := http.NewRequest(http.MethodGet, "/q/"+testQueue+"?dead", nil)
+		tt.require.Nil(err)
+		req.Header.Set("Accept", "text/html")
+		res := httptest.NewRecorder()
+		tt.service.Router().ServeHTTP(res, req)
+		tt.assert.Equal(http.StatusOK, res.Code)
+		tt.assert.NotContains(res.Body.String(), "Dead Letters")
+		tt.assert.Equal(1, strings.Count(res.Body.String(), "deadbody"))
+	})
 }
 
 func TestService_postHandler(t *testing.T) {
@@ -119,13 +261,17 @@ func TestService_postHandler(t *testing.T) {
 		defer tt.teardown()
 		tt.service.receivedAtOverride = tt.now
 		exWebRequest := &queue.WebRequest{
-			Body:       "hi",
+			Body:       []byte("hi"),
 			ReceivedAt: tt.timestamp,
 			Header:     []*queue.Header{},
+			Method:     http.MethodPost,
+			Proto:      "HTTP/1.1",
 		}
 		tt.queue.EXPECT().Push(gomock.Any(), testQueue, []*queue.WebRequest{exWebRequest}).Return(nil)
+		before := metrics.CounterValue(pushes, testQueue)
 		res := tt.doRequest(http.MethodPost, "hi", "/q/"+testQueue)
 		tt.assert.Equal(http.StatusOK, res.Code)
+		tt.assert.Equal(before+1, metrics.CounterValue(pushes, testQueue))
 	})
 
 	t.Run("subqueue", func(t *testing.T) {
@@ -133,23 +279,46 @@ func TestService_postHandler(t *testing.T) {
 		defer tt.teardown()
 		tt.service.receivedAtOverride = tt.now
 		exWebRequest := &queue.WebRequest{
-			Body:       "hi",
+			Body:       []byte("hi"),
 			ReceivedAt: tt.timestamp,
 			Header:     []*queue.Header{},
+			Method:     http.MethodPost,
+			Path:       "/foo",
+			Proto:      "HTTP/1.1",
 		}
 		tt.queue.EXPECT().Push(gomock.Any(), testQueue+"/foo", []*queue.WebRequest{exWebRequest}).Return(nil)
 		res := tt.doRequest(http.MethodPost, "hi", "/q/"+testQueue+"/foo")
 		tt.assert.Equal(http.StatusOK, res.Code)
 	})
 
+	t.Run("query string", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		tt.service.receivedAtOverride = tt.now
+		exWebRequest := &queue.WebRequest{
+			Body:       []byte("hi"),
+			ReceivedAt: tt.timestamp,
+			Header:     []*queue.Header{},
+			Method:     http.MethodPost,
+			Path:       "/foo",
+			RawQuery:   "token=abc&x=1",
+			Proto:      "HTTP/1.1",
+		}
+		tt.queue.EXPECT().Push(gomock.Any(), testQueue+"/foo", []*queue.WebRequest{exWebRequest}).Return(nil)
+		res := tt.doRequest(http.MethodPost, "hi", "/q/"+testQueue+"/foo?token=abc&x=1")
+		tt.assert.Equal(http.StatusOK, res.Code)
+	})
+
 	t.Run("500 on queue error", func(t *testing.T) {
 		tt := testSetup(t)
 		defer tt.teardown()
 		tt.service.receivedAtOverride = tt.now
 		exWebRequest := &queue.WebRequest{
-			Body:       "hi",
+			Body:       []byte("hi"),
 			ReceivedAt: tt.timestamp,
 			Header:     []*queue.Header{},
+			Method:     http.MethodPost,
+			Proto:      "HTTP/1.1",
 		}
 		tt.queue.EXPECT().Push(gomock.Any(), testQueue, []*queue.WebRequest{exWebRequest}).Return(assert.AnError)
 		res := tt.doRequest(http.MethodPost, "hi", "/q/"+testQueue)
@@ -161,12 +330,272 @@ func TestService_postHandler(t *testing.T) {
 		defer tt.teardown()
 		tt.service.receivedAtOverride = tt.now
 		exWebRequest := &queue.WebRequest{
-			Body:       "",
+			Body:       []byte(""),
 			ReceivedAt: tt.timestamp,
 			Header:     []*queue.Header{},
+			Method:     http.MethodPost,
+			Proto:      "HTTP/1.1",
 		}
 		tt.queue.EXPECT().Push(gomock.Any(), testQueue, []*queue.WebRequest{exWebRequest}).Return(nil)
 		res := tt.doRequest(http.MethodPost, "", "/q/"+testQueue)
 		tt.assert.Equal(http.StatusOK, res.Code)
 	})
 }
+
+func (tt *testObjects) doSignedRequest(body, url, signature string) *httptest.ResponseRecorder {
+	tt.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	tt.require.Nil(err)
+	if signature != "" {
+		req.Header.Set("X-Hub-Signature-256", signature)
+	}
+	res := httptest.NewRecorder()
+	tt.service.Router().ServeHTTP(res, req)
+	return res
+}
+
+func githubSignature(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body)) //nolint: errcheck
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestService_postHandler_verification(t *testing.T) {
+	policies := policy.Static{
+		testQueue: {Verification: &policy.Verification{Scheme: policy.SchemeGitHub, Secret: "shhh"}},
+	}
+
+	t.Run("accepts valid signatures", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		tt.service.Policies = policies
+		tt.queue.EXPECT().Push(gomock.Any(), testQueue+"/foo", gomock.Any()).Return(nil)
+		res := tt.doSignedRequest("hi", "/q/"+testQueue+"/foo", githubSignature("shhh", "hi"))
+		tt.assert.Equal(http.StatusOK, res.Code)
+	})
+
+	t.Run("rejects invalid signatures", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		tt.service.Policies = policies
+		res := tt.doSignedRequest("hi", "/q/"+testQueue, githubSignature("wrong", "hi"))
+		tt.assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("rejects unsigned requests", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		tt.service.Policies = policies
+		res := tt.doSignedRequest("hi", "/q/"+testQueue, "")
+		tt.assert.Equal(http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("quarantines invalid signatures", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		tt.service.Policies = policy.Static{
+			testQueue: {Verification: &policy.Verification{
+				Scheme:     policy.SchemeGitHub,
+				Secret:     "shhh",
+				Quarantine: true,
+			}},
+		}
+		tt.queue.EXPECT().Push(gomock.Any(), policy.QuarantineQueue(testQueue), gomock.Any()).Return(nil)
+		res := tt.doSignedRequest("hi", "/q/"+testQueue, githubSignature("wrong", "hi"))
+		tt.assert.Equal(http.StatusOK, res.Code)
+	})
+
+	t.Run("ignores queues without a policy", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		tt.service.Policies = policy.Static{}
+		tt.queue.EXPECT().Push(gomock.Any(), testQueue, gomock.Any()).Return(nil)
+		res := tt.doSignedRequest("hi", "/q/"+testQueue, "")
+		tt.assert.Equal(http.StatusOK, res.Code)
+	})
+}
+
+type limitedQueue struct {
+	*mockqueue.MockQueue
+	*mockqueue.MockLimiter
+}
+
+func TestService_postHandler_limits(t *testing.T) {
+	setup := func(t *testing.T) (*testObjects, *mockqueue.MockLimiter) {
+		tt := testSetup(t)
+		ctrl := gomock.NewController(t)
+		teardown := tt.teardown
+		tt.teardown = func() {
+			ctrl.Finish()
+			teardown()
+		}
+		limiter := mockqueue.NewMockLimiter(ctrl)
+		tt.service.queue = limitedQueue{MockQueue: tt.queue, MockLimiter: limiter}
+		tt.service.Limits = queue.Limits{MaxItems: 100}
+		return tt, limiter
+	}
+
+	t.Run("429 when the queue is full", func(t *testing.T) {
+		tt, limiter := setup(t)
+		defer tt.teardown()
+		limiter.EXPECT().PushLimited(gomock.Any(), testQueue, gomock.Any(), tt.service.Limits).
+			Return(int64(0), queue.ErrMaxItems)
+		before := metrics.CounterValue(rejects, testQueue, "items")
+		res := tt.doRequest(http.MethodPost, "hi", "/q/"+testQueue)
+		tt.assert.Equal(http.StatusTooManyRequests, res.Code)
+		tt.assert.Equal(before+1, metrics.CounterValue(rejects, testQueue, "items"))
+	})
+
+	t.Run("507 when the queue is out of space", func(t *testing.T) {
+		tt, limiter := setup(t)
+		defer tt.teardown()
+		limiter.EXPECT().PushLimited(gomock.Any(), testQueue, gomock.Any(), tt.service.Limits).
+			Return(int64(0), queue.ErrMaxBytes)
+		res := tt.doRequest(http.MethodPost, "hi", "/q/"+testQueue)
+		tt.assert.Equal(http.StatusInsufficientStorage, res.Code)
+	})
+
+	t.Run("counts dropped items", func(t *testing.T) {
+		tt, limiter := setup(t)
+		defer tt.teardown()
+		limiter.EXPECT().PushLimited(gomock.Any(), testQueue, gomock.Any(), tt.service.Limits).Return(int64(2), nil)
+		before := metrics.CounterValue(drops, testQueue)
+		res := tt.doRequest(http.MethodPost, "hi", "/q/"+testQueue)
+		tt.assert.Equal(http.StatusOK, res.Code)
+		tt.assert.Equal(before+2, metrics.CounterValue(drops, testQueue))
+	})
+
+	t.Run("uses the queue's policy", func(t *testing.T) {
+		tt, limiter := setup(t)
+		defer tt.teardown()
+		tt.service.Policies = policy.Static{testQueue: {MaxBytes: 1000, Overflow: queue.OverflowDropNewest}}
+		exLimits := queue.Limits{MaxItems: 100, MaxBytes: 1000, Overflow: queue.OverflowDropNewest}
+		limiter.EXPECT().PushLimited(gomock.Any(), testQueue+"/foo", gomock.Any(), exLimits).Return(int64(0), nil)
+		res := tt.doRequest(http.MethodPost, "hi", "/q/"+testQueue+"/foo")
+		tt.assert.Equal(http.StatusOK, res.Code)
+	})
+
+	t.Run("html shows the limits", func(t *testing.T) {
+		tt, _ := setup(t)
+		defer tt.teardown()
+		tt.service.Limits.Overflow = queue.OverflowDropOldest
+		tt.queue.EXPECT().Peek(gomock.Any(), testQueue, int64(0)).Return([]*queue.WebRequest{}, nil)
+		tt.queue.EXPECT().PeekDead(gomock.Any(), testQueue, int64(0)).Return(nil, nil)
+		req, err := http.NewRequest(http.MethodGet, "/q/"+testQueue, nil)
+		tt.require.Nil(err)
+		req.Header.Set("Accept", "text/html")
+		res := httptest.NewRecorder()
+		tt.service.Router().ServeHTTP(res, req)
+		tt.assert.Equal(http.StatusOK, res.Code)
+		tt.assert.Contains(res.Body.String(),
+			"This queue holds up to 100 requests. When it is full, the oldest requests are dropped to make room.")
+	})
+}
+
+func TestService_postHandler_maxBodySize(t *testing.T) {
+	t.Run("413 when the content length is too large", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		tt.service.MaxBodySize = 4
+		before := metrics.CounterValue(oversized, testQueue)
+		res := tt.doRequest(http.MethodPost, "hello", "/q/"+testQueue)
+		tt.assert.Equal(http.StatusRequestEntityTooLarge, res.Code)
+		tt.assert.Equal(before+1, metrics.CounterValue(oversized, testQueue))
+	})
+
+	t.Run("413 when a body without a content length is too large", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		tt.service.MaxBodySize = 4
+		req, err := http.NewRequest(http.MethodPost, "/q/"+testQueue, strings.NewReader("hello"))
+		tt.require.Nil(err)
+		req.ContentLength = -1
+		res := httptest.NewRecorder()
+		tt.service.Router().ServeHTTP(res, req)
+		tt.assert.Equal(http.StatusRequestEntityTooLarge, res.Code)
+	})
+
+	t.Run("uses the queue's policy", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		tt.service.MaxBodySize = 4
+		tt.service.Policies = policy.Static{testQueue: {MaxBodySize: 5}}
+		tt.queue.EXPECT().Push(gomock.Any(), testQueue, gomock.Any()).Return(nil)
+		res := tt.doRequest(http.MethodPost, "hello", "/q/"+testQueue)
+		tt.assert.Equal(http.StatusOK, res.Code)
+	})
+
+	t.Run("defaults to DefaultMaxBodySize", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		res := tt.doRequest(http.MethodPost, strings.Repeat("a", DefaultMaxBodySize+1), "/q/"+testQueue)
+		tt.assert.Equal(http.StatusRequestEntityTooLarge, res.Code)
+	})
+}
+
+func TestService_responses(t *testing.T) {
+	response := &policy.Response{
+		Status:  http.StatusAccepted,
+		Headers: map[string]string{"X-Thanks": "yes"},
+		Body:    "thanks",
+		Handshakes: []*policy.Handshake{
+			{Provider: policy.HandshakeSlack},
+			{Provider: policy.HandshakeMeta, VerifyToken: "letmein"},
+			{Provider: policy.HandshakeMicrosoftGraph},
+		},
+	}
+
+	t.Run("answers queued requests", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		tt.service.Policies = policy.Static{testQueue: {Response: response}}
+		tt.queue.EXPECT().Push(gomock.Any(), testQueue, gomock.Any()).Return(nil)
+		res := tt.doRequest(http.MethodPost, "hi", "/q/"+testQueue)
+		tt.assert.Equal(http.StatusAccepted, res.Code)
+		tt.assert.Equal("yes", res.Header().Get("X-Thanks"))
+		tt.assert.Equal("thanks", res.Body.String())
+	})
+
+	t.Run("answers post handshakes without queueing them", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		tt.service.Policies = policy.Static{testQueue: {Response: response}}
+		before := metrics.CounterValue(handshakes, testQueue)
+		res := tt.doRequest(http.MethodPost, `{"type":"url_verification","challenge":"abc"}`, "/q/"+testQueue)
+		tt.assert.Equal(http.StatusOK, res.Code)
+		tt.assert.Equal("abc", res.Body.String())
+		res = tt.doRequest(http.MethodPost, "", "/q/"+testQueue+"?validationToken=xyz")
+		tt.assert.Equal(http.StatusOK, res.Code)
+		tt.assert.Equal("xyz", res.Body.String())
+		tt.assert.Equal(before+2, metrics.CounterValue(handshakes, testQueue))
+	})
+
+	t.Run("answers get handshakes without peeking", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		tt.service.Policies = policy.Static{testQueue: {Response: response}}
+		url := "/q/" + testQueue + "?hub.mode=subscribe&hub.challenge=123&hub.verify_token="
+		res := tt.doRequest(http.MethodGet, "", url+"letmein")
+		tt.assert.Equal(http.StatusOK, res.Code)
+		tt.assert.Equal("123", res.Body.String())
+		res = tt.doRequest(http.MethodGet, "", url+"wrong")
+		tt.assert.Equal(http.StatusForbidden, res.Code)
+	})
+
+	t.Run("queues quarantined handshakes", func(t *testing.T) {
+		tt := testSetup(t)
+		defer tt.teardown()
+		tt.service.Policies = policy.Static{testQueue: {
+			Response: response,
+			Verification: &policy.Verification{
+				Scheme:     policy.SchemeSlack,
+				Secret:     "shhh",
+				Quarantine: true,
+			},
+		}}
+		tt.queue.EXPECT().Push(gomock.Any(), policy.QuarantineQueue(testQueue), gomock.Any()).Return(nil)
+		res := tt.doRequest(http.MethodPost, `{"type":"url_verification","challenge":"abc"}`, "/q/"+testQueue)
+		tt.assert.Equal(http.StatusAccepted, res.Code)
+		tt.assert.Equal("thanks", res.Body.String())
+	})
+}